@@ -3,37 +3,146 @@ package commands
 import (
 	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/ryanelliottsmith/network-debugger/pkg/agent"
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
 	"github.com/spf13/cobra"
 )
 
 var agentCmd = &cobra.Command{
-	Use:   "agent",
+	Use:   "agent [TARGET...]",
 	Short: "Run as agent (for DaemonSet or standalone container)",
 	Long: `Run in agent mode. Can operate in two modes:
   1. ConfigMap mode: Watch ConfigMap for test triggers (for DaemonSet)
-  2. Direct mode: Run checks specified via flags (for standalone use)`,
+  2. Direct mode: Run checks specified via flags (for standalone use)
+
+In direct mode, targets (IPs or hostnames) are given as arguments. Ping,
+hostconfig, conntrack and dns run by default; bandwidth and ports must be
+requested explicitly since they need something listening on the target.
+The ports check only tests the control plane ports on the targets named with
+--control-plane.
+
+Example:
+  docker run --rm --net=host --privileged ghcr.io/ryanelliottsmith/network-debugger agent 10.0.0.11 10.0.0.12`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		mode, _ := cmd.Flags().GetString("mode")
 		configRef, _ := cmd.Flags().GetString("config")
 
+		// Stopping the agent aborts in-flight checks and their child processes
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
 		if mode == "configmap" {
 			if configRef == "" {
 				return fmt.Errorf("--config required for configmap mode (format: NAMESPACE/CONFIGMAPNAME)")
 			}
+
+			listenAddr, _ := cmd.Flags().GetString("listen-addr")
+			healthAddr, _ := cmd.Flags().GetString("health-addr")
+			tokenFile, _ := cmd.Flags().GetString("token-file")
+			monitorInterval, _ := cmd.Flags().GetDuration("monitor-interval")
+			monitorChecks, _ := cmd.Flags().GetStringSlice("monitor-checks")
+
+			return agent.Run(ctx, agent.Options{
+				Mode:            mode,
+				ConfigRef:       configRef,
+				ListenAddr:      listenAddr,
+				HealthAddr:      healthAddr,
+				TokenFile:       tokenFile,
+				MonitorInterval: monitorInterval,
+				MonitorChecks:   monitorChecks,
+			})
+		}
+
+		if mode != "" {
+			return fmt.Errorf("unknown agent mode: %s", mode)
+		}
+
+		checks, _ := cmd.Flags().GetStringSlice("checks")
+		controlPlane, _ := cmd.Flags().GetStringSlice("control-plane")
+		hostNetwork, _ := cmd.Flags().GetBool("host-network")
+		overlay, _ := cmd.Flags().GetBool("overlay")
+		portSpecs, _ := cmd.Flags().GetStringSlice("ports")
+		dnsNames, _ := cmd.Flags().GetStringSlice("dns-names")
+		dnsTransport, _ := cmd.Flags().GetBool("dns-transport")
+		dnsBurst, _ := cmd.Flags().GetInt("dns-burst")
+		cni, _ := cmd.Flags().GetString("cni")
+		checkTimeoutSpecs, _ := cmd.Flags().GetStringSlice("check-timeout")
+		udpBitrate, _ := cmd.Flags().GetString("udp-bitrate")
+		outputFormat, _ := cmd.Flags().GetString("output")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+
+		if hostNetwork && overlay {
+			return fmt.Errorf("--host-network and --overlay are mutually exclusive in direct mode")
+		}
+
+		networkType := types.NetworkTypeHost
+		if overlay {
+			networkType = types.NetworkTypeOverlay
+		}
+
+		ports, err := types.ParsePortStrings(portSpecs)
+		if err != nil {
+			return fmt.Errorf("invalid --ports: %w", err)
+		}
+
+		if _, err := types.ParseDNSQueries(dnsNames); err != nil {
+			return fmt.Errorf("invalid --dns-names: %w", err)
+		}
+		if dnsBurst < 0 {
+			return fmt.Errorf("--dns-burst must not be negative")
+		}
+
+		checkTimeouts, err := parseCheckTimeouts(checkTimeoutSpecs)
+		if err != nil {
+			return err
+		}
+
+		if err := validateCNI(cni); err != nil {
+			return err
+		}
+		if cni == "auto" {
+			cni = ""
 		}
 
-		ctx := context.Background()
-		return agent.Run(ctx, mode, configRef)
+		return agent.RunDirect(ctx, agent.DirectOptions{
+			Checks:        checks,
+			Targets:       args,
+			ControlPlane:  controlPlane,
+			Ports:         ports,
+			DNSNames:      dnsNames,
+			DNSTransport:  dnsTransport,
+			DNSBurst:      dnsBurst,
+			CNI:           cni,
+			CheckTimeouts: checkTimeouts,
+			UDPBitrate:    udpBitrate,
+			NetworkType:   networkType,
+			Output:        outputFormat,
+			Quiet:         quiet,
+		})
 	},
 }
 
 func init() {
 	agentCmd.Flags().String("mode", "", "Agent mode: 'configmap' or empty for direct mode")
 	agentCmd.Flags().String("config", "", "ConfigMap reference in format NAMESPACE/CONFIGMAPNAME (for configmap mode)")
-	agentCmd.Flags().StringSlice("checks", []string{}, "Checks to run (direct mode)")
-	agentCmd.Flags().Bool("host-network", false, "Test host network (direct mode)")
-	agentCmd.Flags().Bool("overlay", false, "Test overlay network (direct mode)")
-	agentCmd.Flags().StringSlice("ports", []string{}, "Override default ports (direct mode)")
+	agentCmd.Flags().String("listen-addr", fmt.Sprintf(":%d", types.AgentPort), "Address for the agent HTTP server serving the control API and /metrics, empty to disable (configmap mode)")
+	agentCmd.Flags().String("health-addr", fmt.Sprintf(":%d", types.HealthPort), "Address serving only /healthz and /readyz for the kubelet's probes, empty to disable (configmap mode)")
+	agentCmd.Flags().String("token-file", agent.DefaultTokenFile, "File containing the shared token required by the HTTP control API (configmap mode)")
+	agentCmd.Flags().Duration("monitor-interval", 0, "Re-run monitor checks against all peers on this interval and export them as Prometheus metrics, 0 to disable (configmap mode)")
+	agentCmd.Flags().StringSlice("monitor-checks", agent.DefaultMonitorChecks, "Checks to run on every monitoring pass (configmap mode)")
+	agentCmd.Flags().StringSlice("checks", []string{}, "Checks to run (direct mode, default: ping,hostconfig,conntrack,dns)")
+	agentCmd.Flags().StringSlice("control-plane", []string{}, "Targets that are control plane nodes, whose apiserver, supervisor and etcd ports the ports check tests (direct mode)")
+	agentCmd.Flags().Bool("host-network", false, "Running in the host network namespace (direct mode, default)")
+	agentCmd.Flags().Bool("overlay", false, "Running in a pod on the overlay network; skips host-only checks and keeps cluster.local DNS names (direct mode)")
+	agentCmd.Flags().StringSlice("ports", []string{}, "Override default ports (direct mode, format: 8080/tcp:name,9000/udp:name)")
+	agentCmd.Flags().StringSlice("dns-names", []string{}, "Override the dns check's queries (direct mode, format: name[@server][/type][=expected])")
+	agentCmd.Flags().Bool("dns-transport", false, "Repeat every DNS lookup over plain UDP, UDP with EDNS0 and TCP (direct mode)")
+	agentCmd.Flags().Int("dns-burst", 0, "Send this many pairs of parallel A and AAAA queries per DNS name (direct mode, 0 = off)")
+	agentCmd.Flags().String("cni", "auto", "CNI port profile added to the ports check: auto (detect from /etc/cni/net.d), none, or a profile name (direct mode)")
+	agentCmd.Flags().StringSlice("check-timeout", []string{}, "Override per-check timeouts (direct mode, format: ping=15s,ports=30s)")
+	agentCmd.Flags().String("udp-bitrate", "", "Run bandwidth checks over UDP at this target bitrate (direct mode, e.g. 100M)")
 }
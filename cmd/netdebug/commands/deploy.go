@@ -3,8 +3,10 @@ package commands
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/ryanelliottsmith/network-debugger/pkg/agent"
 	"github.com/ryanelliottsmith/network-debugger/pkg/k8s"
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -37,7 +39,7 @@ var deployInstallCmd = &cobra.Command{
 			return fmt.Errorf("failed to create dynamic client: %w", err)
 		}
 
-		if err := k8s.Install(ctx, clientset, dynamicClient, namespace, imageOverride); err != nil {
+		if err := k8s.Install(ctx, clientset, dynamicClient, namespace, imageOverride, monitorAgentArgs(cmd)...); err != nil {
 			return fmt.Errorf("failed to install: %w", err)
 		}
 
@@ -82,6 +84,13 @@ var deployUninstallCmd = &cobra.Command{
 			return fmt.Errorf("failed to uninstall: %w", err)
 		}
 
+		if crds, _ := cmd.Flags().GetBool("crds"); crds {
+			if err := k8s.UninstallCRDs(ctx, dynamicClient); err != nil {
+				return fmt.Errorf("failed to remove CRDs: %w", err)
+			}
+			fmt.Println("CRDs and stored runs removed")
+		}
+
 		fmt.Println("Resources removed successfully")
 
 		return nil
@@ -96,7 +105,9 @@ var deployTemplateCmd = &cobra.Command{
 		namespace, _ := cmd.Flags().GetString("namespace")
 		imageOverride, _ := cmd.Flags().GetString("image")
 
-		fmt.Print(k8s.GetAllManifests(namespace, imageOverride))
+		fmt.Print(k8s.GetCRDManifests())
+		fmt.Print("---\n")
+		fmt.Print(k8s.GetAllManifests(namespace, imageOverride, monitorAgentArgs(cmd)...))
 		return nil
 	},
 }
@@ -169,5 +180,25 @@ func init() {
 	}
 
 	deployInstallCmd.Flags().String("image", "", "Override default image (default: "+k8s.DefaultImage+")")
+	deployUninstallCmd.Flags().Bool("crds", false, "Also remove the NetdebugRun/NetdebugResult CRDs and all stored runs")
 	deployTemplateCmd.Flags().String("image", "", "Override default image (default: "+k8s.DefaultImage+")")
+
+	for _, cmd := range []*cobra.Command{deployInstallCmd, deployTemplateCmd} {
+		cmd.Flags().Duration("monitor-interval", 0, "Have agents re-run checks on this interval and expose Prometheus metrics on :9797/metrics (0 = disabled)")
+		cmd.Flags().StringSlice("monitor-checks", agent.DefaultMonitorChecks, "Checks agents run on every monitoring pass")
+	}
+}
+
+// monitorAgentArgs returns the extra agent arguments for continuous monitoring, if enabled.
+func monitorAgentArgs(cmd *cobra.Command) []string {
+	interval, _ := cmd.Flags().GetDuration("monitor-interval")
+	if interval <= 0 {
+		return nil
+	}
+
+	checks, _ := cmd.Flags().GetStringSlice("monitor-checks")
+	return []string{
+		"--monitor-interval=" + interval.String(),
+		"--monitor-checks=" + strings.Join(checks, ","),
+	}
 }
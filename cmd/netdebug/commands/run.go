@@ -2,8 +2,13 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
 
 	checkspkg "github.com/ryanelliottsmith/network-debugger/pkg/checks"
@@ -13,8 +18,12 @@ import (
 	"github.com/ryanelliottsmith/network-debugger/pkg/types"
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
+// crossNetworkChecks are run across networks with --cross-network.
+var crossNetworkChecks = []string{"ping", "tcpping"}
+
 var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Run coordinated network tests via DaemonSet",
@@ -24,35 +33,106 @@ Tests connectivity, DNS, ports, and optionally bandwidth between nodes.`,
 }
 
 func init() {
-	runCmd.Flags().StringSlice("checks", []string{"dns", "ping", "hostconfig", "conntrack", "iptables"}, "Checks to run (dns,ping,ports,bandwidth,hostconfig,conntrack,iptables)")
+	runCmd.Flags().StringSlice("checks", []string{"dns", "ping", "hostconfig", "conntrack", "iptables"}, "Checks to run (dns,ping,tcpping,traceroute,pmtu,dnsrecords,service,nodeport,ports,bandwidth,hostconfig,resolvconf,overlaymtu,conntrack,iptables)")
 	runCmd.Flags().Bool("host-network", true, "Test host network path")
 	runCmd.Flags().Bool("overlay", true, "Test overlay network path")
+	runCmd.Flags().Bool("cross-network", false, "Also test host-to-pod and pod-to-host paths: host pods ping and TCP-probe every overlay pod IP, overlay pods every node IP")
 	runCmd.Flags().StringSlice("ports", []string{}, "Override default port list (format: 8080/tcp:name,9000/udp:name)")
+	runCmd.Flags().StringSlice("dns-names", []string{}, "Override the dns check's queries (format: name[@server][/type][=expected], e.g. google.com@1.1.1.1/AAAA, kubernetes.default.svc.cluster.local@nodelocal=10.43.0.1)")
+	runCmd.Flags().Bool("dns-transport", false, "Repeat every DNS lookup over plain UDP, UDP with 1232 and 4096 byte EDNS0 buffers, and TCP, to find blocked TCP/53 and dropped fragments")
+	runCmd.Flags().Int("dns-burst", 0, "Send this many pairs of parallel A and AAAA queries per DNS name and report the latency histogram, timeouts and answers over 1s and 5s (0 = off)")
+	runCmd.Flags().String("cni", "auto", "CNI port profile added to the ports check: auto (detect from DaemonSets, then each host's /etc/cni/net.d), none, or one of "+strings.Join(types.CNIProfileNames(), ", "))
 	runCmd.Flags().StringP("namespace", "n", "default", "Namespace for DaemonSet deployment")
 	runCmd.Flags().Duration("timeout", 5*time.Minute, "Overall timeout (0 = no timeout)")
+	runCmd.Flags().StringSlice("check-timeout", []string{}, "Override per-check timeouts (format: ping=15s,ports=30s)")
 	runCmd.Flags().Bool("cleanup", true, "Remove DaemonSet after test completion")
 	runCmd.Flags().String("iperf-args", "", "Custom arguments to pass to iperf3 during bandwidth checks (e.g. \"-R -t 30\")")
+	runCmd.Flags().String("udp-bitrate", "", "Run bandwidth checks over UDP at this target bitrate and report jitter and datagram loss (e.g. 100M)")
 	runCmd.Flags().String("image", "", "Override default image (default: "+k8s.DefaultImage+")")
+	runCmd.Flags().String("transport", string(coordinator.TransportAuto), "How runs reach agents: auto, crd (NetdebugRun/NetdebugResult objects), api (agent HTTP API via pod proxy) or configmap (ConfigMap and pod logs)")
+	runCmd.Flags().Bool("wait", false, "Wait for another in-progress run in the namespace to finish instead of failing")
+	runCmd.Flags().Bool("force", false, "Take the run lock even if another run in the namespace holds it")
+	runCmd.Flags().String("attach", "", "Reattach to a run stored in a NetdebugRun by run ID and print its results")
 }
 
 func runTests(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
+	// Interrupting the CLI cancels the in-flight run on the agents
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	checks, _ := cmd.Flags().GetStringSlice("checks")
 	hostNetwork, _ := cmd.Flags().GetBool("host-network")
 	overlay, _ := cmd.Flags().GetBool("overlay")
+	crossNetwork, _ := cmd.Flags().GetBool("cross-network")
+	portSpecs, _ := cmd.Flags().GetStringSlice("ports")
+	dnsNames, _ := cmd.Flags().GetStringSlice("dns-names")
+	dnsTransport, _ := cmd.Flags().GetBool("dns-transport")
+	dnsBurst, _ := cmd.Flags().GetInt("dns-burst")
+	cni, _ := cmd.Flags().GetString("cni")
 	namespace, _ := cmd.Flags().GetString("namespace")
 	timeout, _ := cmd.Flags().GetDuration("timeout")
+	checkTimeoutSpecs, _ := cmd.Flags().GetStringSlice("check-timeout")
 	cleanup, _ := cmd.Flags().GetBool("cleanup")
 	outputFormat, _ := cmd.Flags().GetString("output")
 	iperfArgs, _ := cmd.Flags().GetString("iperf-args")
+	udpBitrate, _ := cmd.Flags().GetString("udp-bitrate")
 	quiet, _ := cmd.Flags().GetBool("quiet")
 	image, _ := cmd.Flags().GetString("image")
+	transport, _ := cmd.Flags().GetString("transport")
+	attach, _ := cmd.Flags().GetString("attach")
+	wait, _ := cmd.Flags().GetBool("wait")
+	force, _ := cmd.Flags().GetBool("force")
 
 	if !hostNetwork && !overlay {
 		return fmt.Errorf("at least one network mode must be enabled (use --host-network=false or --overlay=false, not both)")
 	}
 
+	if crossNetwork && (!hostNetwork || !overlay) {
+		return fmt.Errorf("--cross-network needs both the host and overlay networks enabled")
+	}
+
+	if slices.Contains(checks, "nodeport") && (!hostNetwork || !overlay) {
+		return fmt.Errorf("the nodeport check needs both the host and overlay networks enabled")
+	}
+
+	if slices.Contains(checks, "dnsrecords") && !overlay {
+		return fmt.Errorf("the dnsrecords check needs the overlay network enabled")
+	}
+
+	switch coordinator.Transport(transport) {
+	case coordinator.TransportAuto, coordinator.TransportCRD, coordinator.TransportAPI, coordinator.TransportConfigMap:
+	default:
+		return fmt.Errorf("invalid --transport %q (must be auto, crd, api or configmap)", transport)
+	}
+
+	checkTimeouts, err := parseCheckTimeouts(checkTimeoutSpecs)
+	if err != nil {
+		return err
+	}
+
+	ports := types.DefaultPorts()
+	if len(portSpecs) > 0 {
+		ports, err = types.ParsePortStrings(portSpecs)
+		if err != nil {
+			return fmt.Errorf("invalid --ports: %w", err)
+		}
+	}
+
+	if _, err := types.ParseDNSQueries(dnsNames); err != nil {
+		return fmt.Errorf("invalid --dns-names: %w", err)
+	}
+	if dnsBurst < 0 {
+		return fmt.Errorf("--dns-burst must not be negative")
+	}
+
+	if err := validateCNI(cni); err != nil {
+		return err
+	}
+
+	if attach != "" {
+		return attachRun(ctx, attach, namespace, timeout, outputFormat, quiet)
+	}
+
 	bandwidthRequested := false
 	checksWithoutBandwidth := []string{}
 	for _, check := range checks {
@@ -78,6 +158,24 @@ func runTests(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to create dynamic client: %w", err)
 	}
 
+	lock, err := coordinator.AcquireRunLock(ctx, clientset, namespace, coordinator.LockOptions{Wait: wait, Force: force})
+	if err != nil {
+		var held *coordinator.LockHeldError
+		if errors.As(err, &held) {
+			return fmt.Errorf("%w (use --wait to queue behind it or --force to take over)", err)
+		}
+		return err
+	}
+	defer func() {
+		if err := lock.Release(); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}()
+
+	// Losing the lock to another invocation cancels the run like an interrupt
+	ctx, cancelLost := lock.Context(ctx)
+	defer cancelLost()
+
 	fmt.Println("Checking DaemonSet deployment...")
 	_, err = clientset.AppsV1().DaemonSets(namespace).Get(ctx, "netdebug-host", metav1.GetOptions{})
 	needsDeployment := err != nil
@@ -90,6 +188,11 @@ func runTests(cmd *cobra.Command, args []string) error {
 		fmt.Println("DaemonSets deployed")
 	} else {
 		fmt.Println("DaemonSets already deployed")
+		if slices.Contains(checks, "service") {
+			if err := k8s.EnsureService(ctx, dynamicClient, namespace); err != nil {
+				return fmt.Errorf("failed to create Service: %w", err)
+			}
+		}
 	}
 
 	fmt.Println("\nWaiting for DaemonSets to be ready...")
@@ -106,7 +209,29 @@ func runTests(cmd *cobra.Command, args []string) error {
 		fmt.Println("Overlay network DaemonSet ready")
 	}
 
-	coord := coordinator.NewCoordinator(clientset, namespace, "netdebug-config")
+	serviceAddress := ""
+	if slices.Contains(checks, "service") {
+		serviceAddress, err = k8s.GetServiceAddress(ctx, clientset, namespace)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Service %s at %s\n", k8s.ServiceName, serviceAddress)
+	}
+
+	var portNodes map[string][]string
+	if slices.Contains(checks, "ports") {
+		cni = resolveCNI(ctx, clientset, cni)
+		cniMode, err := k8s.DetectCNIMode(ctx, clientset, dynamicClient, cni)
+		if err != nil {
+			fmt.Printf("Warning: failed to detect %s mode, its mode-dependent ports are optional: %v\n", cni, err)
+		}
+		ports = types.MergePorts(ports, types.CNIProfilePorts(cni, cniMode))
+		portNodes = cniMode.PortNodes()
+	}
+
+	coord := coordinator.NewCoordinator(clientset, dynamicClient, namespace, "netdebug-config")
+	coord.SetTransport(coordinator.Transport(transport))
+	coord.SetRunLock(lock)
 
 	fmt.Println("\nDiscovering pods...")
 	var hostPods, overlayPods []types.TargetNode
@@ -133,6 +258,85 @@ func runTests(cmd *cobra.Command, args []string) error {
 		fmt.Printf("Found %d overlay network pods\n", len(overlayPods))
 	}
 
+	if len(dnsNames) == 0 && slices.Contains(checks, "dns") {
+		dnsNames = defaultDNSNames(ctx, clientset)
+	}
+
+	var dnsServers []types.DNSServer
+	if overlay && slices.Contains(checks, "dns") {
+		dnsServers, err = k8s.GetDNSServers(ctx, clientset)
+		if err != nil {
+			fmt.Printf("Warning: not querying CoreDNS replicas individually: %v\n", err)
+		} else {
+			fmt.Printf("Found %d cluster DNS servers (the %s VIP and its replicas)\n", len(dnsServers), k8s.DNSServiceName)
+		}
+	}
+
+	var nodePort *types.NodePortTest
+	if slices.Contains(checks, "nodeport") {
+		nodePort, err = k8s.CreateNodePortServices(ctx, clientset, namespace)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := k8s.DeleteNodePortServices(context.Background(), clientset, namespace); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+		}()
+
+		// The Local policy Service only answers on nodes with an overlay agent
+		for _, pod := range overlayPods {
+			nodePort.BackendNodes = append(nodePort.BackendNodes, pod.NodeName)
+		}
+		fmt.Printf("NodePort Services on ports %d (Cluster) and %d (Local)\n", nodePort.ClusterPort, nodePort.LocalPort)
+	}
+
+	// The service check expects an answer from every overlay agent
+	var serviceBackends []string
+	if serviceAddress != "" {
+		for _, pod := range overlayPods {
+			serviceBackends = append(serviceBackends, pod.NodeName)
+		}
+	}
+
+	var dnsRecords *types.DNSRecordsTest
+	if slices.Contains(checks, "dnsrecords") {
+		dnsRecords, err = k8s.CreateHeadlessService(ctx, clientset, namespace, overlayPods)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := k8s.DeleteHeadlessService(context.Background(), clientset, namespace); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+		}()
+
+		// Host network agents don't use cluster DNS, so they ask the VIP
+		if hostNetwork {
+			dnsRecords.Server, err = k8s.GetDNSServiceAddress(ctx, clientset)
+			if err != nil {
+				return fmt.Errorf("host network agents can't verify DNS records: %w", err)
+			}
+		}
+		fmt.Printf("Headless Service %s selecting %d overlay pods\n", dnsRecords.Service, len(overlayPods))
+	}
+
+	base := types.Config{
+		Ports:           ports,
+		DNSNames:        dnsNames,
+		DNSServers:      dnsServers,
+		DNSTransport:    dnsTransport,
+		DNSBurst:        dnsBurst,
+		CNI:             cni,
+		PortNodes:       portNodes,
+		ServiceAddress:  serviceAddress,
+		ServiceBackends: serviceBackends,
+		NodePort:        nodePort,
+		DNSRecords:      dnsRecords,
+		CheckTimeouts:   checkTimeouts,
+		Quiet:           quiet,
+	}
+
 	allEvents := []*types.Event{}
 
 	if len(checksWithoutBandwidth) > 0 {
@@ -140,17 +344,17 @@ func runTests(cmd *cobra.Command, args []string) error {
 
 		if hostNetwork {
 			fmt.Println("\n--- Host Network Tests ---")
-			events, err := runStandardTests(ctx, coord, hostTargets, hostPods, checksWithoutBandwidth, timeout, quiet, types.NetworkTypeHost)
+			events, err := runStandardTests(ctx, coord, base, hostTargets, hostPods, checksWithoutBandwidth, timeout, types.NetworkTypeHost)
 			if err != nil {
 				fmt.Printf("Warning: host network tests failed: %v\n", err)
 			}
 			allEvents = append(allEvents, events...)
 		}
 
-		if overlay {
+		if overlay && ctx.Err() == nil {
 			fmt.Println("\n--- Overlay Network Tests ---")
 			overlayChecks := filterHostNetworkOnlyChecks(checksWithoutBandwidth)
-			events, err := runStandardTests(ctx, coord, overlayTargets, overlayPods, overlayChecks, timeout, quiet, types.NetworkTypeOverlay)
+			events, err := runStandardTests(ctx, coord, base, overlayTargets, overlayPods, overlayChecks, timeout, types.NetworkTypeOverlay)
 			if err != nil {
 				fmt.Printf("Warning: overlay network tests failed: %v\n", err)
 			}
@@ -158,21 +362,41 @@ func runTests(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	if bandwidthRequested {
+	if crossNetwork && ctx.Err() == nil {
+		fmt.Println("\nRunning cross-network checks...")
+
+		fmt.Println("\n--- Host -> Overlay Tests ---")
+		events, err := runStandardTests(ctx, coord, base, overlayTargets, hostPods, crossNetworkChecks, timeout, types.NetworkTypeHostToOverlay)
+		if err != nil {
+			fmt.Printf("Warning: host -> overlay tests failed: %v\n", err)
+		}
+		allEvents = append(allEvents, events...)
+
+		if ctx.Err() == nil {
+			fmt.Println("\n--- Overlay -> Host Tests ---")
+			events, err := runStandardTests(ctx, coord, base, hostTargets, overlayPods, crossNetworkChecks, timeout, types.NetworkTypeOverlayToHost)
+			if err != nil {
+				fmt.Printf("Warning: overlay -> host tests failed: %v\n", err)
+			}
+			allEvents = append(allEvents, events...)
+		}
+	}
+
+	if bandwidthRequested && ctx.Err() == nil {
 		fmt.Println("\nRunning bandwidth tests...")
 
 		if hostNetwork {
 			fmt.Println("\n--- Host Network Bandwidth ---")
-			events, err := runBandwidthTests(ctx, coord, hostTargets, hostPods, timeout, quiet, iperfArgs)
+			events, err := runBandwidthTests(ctx, coord, hostTargets, hostPods, checkTimeouts, timeout, quiet, iperfArgs, udpBitrate, types.NetworkTypeHost)
 			if err != nil {
 				fmt.Printf("Warning: host bandwidth tests failed: %v\n", err)
 			}
 			allEvents = append(allEvents, events...)
 		}
 
-		if overlay {
+		if overlay && ctx.Err() == nil {
 			fmt.Println("\n--- Overlay Network Bandwidth ---")
-			events, err := runBandwidthTests(ctx, coord, overlayTargets, overlayPods, timeout, quiet, iperfArgs)
+			events, err := runBandwidthTests(ctx, coord, overlayTargets, overlayPods, checkTimeouts, timeout, quiet, iperfArgs, udpBitrate, types.NetworkTypeOverlay)
 			if err != nil {
 				fmt.Printf("Warning: overlay bandwidth tests failed: %v\n", err)
 			}
@@ -182,7 +406,8 @@ func runTests(cmd *cobra.Command, args []string) error {
 
 	if cleanup {
 		fmt.Println("\nCleaning up...")
-		if err := k8s.Uninstall(ctx, dynamicClient, namespace); err != nil {
+		// The run context may have been interrupted; cleanup should still happen
+		if err := k8s.Uninstall(context.Background(), dynamicClient, namespace); err != nil {
 			fmt.Printf("Warning: cleanup failed: %v\n", err)
 		} else {
 			fmt.Println("Resources cleaned up")
@@ -200,48 +425,106 @@ func runTests(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func runStandardTests(ctx context.Context, coord *coordinator.Coordinator, targets []types.TargetNode, pods []types.TargetNode, checks []string, timeout time.Duration, quiet bool, networkType types.NetworkType) ([]*types.Event, error) {
+func attachRun(ctx context.Context, runID, namespace string, timeout time.Duration, outputFormat string, quiet bool) error {
+	clientset, err := k8s.GetClientset()
+	if err != nil {
+		return fmt.Errorf("failed to create k8s client: %w", err)
+	}
+
+	dynamicClient, err := k8s.GetDynamicClient()
+	if err != nil {
+		return fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	coord := coordinator.NewCoordinator(clientset, dynamicClient, namespace, "netdebug-config")
+
+	fmt.Printf("Attaching to run %s...\n", runID)
+
+	events, err := coord.Attach(ctx, runID, timeout)
+	if err != nil {
+		if len(events) == 0 {
+			return err
+		}
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	fmt.Println("\n" + strings.Repeat("=", 80))
+	fmt.Println("Test Results")
+	fmt.Println(strings.Repeat("=", 80) + "\n")
+
+	if err := output.FormatEvents(events, outputFormat, quiet); err != nil {
+		return fmt.Errorf("failed to format output: %w", err)
+	}
+
+	return nil
+}
+
+// defaultDNSNames returns the default dns check queries, expecting the
+// kubernetes Service name to resolve to its ClusterIP when it can be read.
+func defaultDNSNames(ctx context.Context, clientset *kubernetes.Clientset) []string {
+	ip, err := k8s.GetKubernetesServiceIP(ctx, clientset)
+	if err != nil {
+		fmt.Printf("Warning: not checking the kubernetes Service DNS answer: %v\n", err)
+		return checkspkg.DefaultDNSNames
+	}
+
+	names := make([]string, 0, len(checkspkg.DefaultDNSNames))
+	for _, name := range checkspkg.DefaultDNSNames {
+		if name == k8s.KubernetesServiceDNSName {
+			name += "=" + ip
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// runStandardTests runs checks from pods against targets. base carries the
+// settings shared by every run of the invocation, such as ports and timeouts.
+func runStandardTests(ctx context.Context, coord *coordinator.Coordinator, base types.Config, targets []types.TargetNode, pods []types.TargetNode, checks []string, timeout time.Duration, networkType types.NetworkType) ([]*types.Event, error) {
 	testCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	runID := coordinator.GenerateRunID()
 
-	config := &types.Config{
-		RunID:       runID,
-		TriggeredAt: time.Now(),
-		NetworkType: networkType,
-		Targets:     targets,
-		Checks:      checks,
-		Ports:       types.DefaultPorts(),
-		DNSNames:    checkspkg.DefaultDNSNames,
-		Timeout:     5,
-		Quiet:       quiet,
-	}
+	config := &base
+	config.RunID = runID
+	config.TriggeredAt = time.Now()
+	config.NetworkType = networkType
+	config.Targets = targets
+	config.Checks = checks
 
 	podNames := make([]string, len(pods))
 	for i, pod := range pods {
 		podNames[i] = pod.PodName
 	}
 
-	fmt.Printf("Starting test run %s with %d pods...\n", runID[:8], len(podNames))
+	fmt.Printf("Starting test run %s with %d pods...\n", runID, len(podNames))
 
 	events, err := coord.RunTests(testCtx, config, podNames, timeout)
 	if err != nil {
-		return nil, err
+		// Still hand back what was collected, including incomplete results
+		return events, err
 	}
 
 	fmt.Printf("Test run completed (%d events collected)\n", len(events))
 	return events, nil
 }
 
-func runBandwidthTests(ctx context.Context, coord *coordinator.Coordinator, targets []types.TargetNode, pods []types.TargetNode, timeout time.Duration, quiet bool, iperfArgs string) ([]*types.Event, error) {
+func runBandwidthTests(ctx context.Context, coord *coordinator.Coordinator, targets []types.TargetNode, pods []types.TargetNode, checkTimeouts map[string]int, timeout time.Duration, quiet bool, iperfArgs, udpBitrate string, networkType types.NetworkType) ([]*types.Event, error) {
 	pairs := coordinator.GenerateBandwidthPairs(targets)
 
-	fmt.Printf("Running %d bandwidth tests (sequential)...\n", len(pairs))
+	// Pairs are sequenced here rather than by the agents, so unlike the other
+	// checks they stop when the CLI goes away and can't be reattached
+	fmt.Printf("Running %d bandwidth tests (sequential, stops if this CLI disconnects)...\n", len(pairs))
 
 	allEvents := []*types.Event{}
 
 	for idx, pair := range pairs {
+		if ctx.Err() != nil {
+			fmt.Println("Interrupted, skipping remaining bandwidth tests")
+			break
+		}
+
 		testCtx, cancel := context.WithCancel(ctx)
 
 		source := pair[0]
@@ -254,6 +537,7 @@ func runBandwidthTests(ctx context.Context, coord *coordinator.Coordinator, targ
 		config := &types.Config{
 			RunID:       runID,
 			TriggeredAt: time.Now(),
+			NetworkType: networkType,
 			Targets:     []types.TargetNode{target},
 			Checks:      []string{},
 			BandwidthTest: &types.BandwidthTest{
@@ -263,9 +547,10 @@ func runBandwidthTests(ctx context.Context, coord *coordinator.Coordinator, targ
 				TargetNode: target.NodeName,
 				TargetIP:   target.IP,
 				IperfArgs:  iperfArgs,
+				UDPBitrate: udpBitrate,
 			},
-			Timeout: 5,
-			Quiet:   quiet,
+			CheckTimeouts: checkTimeouts,
+			Quiet:         quiet,
 		}
 
 		podNames := []string{source.PodName}
@@ -273,12 +558,12 @@ func runBandwidthTests(ctx context.Context, coord *coordinator.Coordinator, targ
 		events, err := coord.RunTests(testCtx, config, podNames, timeout)
 		cancel()
 
+		allEvents = append(allEvents, events...)
 		if err != nil {
 			fmt.Printf("Failed: %v\n", err)
 			continue
 		}
 
-		allEvents = append(allEvents, events...)
 		fmt.Println("Done")
 
 		time.Sleep(2 * time.Second)
@@ -288,6 +573,50 @@ func runBandwidthTests(ctx context.Context, coord *coordinator.Coordinator, targ
 	return allEvents, nil
 }
 
+// validateCNI checks a --cni value: auto, none or a CNI port profile name.
+func validateCNI(cni string) error {
+	if _, ok := types.CNIPortProfiles[cni]; ok || cni == "auto" || cni == types.CNINone {
+		return nil
+	}
+	return fmt.Errorf("invalid --cni %q (must be auto, none or one of %s)", cni, strings.Join(types.CNIProfileNames(), ", "))
+}
+
+// resolveCNI turns the --cni value into the port profile to use. For auto it
+// looks for a known CNI DaemonSet or flannel's node annotation, and returns ""
+// when there is neither so each host agent detects the CNI from its own
+// config.
+func resolveCNI(ctx context.Context, clientset *kubernetes.Clientset, cni string) string {
+	if cni != "auto" {
+		return cni
+	}
+
+	detected, err := k8s.DetectCNI(ctx, clientset)
+	if err != nil {
+		fmt.Printf("Warning: failed to detect CNI: %v\n", err)
+	}
+	if detected != "" {
+		fmt.Printf("Detected CNI: %s\n", detected)
+	} else {
+		fmt.Println("No CNI DaemonSet found, host agents will detect the CNI from /etc/cni/net.d")
+	}
+	return detected
+}
+
+// parseCheckTimeouts parses --check-timeout and rejects checks the registry
+// doesn't know about.
+func parseCheckTimeouts(specs []string) (map[string]int, error) {
+	timeouts, err := types.ParseCheckTimeouts(specs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --check-timeout: %w", err)
+	}
+	for name := range timeouts {
+		if types.DefaultRegistry.Get(name) == nil {
+			return nil, fmt.Errorf("invalid --check-timeout: unknown check: %s", name)
+		}
+	}
+	return timeouts, nil
+}
+
 func filterHostNetworkOnlyChecks(checks []string) []string {
 	var filtered []string
 	for _, name := range checks {
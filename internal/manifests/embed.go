@@ -8,8 +8,17 @@ var RBACYAML string
 //go:embed configmap.yaml
 var ConfigMapYAML string
 
+//go:embed secret.yaml
+var SecretYAML string
+
 //go:embed daemonset-host.yaml
 var DaemonSetHostYAML string
 
 //go:embed daemonset-overlay.yaml
 var DaemonSetOverlayYAML string
+
+//go:embed service.yaml
+var ServiceYAML string
+
+//go:embed crds.yaml
+var CRDsYAML string
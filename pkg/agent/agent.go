@@ -5,12 +5,37 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
+	"github.com/ryanelliottsmith/network-debugger/pkg/k8s"
+	"github.com/ryanelliottsmith/network-debugger/pkg/metrics"
 	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
-func Run(ctx context.Context, mode, configRef string) error {
-	log.Printf("Starting agent in %s mode", mode)
+// Options configures a DaemonSet agent.
+type Options struct {
+	Mode      string
+	ConfigRef string
+
+	// ListenAddr is the address of the agent's HTTP server. Empty disables it.
+	ListenAddr string
+
+	// HealthAddr is the address serving only /healthz and /readyz, for the
+	// kubelet's probes. Empty disables it.
+	HealthAddr string
+
+	// TokenFile holds the shared token required by the HTTP control API.
+	TokenFile string
+
+	// MonitorInterval re-runs MonitorChecks against all peers on this interval
+	// and exposes the results on /metrics. Zero disables monitoring.
+	MonitorInterval time.Duration
+	MonitorChecks   []string
+}
+
+func Run(ctx context.Context, opts Options) error {
+	log.Printf("Starting agent in %s mode", opts.Mode)
 
 	self, err := GetSelfInfo()
 	if err != nil {
@@ -20,47 +45,161 @@ func Run(ctx context.Context, mode, configRef string) error {
 	log.Printf("Agent info: node=%s, pod=%s, podIP=%s, hostIP=%s",
 		self.NodeName, self.PodName, self.PodIP, self.HostIP)
 
-	if err := StartIperf3Server(ctx); err != nil {
+	health := NewHealth()
+	log.Printf("Capabilities: %v", health.Status().Capabilities)
+
+	if err := StartIperf3Server(ctx, health); err != nil {
 		log.Printf("WARNING: Failed to start iperf3 server: %v", err)
 		log.Printf("Bandwidth tests will be skipped on this node")
 	} else {
 		log.Printf("iperf3 server started successfully")
 	}
 
-	if mode == "configmap" {
-		return runConfigMapMode(ctx, self, configRef)
+	if opts.Mode != "configmap" {
+		return fmt.Errorf("unknown agent mode: %s", opts.Mode)
 	}
 
-	return fmt.Errorf("direct mode not yet implemented")
-}
-
-func runConfigMapMode(ctx context.Context, self *SelfInfo, configRef string) error {
-	log.Printf("Starting ConfigMap watch mode")
-
-	namespace, configMapName, err := parseConfigRef(configRef)
+	namespace, configMapName, err := parseConfigRef(opts.ConfigRef)
 	if err != nil {
 		return fmt.Errorf("invalid config reference: %w", err)
 	}
 
+	recorder := metrics.NewRecorder()
+	tracker := newRunTracker()
+
+	if opts.HealthAddr != "" {
+		go serveHTTP(ctx, opts.HealthAddr, health.handler())
+	}
+
+	if opts.ListenAddr != "" {
+		tokenFile := opts.TokenFile
+		if tokenFile == "" {
+			tokenFile = DefaultTokenFile
+		}
+
+		server := &apiServer{
+			self:      self,
+			tracker:   tracker,
+			tokenFile: tokenFile,
+			recorder:  recorder,
+			health:    health,
+		}
+		go serveHTTP(ctx, opts.ListenAddr, server.handler())
+	}
+
+	if opts.MonitorInterval > 0 {
+		go runMonitor(ctx, self, namespace, opts.MonitorChecks, opts.MonitorInterval, recorder)
+	}
+
+	go runCRDMode(ctx, self, namespace, tracker)
+
+	return runConfigMapMode(ctx, self, namespace, configMapName, tracker, health)
+}
+
+func runConfigMapMode(ctx context.Context, self *SelfInfo, namespace, configMapName string, tracker *runTracker, health *Health) error {
+	log.Printf("Starting ConfigMap watch mode")
+
 	log.Printf("Watching ConfigMap: %s/%s", namespace, configMapName)
 
-	return WatchConfigMap(ctx, namespace, configMapName, func(config *types.Config) error {
+	emitter := NewStdoutEmitter(self)
+
+	return WatchConfigMap(ctx, namespace, configMapName, health, func(config *types.Config) error {
+		if config.Cancelled {
+			if tracker.cancel(config.RunID) {
+				log.Printf("Cancelling run: %s", config.RunID)
+			}
+			return nil
+		}
+
+		runCtx, ok := tracker.start(ctx, config.RunID)
+		if !ok {
+			log.Printf("Run %s already started, ignoring", config.RunID)
+			return nil
+		}
+
 		log.Printf("Handling new run: %s", config.RunID)
 
-		if err := RunTests(ctx, config, self); err != nil {
-			log.Printf("Error running tests: %v", err)
+		// Run in the background so the watch keeps going and can deliver a cancellation
+		go func() {
+			defer tracker.finish(config.RunID)
 
-			if emitErr := EmitError(self, config.RunID, err.Error()); emitErr != nil {
-				log.Printf("Failed to emit error event: %v", emitErr)
+			if !tracker.acquire(runCtx, config.RunID) {
+				if err := emitter.Cancelled(config.RunID); err != nil {
+					log.Printf("Failed to emit cancelled event: %v", err)
+				}
+				return
 			}
+			defer tracker.release()
 
-			return err
-		}
+			if err := RunTests(runCtx, config, self, emitter); err != nil {
+				log.Printf("Error running tests: %v", err)
+
+				if emitErr := emitter.Error(config.RunID, err.Error()); emitErr != nil {
+					log.Printf("Failed to emit error event: %v", emitErr)
+				}
+			}
+		}()
 
 		return nil
 	})
 }
 
+// runCRDMode picks up NetdebugRuns and records their results in NetdebugResults.
+func runCRDMode(ctx context.Context, self *SelfInfo, namespace string, tracker *runTracker) {
+	dynamicClient, err := k8s.GetDynamicClient()
+	if err != nil {
+		log.Printf("NetdebugRun watch disabled: %v", err)
+		return
+	}
+
+	err = WatchRuns(ctx, dynamicClient, namespace, self.PodName, func(run *unstructured.Unstructured, spec *types.NetdebugRunSpec) {
+		config := &spec.Config
+		if config.Cancelled {
+			if tracker.cancel(config.RunID) {
+				log.Printf("Cancelling run: %s", config.RunID)
+			}
+			return
+		}
+
+		runCtx, ok := tracker.start(ctx, config.RunID)
+		if !ok {
+			return
+		}
+
+		log.Printf("Handling new run via NetdebugRun: %s", config.RunID)
+
+		writer, err := newResultWriter(ctx, dynamicClient, run, self, config.NetworkType)
+		if err != nil {
+			tracker.finish(config.RunID)
+			log.Printf("Failed to record run %s: %v", config.RunID, err)
+			return
+		}
+
+		go func() {
+			defer tracker.finish(config.RunID)
+
+			emitter := NewEmitter(self, writer.write)
+			if !tracker.acquire(runCtx, config.RunID) {
+				if err := emitter.Cancelled(config.RunID); err != nil {
+					log.Printf("Failed to record cancelled run: %v", err)
+				}
+				return
+			}
+			defer tracker.release()
+
+			if err := RunTests(runCtx, config, self, emitter); err != nil {
+				log.Printf("Error running tests: %v", err)
+				if failErr := writer.fail(err.Error()); failErr != nil {
+					log.Printf("Failed to record run error: %v", failErr)
+				}
+			}
+		}()
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("NetdebugRun watch stopped: %v", err)
+	}
+}
+
 func parseConfigRef(configRef string) (namespace, name string, err error) {
 	parts := strings.Split(configRef, "/")
 	if len(parts) != 2 {
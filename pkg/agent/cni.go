@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"log"
+	"os"
+	"sort"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+// cniConfDirs are searched in order for CNI config files. The host agent runs
+// with hostPID, so the host's filesystem is reachable through /proc/1/root.
+// K3s and RKE2 keep theirs under /var/lib/rancher.
+var cniConfDirs = []string{
+	"/proc/1/root/etc/cni/net.d",
+	"/proc/1/root/var/lib/rancher/k3s/agent/etc/cni/net.d",
+	"/etc/cni/net.d",
+}
+
+// flannelWireguardDevices are created by flannel's WireGuard backend in the
+// host network namespace, which the host agent shares.
+var flannelWireguardDevices = []string{"/sys/class/net/flannel-wg", "/sys/class/net/flannel-wg-v6"}
+
+// detectHostCNI returns the port profile of the CNI configured on this host.
+// Like the container runtime, it goes by the first config file in lexical
+// order that names a known CNI. Flannel's config doesn't name its backend, so
+// the WireGuard backend is told from its devices.
+func detectHostCNI() string {
+	cni := detectHostCNIConfig()
+	if cni != "flannel" {
+		return cni
+	}
+	for _, device := range flannelWireguardDevices {
+		if _, err := os.Stat(device); err == nil {
+			return types.FlannelProfile(types.FlannelBackendWireguard)
+		}
+	}
+	return cni
+}
+
+// detectHostCNIConfig returns the port profile of the first CNI config file
+// naming a known CNI.
+func detectHostCNIConfig() string {
+	for _, dir := range cniConfDirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if cni := types.CNIFromName(name); cni != "" {
+				return cni
+			}
+		}
+	}
+	return ""
+}
+
+// withHostCNIPorts returns config with the port profile of the host's CNI
+// merged into its ports, when the coordinator left the CNI to the agents and
+// this agent can see the host's CNI config.
+func withHostCNIPorts(config *types.Config) *types.Config {
+	if config.CNI != "" || config.NetworkType == types.NetworkTypeOverlay {
+		return config
+	}
+
+	cni := detectHostCNI()
+	if cni == "" {
+		return config
+	}
+	log.Printf("Detected CNI %s from host config, adding its ports", cni)
+
+	ports := config.Ports
+	if len(ports) == 0 {
+		ports = types.DefaultPorts()
+	}
+
+	withPorts := *config
+	withPorts.CNI = cni
+	withPorts.Ports = types.MergePorts(ports, types.CNIPortProfiles[cni])
+	return &withPorts
+}
@@ -14,7 +14,9 @@ import (
 	"k8s.io/client-go/rest"
 )
 
-func WatchConfigMap(ctx context.Context, namespace, configMapName string, handler func(*types.Config) error) error {
+// WatchConfigMap calls handler for every new or cancelled run written to the
+// ConfigMap, and reports to health whether the watch is established.
+func WatchConfigMap(ctx context.Context, namespace, configMapName string, health *Health, handler func(*types.Config) error) error {
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		return fmt.Errorf("failed to get in-cluster config: %w", err)
@@ -26,6 +28,7 @@ func WatchConfigMap(ctx context.Context, namespace, configMapName string, handle
 	}
 
 	var lastRunID string
+	var lastCancelled bool
 
 	for {
 		select {
@@ -38,10 +41,14 @@ func WatchConfigMap(ctx context.Context, namespace, configMapName string, handle
 			FieldSelector: fmt.Sprintf("metadata.name=%s", configMapName),
 		})
 		if err != nil {
+			health.SetConfigWatch(false, err)
 			log.Printf("Failed to watch ConfigMap: %v, retrying in 5s...", err)
 			time.Sleep(5 * time.Second)
 			continue
 		}
+		// Left set while reconnecting after the server closes the watch,
+		// which happens routinely and shouldn't flap readiness.
+		health.SetConfigWatch(true, nil)
 
 		for event := range watcher.ResultChan() {
 			if event.Type == watch.Added || event.Type == watch.Modified {
@@ -63,9 +70,12 @@ func WatchConfigMap(ctx context.Context, namespace, configMapName string, handle
 					continue
 				}
 
-				if config.RunID != "" && config.RunID != lastRunID {
-					log.Printf("New run detected: %s", config.RunID)
+				if config.RunID != "" && (config.RunID != lastRunID || config.Cancelled != lastCancelled) {
+					if config.RunID != lastRunID {
+						log.Printf("New run detected: %s", config.RunID)
+					}
 					lastRunID = config.RunID
+					lastCancelled = config.Cancelled
 
 					if err := handler(&config); err != nil {
 						log.Printf("Handler error: %v", err)
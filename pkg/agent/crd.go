@@ -0,0 +1,282 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/k8s"
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// staleRunAge is how old a NetdebugRun can be and still be picked up.
+	// Older runs are history, which a freshly started agent must not replay.
+	staleRunAge = 10 * time.Minute
+
+	// resultFlushInterval is the least time between two writes of test
+	// results, so a run makes a few updates of its NetdebugResult rather than
+	// one per result.
+	resultFlushInterval = 2 * time.Second
+
+	// maxStoredResults caps the results in one NetdebugResult, keeping it well
+	// below etcd's object size limit.
+	maxStoredResults = 500
+)
+
+// WatchRuns watches NetdebugRuns in the namespace and calls handler whenever a
+// recent run addressed to this pod is created or changed, e.g. cancelled. The
+// handler must not block. It keeps retrying while the CRDs are not installed.
+func WatchRuns(ctx context.Context, dynamicClient dynamic.Interface, namespace, podName string, handler func(run *unstructured.Unstructured, spec *types.NetdebugRunSpec)) error {
+	runs := dynamicClient.Resource(k8s.NetdebugRunGVR).Namespace(namespace)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		watcher, err := runs.Watch(ctx, metav1.ListOptions{})
+		if err != nil {
+			log.Printf("Failed to watch NetdebugRuns: %v, retrying in 30s...", err)
+			time.Sleep(30 * time.Second)
+			continue
+		}
+
+		for event := range watcher.ResultChan() {
+			if event.Type != watch.Added && event.Type != watch.Modified {
+				continue
+			}
+
+			run, ok := event.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+
+			if time.Since(run.GetCreationTimestamp().Time) > staleRunAge {
+				continue
+			}
+
+			var spec types.NetdebugRunSpec
+			if err := k8s.FromUnstructuredField(run, "spec", &spec); err != nil {
+				log.Printf("Failed to parse NetdebugRun %s: %v", run.GetName(), err)
+				continue
+			}
+
+			if spec.Config.RunID == "" {
+				spec.Config.RunID = run.GetName()
+			}
+
+			if len(spec.Pods) > 0 && !slices.Contains(spec.Pods, podName) {
+				continue
+			}
+
+			handler(run, &spec)
+		}
+
+		log.Printf("NetdebugRun watch closed, reconnecting in 2s...")
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// resultWriter records a run's events in this pod's NetdebugResult.
+type resultWriter struct {
+	client  dynamic.ResourceInterface
+	network string
+
+	mu     sync.Mutex
+	obj    *unstructured.Unstructured
+	status types.NetdebugResultStatus
+
+	// pending is set while results are waiting for the next write, which
+	// flushTimer makes at the latest.
+	pending    bool
+	lastUpdate time.Time
+	flushTimer *time.Timer
+	dropped    int
+}
+
+// newResultWriter creates the NetdebugResult for this pod, owned by the run so
+// deleting the run deletes its results.
+func newResultWriter(ctx context.Context, dynamicClient dynamic.Interface, run *unstructured.Unstructured, self *SelfInfo, network types.NetworkType) (*resultWriter, error) {
+	client := dynamicClient.Resource(k8s.NetdebugResultGVR).Namespace(run.GetNamespace())
+
+	runID := run.GetName()
+	spec, err := k8s.ToUnstructuredContent(types.NetdebugResultSpec{
+		RunID:   runID,
+		Node:    self.NodeName,
+		Pod:     self.PodName,
+		Network: string(network),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(k8s.CRDGroup + "/" + k8s.CRDVersion)
+	obj.SetKind("NetdebugResult")
+	obj.SetName(k8s.ResultName(runID, self.PodName))
+	obj.SetLabels(map[string]string{
+		k8s.LabelRunID: runID,
+		k8s.LabelNode:  self.NodeName,
+	})
+	obj.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: run.GetAPIVersion(),
+		Kind:       run.GetKind(),
+		Name:       run.GetName(),
+		UID:        run.GetUID(),
+	}})
+	obj.Object["spec"] = spec
+
+	created, err := client.Create(ctx, obj, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create NetdebugResult: %w", err)
+	}
+
+	return &resultWriter{
+		client:  client,
+		network: string(network),
+		obj:     created,
+	}, nil
+}
+
+// write is an Emitter sink. Test starts are not recorded, and test results
+// are batched; every other event is written right away along with them.
+func (w *resultWriter) write(event *types.Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch event.Type {
+	case types.EventTypeReady:
+		w.status.SetCondition(types.ConditionReady, "True", "AgentReady", "")
+	case types.EventTypeTestResult:
+		if len(w.status.Results) >= maxStoredResults {
+			w.dropped++
+			if w.dropped > 1 {
+				return nil
+			}
+			w.status.Errors = append(w.status.Errors, fmt.Sprintf("results beyond the first %d were not recorded", maxStoredResults))
+			break
+		}
+		result := resultFromEvent(event)
+		if result.Network == "" {
+			result.Network = w.network
+		}
+		w.status.Results = append(w.status.Results, result)
+		return w.updateSoon()
+	case types.EventTypeComplete:
+		w.status.Summary = event.Details
+		w.status.SetCondition(types.ConditionComplete, "True", "RunComplete", "")
+	case types.EventTypeCancelled:
+		w.status.SetCondition(types.ConditionComplete, "True", types.ReasonCancelled, "")
+	case types.EventTypeError:
+		w.status.Errors = append(w.status.Errors, event.Error)
+	default:
+		return nil
+	}
+
+	return w.update()
+}
+
+// fail records a run that could not finish and marks it complete so the
+// coordinator stops waiting on this pod.
+func (w *resultWriter) fail(errMsg string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.status.Errors = append(w.status.Errors, errMsg)
+	w.status.SetCondition(types.ConditionComplete, "True", "RunFailed", errMsg)
+	return w.update()
+}
+
+// updateSoon writes the results now if the last write is at least
+// resultFlushInterval ago, and otherwise leaves it to flush.
+func (w *resultWriter) updateSoon() error {
+	w.pending = true
+	wait := resultFlushInterval - time.Since(w.lastUpdate)
+	if wait <= 0 {
+		return w.update()
+	}
+	if w.flushTimer == nil {
+		w.flushTimer = time.AfterFunc(wait, w.flush)
+	}
+	return nil
+}
+
+// flush writes the results still pending.
+func (w *resultWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.flushTimer = nil
+	if !w.pending {
+		return
+	}
+	if err := w.update(); err != nil {
+		log.Printf("Failed to record results: %v", err)
+	}
+}
+
+func (w *resultWriter) update() error {
+	status, err := k8s.ToUnstructuredContent(w.status)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for attempt := 0; ; attempt++ {
+		w.obj.Object["status"] = status
+
+		updated, err := w.client.Update(ctx, w.obj, metav1.UpdateOptions{})
+		if err == nil {
+			w.obj = updated
+			w.pending = false
+			w.lastUpdate = time.Now()
+			return nil
+		}
+
+		if !apierrors.IsConflict(err) || attempt >= 2 {
+			return fmt.Errorf("failed to update NetdebugResult: %w", err)
+		}
+
+		latest, getErr := w.client.Get(ctx, w.obj.GetName(), metav1.GetOptions{})
+		if getErr != nil {
+			return fmt.Errorf("failed to update NetdebugResult: %w", getErr)
+		}
+		w.obj = latest
+	}
+}
+
+func resultFromEvent(event *types.Event) types.TestResult {
+	status := types.StatusPass
+	switch event.Status {
+	case "fail":
+		status = types.StatusFail
+	case "warn":
+		status = types.StatusWarn
+	}
+
+	details, _ := event.Details.(map[string]interface{})
+
+	return types.TestResult{
+		Node:    event.Node,
+		Network: event.Network,
+		Check:   event.Check,
+		Target:  event.Target,
+		Status:  status,
+		Error:   event.Error,
+		Details: details,
+		EndTime: event.Timestamp,
+	}
+}
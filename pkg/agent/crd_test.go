@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/k8s"
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newTestResultWriter(t *testing.T) (*resultWriter, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		k8s.NetdebugRunGVR:    "NetdebugRunList",
+		k8s.NetdebugResultGVR: "NetdebugResultList",
+	})
+
+	run := &unstructured.Unstructured{}
+	run.SetAPIVersion(k8s.CRDGroup + "/" + k8s.CRDVersion)
+	run.SetKind("NetdebugRun")
+	run.SetName("run-1")
+	run.SetNamespace("netdebug")
+
+	writer, err := newResultWriter(context.Background(), client, run, &SelfInfo{NodeName: "node-a", PodName: "netdebug-host-a"}, types.NetworkTypeHost)
+	if err != nil {
+		t.Fatalf("newResultWriter: %v", err)
+	}
+	return writer, client
+}
+
+func countUpdates(client *dynamicfake.FakeDynamicClient) int {
+	updates := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" {
+			updates++
+		}
+	}
+	return updates
+}
+
+func storedStatus(t *testing.T, client *dynamicfake.FakeDynamicClient) types.NetdebugResultStatus {
+	t.Helper()
+
+	obj, err := client.Resource(k8s.NetdebugResultGVR).Namespace("netdebug").Get(context.Background(), k8s.ResultName("run-1", "netdebug-host-a"), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status types.NetdebugResultStatus
+	if err := k8s.FromUnstructuredField(obj, "status", &status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func resultEvent(target string) *types.Event {
+	return types.TestResultEvent("node-a", "host", "netdebug-host-a", "ping", target, "pass", nil, "run-1")
+}
+
+func TestResultWriter_BatchesResults(t *testing.T) {
+	writer, client := newTestResultWriter(t)
+
+	if err := writer.write(types.ReadyEvent("node-a", "host", "netdebug-host-a", "run-1")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if err := writer.write(resultEvent(fmt.Sprintf("10.0.0.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := countUpdates(client); got != 1 {
+		t.Errorf("%d updates for ready and 50 results in a burst, want 1", got)
+	}
+
+	// The pending results are written once the interval is up
+	time.Sleep(resultFlushInterval + 500*time.Millisecond)
+	if got := len(storedStatus(t, client).Results); got != 50 {
+		t.Errorf("%d results stored after the flush, want 50", got)
+	}
+
+	if err := writer.write(resultEvent("10.0.0.50")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.write(types.CompleteEvent("node-a", "host", "netdebug-host-a", nil, "run-1")); err != nil {
+		t.Fatal(err)
+	}
+	status := storedStatus(t, client)
+	if len(status.Results) != 51 || !status.IsConditionTrue(types.ConditionComplete) {
+		t.Errorf("after completing: %d results, complete %v, want 51 and complete", len(status.Results), status.IsConditionTrue(types.ConditionComplete))
+	}
+	if got := countUpdates(client); got > 4 {
+		t.Errorf("%d updates in total, want at most 4", got)
+	}
+}
+
+func TestResultWriter_CapsResults(t *testing.T) {
+	writer, client := newTestResultWriter(t)
+
+	for i := 0; i < maxStoredResults+10; i++ {
+		if err := writer.write(resultEvent(fmt.Sprintf("target-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.write(types.CompleteEvent("node-a", "host", "netdebug-host-a", nil, "run-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	status := storedStatus(t, client)
+	if len(status.Results) != maxStoredResults {
+		t.Errorf("%d results stored, want %d", len(status.Results), maxStoredResults)
+	}
+	if len(status.Errors) != 1 {
+		t.Errorf("errors = %q, want one about the dropped results", status.Errors)
+	}
+}
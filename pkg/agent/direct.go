@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanelliottsmith/network-debugger/pkg/checks"
+	"github.com/ryanelliottsmith/network-debugger/pkg/output"
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+// DefaultDirectChecks are the checks run in direct mode when none are given.
+// Bandwidth and ports are left out since they need something listening on the
+// other end.
+var DefaultDirectChecks = []string{"ping", "hostconfig", "conntrack", "dns"}
+
+// DirectOptions configures a standalone agent run.
+type DirectOptions struct {
+	Checks  []string
+	Targets []string
+	// ControlPlane are the targets that are control plane nodes. The ports
+	// check only tests the control plane ports (apiserver, supervisor, etcd)
+	// on these.
+	ControlPlane []string
+	// Ports are the ports check's ports. Empty uses types.DefaultPorts.
+	Ports []types.PortCheck
+	// DNSNames are the dns check's queries. Empty uses checks.DefaultDNSNames.
+	DNSNames []string
+	// DNSTransport repeats every DNS lookup over each transport.
+	DNSTransport bool
+	// DNSBurst is how many query pairs the dns check sends per name.
+	DNSBurst int
+	// CNI names the CNI port profile to add to Ports. Empty detects it from
+	// the host's CNI config and types.CNINone adds none.
+	CNI string
+	// CheckTimeouts overrides per-check timeouts, in seconds, by check name.
+	CheckTimeouts map[string]int
+	// UDPBitrate runs bandwidth checks over UDP at this iperf3 target bitrate.
+	UDPBitrate  string
+	NetworkType types.NetworkType
+	Output      string
+	Quiet       bool
+}
+
+// RunDirect runs checks once from this machine against the given targets and
+// prints the results. It needs no ConfigMap, DaemonSet or cluster access, so it
+// works from `docker run` on a node that hasn't joined the cluster yet.
+func RunDirect(ctx context.Context, opts DirectOptions) error {
+	checkNames := opts.Checks
+	if len(checkNames) == 0 {
+		checkNames = DefaultDirectChecks
+	}
+
+	networkType := opts.NetworkType
+	if networkType == "" {
+		networkType = types.NetworkTypeHost
+	}
+
+	var selected []string
+	bandwidthRequested := false
+	for _, name := range checkNames {
+		check := types.DefaultRegistry.Get(name)
+		if check == nil {
+			return fmt.Errorf("unknown check: %s", name)
+		}
+		if networkType == types.NetworkTypeOverlay && check.HostNetworkOnly() {
+			log.Printf("Skipping %s: requires the host network", name)
+			continue
+		}
+		if !check.IsLocal() && len(opts.Targets) == 0 {
+			log.Printf("Skipping %s: no targets given", name)
+			continue
+		}
+		if name == "bandwidth" {
+			bandwidthRequested = true
+			continue
+		}
+		selected = append(selected, name)
+	}
+
+	self := GetStandaloneSelfInfo()
+	log.Printf("Running standalone checks on %s: %v", self.NodeName, checkNames)
+
+	for _, name := range opts.ControlPlane {
+		if !slices.Contains(opts.Targets, name) {
+			return fmt.Errorf("control plane node %s is not a target", name)
+		}
+	}
+
+	targets := make([]types.TargetNode, 0, len(opts.Targets))
+	for _, target := range opts.Targets {
+		targets = append(targets, types.TargetNode{
+			NodeName:       target,
+			IP:             target,
+			IsControlPlane: slices.Contains(opts.ControlPlane, target),
+		})
+	}
+
+	ports := opts.Ports
+	if len(ports) == 0 {
+		ports = types.DefaultPorts()
+	}
+	if profile, ok := types.CNIPortProfiles[opts.CNI]; ok {
+		ports = types.MergePorts(ports, profile)
+	}
+
+	dnsNames := opts.DNSNames
+	if len(dnsNames) == 0 {
+		dnsNames = checks.DefaultDNSNames
+	}
+
+	config := &types.Config{
+		RunID:         uuid.New().String(),
+		TriggeredAt:   time.Now(),
+		NetworkType:   networkType,
+		Targets:       targets,
+		Checks:        selected,
+		Ports:         ports,
+		CNI:           opts.CNI,
+		DNSNames:      dnsNames,
+		DNSTransport:  opts.DNSTransport,
+		DNSBurst:      opts.DNSBurst,
+		CheckTimeouts: opts.CheckTimeouts,
+		Quiet:         opts.Quiet,
+	}
+
+	collector := &eventCollector{}
+	emitter := NewEmitter(self, collector.add)
+
+	if err := RunTests(ctx, config, self, emitter); err != nil {
+		return fmt.Errorf("failed to run checks: %w", err)
+	}
+
+	if bandwidthRequested {
+		for _, target := range targets {
+			runBandwidthTest(ctx, &types.BandwidthTest{
+				Active:     true,
+				SourceNode: self.NodeName,
+				TargetNode: target.NodeName,
+				TargetIP:   target.IP,
+				UDPBitrate: opts.UDPBitrate,
+			}, config, self, emitter)
+		}
+	}
+
+	return output.FormatEvents(collector.events, opts.Output, opts.Quiet)
+}
+
+// eventCollector gathers events in memory for printing once the run finishes.
+type eventCollector struct {
+	mu     sync.Mutex
+	events []*types.Event
+}
+
+// add round-trips the event through JSON so its details match what the
+// coordinator would have read from pod logs, which is what the output
+// formatters expect.
+func (c *eventCollector) add(event *types.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	var decoded types.Event
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return fmt.Errorf("failed to decode event: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, &decoded)
+	return nil
+}
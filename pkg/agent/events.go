@@ -8,6 +8,25 @@ import (
 	"github.com/ryanelliottsmith/network-debugger/pkg/types"
 )
 
+// Emitter publishes events for a single agent to a sink such as stdout.
+type Emitter struct {
+	self *SelfInfo
+	sink func(*types.Event) error
+}
+
+func NewEmitter(self *SelfInfo, sink func(*types.Event) error) *Emitter {
+	return &Emitter{
+		self: self,
+		sink: sink,
+	}
+}
+
+// NewStdoutEmitter returns an Emitter that writes JSON events to stdout, where
+// the coordinator picks them up from the pod logs.
+func NewStdoutEmitter(self *SelfInfo) *Emitter {
+	return NewEmitter(self, EmitEvent)
+}
+
 func EmitEvent(event *types.Event) error {
 	encoder := json.NewEncoder(os.Stdout)
 	if err := encoder.Encode(event); err != nil {
@@ -16,26 +35,29 @@ func EmitEvent(event *types.Event) error {
 	return nil
 }
 
-func EmitReady(self *SelfInfo, runID string) error {
-	event := types.ReadyEvent(self.NodeName, "", self.PodName, runID)
-	return EmitEvent(event)
+func (e *Emitter) Ready(runID string) error {
+	event := types.ReadyEvent(e.self.NodeName, "", e.self.PodName, runID)
+	return e.sink(event)
 }
 
-func EmitTestStart(self *SelfInfo, check, target, runID string) error {
-	event := types.TestStartEvent(self.NodeName, "", self.PodName, check, target, runID)
-	return EmitEvent(event)
+func (e *Emitter) TestStart(check, target, runID string) error {
+	event := types.TestStartEvent(e.self.NodeName, "", e.self.PodName, check, target, runID)
+	return e.sink(event)
 }
 
-func EmitTestResult(self *SelfInfo, result *types.TestResult, runID string) error {
+func (e *Emitter) TestResult(result *types.TestResult, runID string) error {
 	status := "pass"
-	if result.Status == types.StatusFail {
+	switch result.Status {
+	case types.StatusFail:
 		status = "fail"
+	case types.StatusWarn:
+		status = "warn"
 	}
 
 	event := types.TestResultEvent(
-		self.NodeName,
+		e.self.NodeName,
 		"",
-		self.PodName,
+		e.self.PodName,
 		result.Check,
 		result.Target,
 		status,
@@ -47,15 +69,20 @@ func EmitTestResult(self *SelfInfo, result *types.TestResult, runID string) erro
 		event.Error = result.Error
 	}
 
-	return EmitEvent(event)
+	return e.sink(event)
+}
+
+func (e *Emitter) Complete(runID string, summary interface{}) error {
+	event := types.CompleteEvent(e.self.NodeName, "", e.self.PodName, summary, runID)
+	return e.sink(event)
 }
 
-func EmitComplete(self *SelfInfo, runID string, summary interface{}) error {
-	event := types.CompleteEvent(self.NodeName, "", self.PodName, summary, runID)
-	return EmitEvent(event)
+func (e *Emitter) Error(runID, errMsg string) error {
+	event := types.ErrorEvent(e.self.NodeName, "", e.self.PodName, errMsg, runID)
+	return e.sink(event)
 }
 
-func EmitError(self *SelfInfo, runID, errMsg string) error {
-	event := types.ErrorEvent(self.NodeName, "", self.PodName, errMsg, runID)
-	return EmitEvent(event)
+func (e *Emitter) Cancelled(runID string) error {
+	event := types.CancelledEvent(e.self.NodeName, "", e.self.PodName, runID)
+	return e.sink(event)
 }
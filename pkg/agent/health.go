@@ -0,0 +1,163 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// iperf3MaxFailures is how many times in a row the iperf3 server may fail to
+// run before the agent reports it down.
+const iperf3MaxFailures = 3
+
+// Health tracks what the agent needs to take part in a run. It backs the
+// /readyz endpoint, so a DaemonSet pod only counts as ready once it can
+// actually pick up and serve tests. A nil *Health ignores all updates.
+type Health struct {
+	mu            sync.Mutex
+	configWatch   bool
+	configErr     string
+	iperfRunning  bool
+	iperfFailures int
+	iperfErr      string
+	capabilities  map[string]bool
+}
+
+// HealthStatus is the JSON body served on /readyz.
+type HealthStatus struct {
+	Ready        bool            `json:"ready"`
+	ConfigWatch  bool            `json:"config_watch"`
+	ConfigError  string          `json:"config_error,omitempty"`
+	Iperf3Server bool            `json:"iperf3_server"`
+	Iperf3Error  string          `json:"iperf3_error,omitempty"`
+	Capabilities map[string]bool `json:"capabilities"`
+}
+
+func NewHealth() *Health {
+	return &Health{capabilities: detectCapabilities()}
+}
+
+// detectCapabilities probes what the checks need from the container: raw ICMP
+// sockets for ping, the iperf3 and iptables binaries, and the conntrack sysctls.
+func detectCapabilities() map[string]bool {
+	caps := make(map[string]bool)
+
+	conn, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
+	caps["icmp"] = err == nil
+	if err == nil {
+		conn.Close()
+	}
+
+	_, err = exec.LookPath("iperf3")
+	caps["iperf3"] = err == nil
+
+	_, err = exec.LookPath("iptables")
+	caps["iptables"] = err == nil
+
+	_, err = os.Stat("/proc/sys/net/netfilter/nf_conntrack_max")
+	caps["conntrack"] = err == nil
+
+	return caps
+}
+
+// SetConfigWatch records whether the ConfigMap watch is established.
+func (h *Health) SetConfigWatch(established bool, err error) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.configWatch = established
+	h.configErr = ""
+	if err != nil {
+		h.configErr = err.Error()
+	}
+}
+
+// SetIperf3Running records whether the iperf3 server loop is running.
+func (h *Health) SetIperf3Running(running bool) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.iperfRunning = running
+}
+
+// Iperf3Exited records the outcome of one iperf3 server instance. Failures
+// count up until an instance exits cleanly after serving a client.
+func (h *Health) Iperf3Exited(err error) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err == nil {
+		h.iperfFailures = 0
+		h.iperfErr = ""
+		return
+	}
+	h.iperfFailures++
+	h.iperfErr = err.Error()
+}
+
+// Status reports the agent's current health. The agent is ready once the
+// ConfigMap watch is established. The iperf3 server is reported but doesn't
+// affect readiness, so a broken iperf3 only fails the bandwidth check, which
+// reports the target's missing server.
+func (h *Health) Status() HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	iperfAlive := h.iperfRunning && h.iperfFailures < iperf3MaxFailures
+
+	caps := make(map[string]bool, len(h.capabilities))
+	for name, ok := range h.capabilities {
+		caps[name] = ok
+	}
+
+	return HealthStatus{
+		Ready:        h.configWatch,
+		ConfigWatch:  h.configWatch,
+		ConfigError:  h.configErr,
+		Iperf3Server: iperfAlive,
+		Iperf3Error:  h.iperfErr,
+		Capabilities: caps,
+	}
+}
+
+// handler serves /healthz and /readyz on their own, for the kubelet's probes
+// to reach whether or not the control API is enabled.
+func (h *Health) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", h.handleReadyz)
+	return mux
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz reports the agent's health and answers 503 until it is ready
+// to take part in a run.
+func (h *Health) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	status := h.Status()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Printf("Failed to write health status: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealth_Status(t *testing.T) {
+	tests := []struct {
+		name       string
+		update     func(h *Health)
+		wantReady  bool
+		wantIperf3 bool
+	}{
+		{
+			name: "starting",
+		},
+		{
+			name: "watching",
+			update: func(h *Health) {
+				h.SetConfigWatch(true, nil)
+				h.SetIperf3Running(true)
+			},
+			wantReady:  true,
+			wantIperf3: true,
+		},
+		{
+			name: "watch lost",
+			update: func(h *Health) {
+				h.SetConfigWatch(true, nil)
+				h.SetConfigWatch(false, errors.New("connection refused"))
+			},
+		},
+		{
+			name: "iperf3 keeps failing",
+			update: func(h *Health) {
+				h.SetConfigWatch(true, nil)
+				h.SetIperf3Running(true)
+				for i := 0; i < iperf3MaxFailures; i++ {
+					h.Iperf3Exited(errors.New("exit status 1"))
+				}
+			},
+			wantReady: true,
+		},
+		{
+			name: "iperf3 recovered",
+			update: func(h *Health) {
+				h.SetConfigWatch(true, nil)
+				h.SetIperf3Running(true)
+				h.Iperf3Exited(errors.New("exit status 1"))
+				h.Iperf3Exited(nil)
+			},
+			wantReady:  true,
+			wantIperf3: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Health{}
+			if tt.update != nil {
+				tt.update(h)
+			}
+
+			status := h.Status()
+			if status.Ready != tt.wantReady {
+				t.Errorf("Ready = %v, want %v", status.Ready, tt.wantReady)
+			}
+			if status.Iperf3Server != tt.wantIperf3 {
+				t.Errorf("Iperf3Server = %v, want %v", status.Iperf3Server, tt.wantIperf3)
+			}
+		})
+	}
+}
+
+func TestHealth_Handler(t *testing.T) {
+	h := &Health{}
+	server := httptest.NewServer(h.handler())
+	defer server.Close()
+
+	readyz := func() (int, HealthStatus) {
+		t.Helper()
+		resp, err := http.Get(server.URL + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var status HealthStatus
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			t.Fatalf("invalid /readyz body: %v", err)
+		}
+		return resp.StatusCode, status
+	}
+
+	if code, status := readyz(); code != http.StatusServiceUnavailable || status.Ready {
+		t.Errorf("before the watch: /readyz = %d, ready %v, want 503", code, status.Ready)
+	}
+
+	h.SetConfigWatch(true, nil)
+	if code, status := readyz(); code != http.StatusOK || !status.Ready {
+		t.Errorf("watching: /readyz = %d, ready %v, want 200", code, status.Ready)
+	}
+
+	resp, err := http.Get(server.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/healthz = %d, want 200", resp.StatusCode)
+	}
+}
@@ -10,13 +10,17 @@ import (
 
 // StartIperf3Server starts an iperf3 server that restarts after each client connection.
 // This avoids "server busy" errors by ensuring a fresh server for each test.
-// The server runs until the context is cancelled.
-func StartIperf3Server(ctx context.Context) error {
+// The server runs until the context is cancelled, and its state is reported to health.
+func StartIperf3Server(ctx context.Context, health *Health) error {
 	if _, err := exec.LookPath("iperf3"); err != nil {
 		return fmt.Errorf("iperf3 not found in PATH: %w", err)
 	}
 
-	go runIperf3Loop(ctx)
+	health.SetIperf3Running(true)
+	go func() {
+		defer health.SetIperf3Running(false)
+		runIperf3Loop(ctx, health)
+	}()
 
 	// Give the first server instance time to start
 	time.Sleep(500 * time.Millisecond)
@@ -24,7 +28,7 @@ func StartIperf3Server(ctx context.Context) error {
 	return nil
 }
 
-func runIperf3Loop(ctx context.Context) {
+func runIperf3Loop(ctx context.Context, health *Health) {
 	for {
 		select {
 		case <-ctx.Done():
@@ -33,12 +37,14 @@ func runIperf3Loop(ctx context.Context) {
 		}
 
 		cmd := exec.CommandContext(ctx, "iperf3", "-s", "--one-off")
-		if err := cmd.Run(); err != nil {
-			// Only log if not cancelled
-			if ctx.Err() == nil {
-				log.Printf("iperf3 server exited: %v", err)
-			}
+		err := cmd.Run()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("iperf3 server exited: %v", err)
 		}
+		health.Iperf3Exited(err)
 
 		// Brief pause before restarting to avoid tight loop on persistent errors
 		select {
@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanelliottsmith/network-debugger/pkg/checks"
+	"github.com/ryanelliottsmith/network-debugger/pkg/k8s"
+	"github.com/ryanelliottsmith/network-debugger/pkg/metrics"
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultMonitorChecks are the checks re-run on every monitoring pass when none are given.
+var DefaultMonitorChecks = []string{"ping", "dns", "ports", "conntrack", "hostconfig"}
+
+// runMonitor re-runs the given checks against every peer agent on each
+// interval and records the results as metrics. Results are not emitted to
+// stdout, so monitoring doesn't interfere with runs collected from pod logs.
+func runMonitor(ctx context.Context, self *SelfInfo, namespace string, checkNames []string, interval time.Duration, recorder *metrics.Recorder) {
+	if len(checkNames) == 0 {
+		checkNames = DefaultMonitorChecks
+	}
+
+	networkType := self.NetworkType()
+	if networkType == types.NetworkTypeOverlay {
+		checkNames = filterHostNetworkOnly(checkNames)
+	}
+
+	clientset, err := k8s.GetClientset()
+	if err != nil {
+		log.Printf("Monitoring disabled: %v", err)
+		return
+	}
+
+	log.Printf("Monitoring %s network every %s: %v", networkType, interval, checkNames)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := runMonitorPass(ctx, clientset, self, namespace, networkType, checkNames, recorder); err != nil {
+			log.Printf("Monitoring pass failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func runMonitorPass(ctx context.Context, clientset *kubernetes.Clientset, self *SelfInfo, namespace string, networkType types.NetworkType, checkNames []string, recorder *metrics.Recorder) error {
+	targets, err := discoverPeers(ctx, clientset, namespace, networkType)
+	if err != nil {
+		return err
+	}
+
+	nodeByIP := make(map[string]string, len(targets))
+	for _, target := range targets {
+		nodeByIP[target.IP] = target.NodeName
+	}
+
+	config := &types.Config{
+		RunID:       uuid.New().String(),
+		TriggeredAt: time.Now(),
+		NetworkType: networkType,
+		Targets:     targets,
+		Checks:      checkNames,
+		Ports:       types.DefaultPorts(),
+		DNSNames:    checks.DefaultDNSNames,
+		Quiet:       true,
+	}
+
+	emitter := NewEmitter(self, func(event *types.Event) error {
+		recorder.Observe(event, networkType, nodeByIP[event.Target])
+		return nil
+	})
+
+	if err := RunTests(ctx, config, self, emitter); err != nil {
+		return err
+	}
+
+	recorder.MarkRun(self.NodeName, networkType, time.Now())
+	return nil
+}
+
+func discoverPeers(ctx context.Context, clientset *kubernetes.Clientset, namespace string, networkType types.NetworkType) ([]types.TargetNode, error) {
+	if networkType == types.NetworkTypeHost {
+		pods, err := k8s.DiscoverDaemonSetPods(ctx, clientset, namespace, "netdebug-host")
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover host pods: %w", err)
+		}
+		return k8s.GetHostIPsForPods(ctx, clientset, namespace, pods)
+	}
+
+	pods, err := k8s.DiscoverDaemonSetPods(ctx, clientset, namespace, "netdebug-overlay")
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover overlay pods: %w", err)
+	}
+	return pods, nil
+}
+
+func filterHostNetworkOnly(checkNames []string) []string {
+	var filtered []string
+	for _, name := range checkNames {
+		check := types.DefaultRegistry.Get(name)
+		if check != nil && check.HostNetworkOnly() {
+			continue
+		}
+		filtered = append(filtered, name)
+	}
+	return filtered
+}
@@ -3,21 +3,26 @@ package agent
 import (
 	"context"
 	"log"
-	"strconv"
-	"strings"
+	"slices"
 	"sync"
-	"time"
 
 	"github.com/ryanelliottsmith/network-debugger/pkg/checks"
 	"github.com/ryanelliottsmith/network-debugger/pkg/types"
 )
 
-func RunTests(ctx context.Context, config *types.Config, self *SelfInfo) error {
-	if err := EmitReady(self, config.RunID); err != nil {
+func RunTests(ctx context.Context, config *types.Config, self *SelfInfo, emitter *Emitter) error {
+	if err := emitter.Ready(config.RunID); err != nil {
 		log.Printf("Failed to emit ready event: %v", err)
 	}
 
-	targets := filterTargets(config.Targets, self.NodeName)
+	targets := config.Targets
+	if !config.NetworkType.TargetsOwnNode() {
+		targets = filterTargets(config.Targets, self.NodeName)
+	}
+
+	if slices.Contains(config.Checks, "ports") {
+		config = withHostCNIPorts(config)
+	}
 
 	var wg sync.WaitGroup
 	for _, checkName := range config.Checks {
@@ -29,27 +34,39 @@ func RunTests(ctx context.Context, config *types.Config, self *SelfInfo) error {
 		go func(checkName string) {
 			defer wg.Done()
 			check := types.DefaultRegistry.Get(checkName)
-			if check != nil && check.IsLocal() {
-				runSingleCheck(ctx, checkName, "localhost", self.NodeName, config, self)
-			} else {
-				runCheckAgainstAllTargets(ctx, checkName, targets, config, self)
+			switch {
+			case check != nil && check.IsLocal():
+				runSingleCheck(ctx, checkName, "localhost", self.NodeName, config, self, emitter)
+			case checkName == "nodeport":
+				// The own node's NodePorts are the hairpin and local paths
+				runCheckAgainstAllTargets(ctx, checkName, config.Targets, config, self, emitter)
+			default:
+				runCheckAgainstAllTargets(ctx, checkName, targets, config, self, emitter)
 			}
 		}(checkName)
 	}
 	wg.Wait()
 
-	if config.BandwidthTest != nil && config.BandwidthTest.Active {
+	if config.BandwidthTest != nil && config.BandwidthTest.Active && ctx.Err() == nil {
 		if config.BandwidthTest.SourcePod == self.PodName {
-			runBandwidthTest(ctx, config.BandwidthTest, self, config.RunID)
+			runBandwidthTest(ctx, config.BandwidthTest, config, self, emitter)
 		}
 	}
 
+	if ctx.Err() != nil {
+		log.Printf("Run %s cancelled", config.RunID)
+		if err := emitter.Cancelled(config.RunID); err != nil {
+			log.Printf("Failed to emit cancelled event: %v", err)
+		}
+		return nil
+	}
+
 	summary := map[string]interface{}{
 		"checks_completed": len(config.Checks),
 		"targets_tested":   len(targets),
 	}
 
-	if err := EmitComplete(self, config.RunID, summary); err != nil {
+	if err := emitter.Complete(config.RunID, summary); err != nil {
 		log.Printf("Failed to emit complete event: %v", err)
 	}
 
@@ -66,101 +83,165 @@ func filterTargets(targets []types.TargetNode, selfNodeName string) []types.Targ
 	return filtered
 }
 
-func runCheckAgainstAllTargets(ctx context.Context, checkName string, targets []types.TargetNode, config *types.Config, self *SelfInfo) {
+func runCheckAgainstAllTargets(ctx context.Context, checkName string, targets []types.TargetNode, config *types.Config, self *SelfInfo, emitter *Emitter) {
 	for _, target := range targets {
+		if ctx.Err() != nil {
+			return
+		}
 		if checkName == "ports" {
-			runPortCheck(ctx, target, config, self)
-		} else {
-			runSingleCheck(ctx, checkName, target.IP, target.NodeName, config, self)
+			runPortCheck(ctx, target, config, self, emitter)
+			continue
+		}
+		if checkName == "nodeport" {
+			runNodePortCheck(ctx, target, config, self, emitter)
+			continue
+		}
+
+		result := runSingleCheck(ctx, checkName, target.IP, target.NodeName, config, self, emitter)
+
+		// Trace the path to targets that fail ping, unless the run traces every target anyway
+		if checkName == "ping" && result != nil && result.Status == types.StatusFail && !slices.Contains(config.Checks, "traceroute") {
+			runSingleCheck(ctx, "traceroute", target.IP, target.NodeName, config, self, emitter)
 		}
 	}
 }
 
-func runPortCheck(ctx context.Context, target types.TargetNode, config *types.Config, self *SelfInfo) {
-	if err := EmitTestStart(self, "ports", target.NodeName, config.RunID); err != nil {
+func runPortCheck(ctx context.Context, target types.TargetNode, config *types.Config, self *SelfInfo, emitter *Emitter) {
+	if err := emitter.TestStart("ports", target.NodeName, config.RunID); err != nil {
 		log.Printf("Failed to emit test start: %v", err)
 	}
 
 	// Filter ports based on the target node's role
 	portsForTarget := types.FilterPortsForRole(config.Ports, target.IsControlPlane)
+	portsForTarget = types.FilterPortsForNode(portsForTarget, config.PortNodes, target.NodeName)
 
 	check := checks.NewPortsCheck(portsForTarget)
-	result := checks.RunWithTimeout(check, target.IP, checks.DefaultCheckTimeout)
+	result := checks.RunWithTimeout(ctx, check, target.IP, config.CheckTimeout(check.Name(), check.DefaultTimeout()))
 	result.Node = self.NodeName
 
-	if err := EmitTestResult(self, result, config.RunID); err != nil {
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err := emitter.TestResult(result, config.RunID); err != nil {
 		log.Printf("Failed to emit test result: %v", err)
 	}
 }
 
-func runSingleCheck(ctx context.Context, checkName, targetIP, targetNode string, config *types.Config, self *SelfInfo) {
-	if err := EmitTestStart(self, checkName, targetNode, config.RunID); err != nil {
+func runNodePortCheck(ctx context.Context, target types.TargetNode, config *types.Config, self *SelfInfo, emitter *Emitter) {
+	if err := emitter.TestStart("nodeport", target.NodeName, config.RunID); err != nil {
 		log.Printf("Failed to emit test start: %v", err)
 	}
 
-	var check types.Check
-
-	switch checkName {
-	case "dns":
-		check = checks.NewDNSCheck(config.DNSNames, config.NetworkType)
-		targetIP = "dns-test"
+	check := checks.NewNodePortCheck(0, 0, false, target.NodeName)
+	if np := config.NodePort; np != nil {
+		check = checks.NewNodePortCheck(np.ClusterPort, np.LocalPort, slices.Contains(np.BackendNodes, target.NodeName), target.NodeName)
+		check.OwnNode = target.NodeName == self.NodeName
+	}
+	result := checks.RunWithTimeout(ctx, check, target.IP, config.CheckTimeout(check.Name(), check.DefaultTimeout()))
+	result.Node = self.NodeName
+	result.Target = target.NodeName
 
-	case "ping":
-		check = checks.NewPingCheck(0)
+	if ctx.Err() != nil {
+		return
+	}
 
-	case "ports":
-		check = checks.NewPortsCheck(config.Ports)
+	if err := emitter.TestResult(result, config.RunID); err != nil {
+		log.Printf("Failed to emit test result: %v", err)
+	}
+}
 
-	case "hostconfig":
-		check = checks.NewHostConfigCheck()
-		targetIP = "localhost"
+// runSingleCheck runs one check and emits its result, which it also returns.
+// Returns nil if the check is unknown or the run was cancelled.
+func runSingleCheck(ctx context.Context, checkName, targetIP, targetNode string, config *types.Config, self *SelfInfo, emitter *Emitter) *types.TestResult {
+	check := newCheck(checkName, config)
+	if check == nil {
+		log.Printf("Unknown check type: %s", checkName)
+		return nil
+	}
 
-	case "conntrack":
-		check = checks.NewConntrackCheck()
-		targetIP = "localhost"
+	if err := emitter.TestStart(checkName, targetNode, config.RunID); err != nil {
+		log.Printf("Failed to emit test start: %v", err)
+	}
 
-	case "iptables":
-		check = checks.NewIptablesCheck()
+	switch checkName {
+	case "dns":
+		targetIP = "dns-test"
+	case "service":
+		targetIP = config.ServiceAddress
+	case "hostconfig", "overlaymtu", "resolvconf", "dnsrecords", "conntrack", "iptables":
 		targetIP = "localhost"
-
-	default:
-		log.Printf("Unknown check type: %s", checkName)
-		return
 	}
 
-	result := checks.RunWithTimeout(check, targetIP, checks.DefaultCheckTimeout)
+	result := checks.RunWithTimeout(ctx, check, targetIP, config.CheckTimeout(checkName, check.DefaultTimeout()))
 	result.Node = self.NodeName
 
-	if err := EmitTestResult(self, result, config.RunID); err != nil {
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	if err := emitter.TestResult(result, config.RunID); err != nil {
 		log.Printf("Failed to emit test result: %v", err)
 	}
+	return result
+}
+
+// newCheck builds a check instance configured for the given run. Returns nil
+// for check names the agent doesn't know how to run.
+func newCheck(checkName string, config *types.Config) types.Check {
+	switch checkName {
+	case "dns":
+		check := checks.NewDNSCheck(config.DNSNames, config.DNSServers, config.NetworkType)
+		check.Transport = config.DNSTransport
+		check.Burst = config.DNSBurst
+		return check
+	case "ping":
+		return checks.NewPingCheck(0)
+	case "tcpping":
+		return checks.NewTCPPingCheck(0, 0, config.NetworkType.TargetNetwork())
+	case "pmtu":
+		return checks.NewPMTUCheck()
+	case "traceroute":
+		return checks.NewTracerouteCheck(0)
+	case "ports":
+		return checks.NewPortsCheck(config.Ports)
+	case "service":
+		return checks.NewServiceCheck(0, config.ServiceBackends)
+	case "hostconfig":
+		return checks.NewHostConfigCheck()
+	case "resolvconf":
+		return checks.NewResolvConfCheck(config.NetworkType)
+	case "dnsrecords":
+		return checks.NewDNSRecordsCheck(config.DNSRecords, config.NetworkType)
+	case "overlaymtu":
+		return checks.NewOverlayMTUCheck()
+	case "conntrack":
+		return checks.NewConntrackCheck()
+	case "iptables":
+		return checks.NewIptablesCheck()
+	default:
+		return nil
+	}
 }
 
-func runBandwidthTest(ctx context.Context, test *types.BandwidthTest, self *SelfInfo, runID string) {
+func runBandwidthTest(ctx context.Context, test *types.BandwidthTest, config *types.Config, self *SelfInfo, emitter *Emitter) {
+	runID := config.RunID
 	log.Printf("Running bandwidth test to %s (%s)", test.TargetNode, test.TargetIP)
 
-	if err := EmitTestStart(self, "bandwidth", test.TargetNode, runID); err != nil {
+	if err := emitter.TestStart("bandwidth", test.TargetNode, runID); err != nil {
 		log.Printf("Failed to emit test start: %v", err)
 	}
 
-	timeoutSecs := checks.BandwidthDuration + 5
-	if test.IperfArgs != "" {
-		args := strings.Fields(test.IperfArgs)
-		for i, arg := range args {
-			if arg == "-t" && i+1 < len(args) {
-				if t, err := strconv.Atoi(args[i+1]); err == nil {
-					timeoutSecs = t + 5
-				}
-			}
-		}
-	}
-
-	check := checks.NewBandwidthCheck(test.IperfArgs)
-	result := checks.RunWithTimeout(check, test.TargetIP, time.Duration(timeoutSecs)*time.Second)
+	check := checks.NewBandwidthCheck(test.IperfArgs, test.UDPBitrate)
+	result := checks.RunWithTimeout(ctx, check, test.TargetIP, config.CheckTimeout(check.Name(), check.DefaultTimeout()))
 	result.Node = self.NodeName
 	result.Target = test.TargetNode
 
-	if err := EmitTestResult(self, result, runID); err != nil {
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err := emitter.TestResult(result, runID); err != nil {
 		log.Printf("Failed to emit test result: %v", err)
 	}
 }
@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// seenRunRetention is how long a run is remembered after it finished or was
+// cancelled, long enough to outlast any redelivery over another control
+// channel.
+const seenRunRetention = 30 * time.Minute
+
+// runTracker records which runs this agent has started so a run delivered
+// over more than one control channel only executes once, and holds the cancel
+// function of each run still in flight.
+type runTracker struct {
+	mu sync.Mutex
+	// seen maps the runs started or cancelled to when they were last touched.
+	// Runs no longer in flight are forgotten after seenRunRetention.
+	seen    map[string]time.Time
+	cancels map[string]context.CancelFunc
+
+	// slot is held by the run executing. Runs share the iperf3 server,
+	// conntrack counters and the links, so overlapping runs would skew each
+	// other's results.
+	slot chan struct{}
+}
+
+func newRunTracker() *runTracker {
+	return &runTracker{
+		seen:    make(map[string]time.Time),
+		cancels: make(map[string]context.CancelFunc),
+		slot:    make(chan struct{}, 1),
+	}
+}
+
+// start marks the run as started and returns its context, or false if it
+// already was started. The caller must call finish when the run ends.
+func (t *runTracker) start(ctx context.Context, runID string) (context.Context, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune(time.Now())
+	if _, ok := t.seen[runID]; ok {
+		return nil, false
+	}
+	t.seen[runID] = time.Now()
+
+	runCtx, cancel := context.WithCancel(ctx)
+	t.cancels[runID] = cancel
+	return runCtx, true
+}
+
+// finish releases the run's context.
+func (t *runTracker) finish(runID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.seen[runID] = time.Now()
+	if cancel, ok := t.cancels[runID]; ok {
+		cancel()
+		delete(t.cancels, runID)
+	}
+}
+
+// cancel aborts the run if it is in flight. A run cancelled before it arrives
+// is marked as seen so it never starts.
+func (t *runTracker) cancel(runID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune(time.Now())
+	t.seen[runID] = time.Now()
+
+	cancel, ok := t.cancels[runID]
+	if !ok {
+		return false
+	}
+	cancel()
+	delete(t.cancels, runID)
+	return true
+}
+
+// prune forgets the runs that ended more than seenRunRetention before now.
+func (t *runTracker) prune(now time.Time) {
+	for runID, at := range t.seen {
+		if _, running := t.cancels[runID]; !running && now.Sub(at) > seenRunRetention {
+			delete(t.seen, runID)
+		}
+	}
+}
+
+// acquire waits until no other run is executing. It returns false if the run
+// is cancelled while queued. The caller must call release when the run ends.
+func (t *runTracker) acquire(ctx context.Context, runID string) bool {
+	select {
+	case t.slot <- struct{}{}:
+		return true
+	default:
+	}
+
+	log.Printf("Run %s queued behind the run in progress", runID)
+	select {
+	case t.slot <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release lets the next queued run execute.
+func (t *runTracker) release() {
+	<-t.slot
+}
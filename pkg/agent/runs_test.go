@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunTracker_Start(t *testing.T) {
+	tracker := newRunTracker()
+
+	if _, ok := tracker.start(context.Background(), "run-1"); !ok {
+		t.Fatal("first delivery of run-1 didn't start")
+	}
+	if _, ok := tracker.start(context.Background(), "run-1"); ok {
+		t.Error("second delivery of run-1 started it again")
+	}
+	tracker.finish("run-1")
+	if _, ok := tracker.start(context.Background(), "run-1"); ok {
+		t.Error("finished run-1 started again")
+	}
+
+	// A run cancelled before it arrives never starts
+	tracker.cancel("run-2")
+	if _, ok := tracker.start(context.Background(), "run-2"); ok {
+		t.Error("cancelled run-2 started")
+	}
+}
+
+func TestRunTracker_Prune(t *testing.T) {
+	tracker := newRunTracker()
+
+	tracker.start(context.Background(), "running")
+	tracker.start(context.Background(), "finished")
+	tracker.finish("finished")
+	tracker.start(context.Background(), "recent")
+	tracker.finish("recent")
+
+	// Pretend both runs started long ago and one finished long ago
+	old := time.Now().Add(-2 * seenRunRetention)
+	tracker.seen["running"] = old
+	tracker.seen["finished"] = old
+
+	tracker.prune(time.Now())
+
+	for runID, want := range map[string]bool{"running": true, "finished": false, "recent": true} {
+		if _, got := tracker.seen[runID]; got != want {
+			t.Errorf("%s remembered = %v, want %v", runID, got, want)
+		}
+	}
+}
+
+func TestRunTracker_Cancel(t *testing.T) {
+	tracker := newRunTracker()
+
+	ctx, _ := tracker.start(context.Background(), "run-1")
+	if !tracker.cancel("run-1") {
+		t.Fatal("cancel() of the running run-1 = false, want true")
+	}
+	select {
+	case <-ctx.Done():
+	default:
+		t.Error("run-1's context wasn't cancelled")
+	}
+	if tracker.cancel("run-1") {
+		t.Error("second cancel() of run-1 = true, want false")
+	}
+}
+
+func TestRunTracker_Slot(t *testing.T) {
+	tracker := newRunTracker()
+
+	first, _ := tracker.start(context.Background(), "run-1")
+	if !tracker.acquire(first, "run-1") {
+		t.Fatal("run-1 didn't get the free slot")
+	}
+
+	second, _ := tracker.start(context.Background(), "run-2")
+	acquired := make(chan bool)
+	go func() { acquired <- tracker.acquire(second, "run-2") }()
+
+	select {
+	case <-acquired:
+		t.Fatal("run-2 got the slot while run-1 held it")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	tracker.release()
+	if !<-acquired {
+		t.Fatal("run-2 didn't get the slot run-1 released")
+	}
+
+	// A run cancelled while queued gives up without the slot
+	third, _ := tracker.start(context.Background(), "run-3")
+	go func() { acquired <- tracker.acquire(third, "run-3") }()
+	tracker.cancel("run-3")
+	if <-acquired {
+		t.Error("cancelled run-3 got the slot")
+	}
+
+	tracker.release()
+	if !tracker.acquire(context.Background(), "run-4") {
+		t.Error("run-4 didn't get the slot once it was free")
+	}
+}
@@ -3,6 +3,8 @@ package agent
 import (
 	"fmt"
 	"os"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
 )
 
 type SelfInfo struct {
@@ -34,3 +36,33 @@ func GetSelfInfo() (*SelfInfo, error) {
 
 	return self, nil
 }
+
+// GetStandaloneSelfInfo builds SelfInfo for an agent running outside a
+// DaemonSet. The downward API variables are used when present, otherwise the
+// hostname stands in for the node name.
+func GetStandaloneSelfInfo() *SelfInfo {
+	self := &SelfInfo{
+		NodeName: os.Getenv("NODE_NAME"),
+		PodName:  os.Getenv("POD_NAME"),
+		PodIP:    os.Getenv("POD_IP"),
+		HostIP:   os.Getenv("HOST_IP"),
+	}
+
+	if self.NodeName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "localhost"
+		}
+		self.NodeName = hostname
+	}
+
+	return self
+}
+
+// NetworkType reports whether the agent shares the node's network namespace.
+func (s *SelfInfo) NetworkType() types.NetworkType {
+	if s.PodIP != "" && s.PodIP == s.HostIP {
+		return types.NetworkTypeHost
+	}
+	return types.NetworkTypeOverlay
+}
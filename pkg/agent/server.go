@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/metrics"
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+// DefaultTokenFile is where the DaemonSets mount the shared API token.
+const DefaultTokenFile = "/etc/netdebug/token"
+
+// apiServer serves the agent's HTTP endpoints: metrics, and a control API that
+// accepts a run and streams its events back as newline-delimited JSON.
+type apiServer struct {
+	self      *SelfInfo
+	tracker   *runTracker
+	tokenFile string
+	recorder  *metrics.Recorder
+	health    *Health
+}
+
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.recorder.Handler())
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", s.health.handleReadyz)
+	mux.HandleFunc(types.WhoamiPath, s.handleWhoami)
+	mux.HandleFunc("/v1/runs", s.handleRuns)
+	return mux
+}
+
+// handleWhoami answers with the node name, so the service check can tell which
+// backend a request through the Service reached.
+func (s *apiServer) handleWhoami(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(w, s.self.NodeName)
+}
+
+func (s *apiServer) handleRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := s.authorize(r); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var config types.Config
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, fmt.Sprintf("invalid config: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if config.RunID == "" {
+		http.Error(w, "run_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if config.Cancelled {
+		if s.tracker.cancel(config.RunID) {
+			log.Printf("Cancelling run via API: %s", config.RunID)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	runCtx, ok := s.tracker.start(r.Context(), config.RunID)
+	if !ok {
+		http.Error(w, fmt.Sprintf("run %s already started", config.RunID), http.StatusConflict)
+		return
+	}
+	defer s.tracker.finish(config.RunID)
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	var mu sync.Mutex
+	encoder := json.NewEncoder(w)
+	emitter := NewEmitter(s.self, func(event *types.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := encoder.Encode(event); err != nil {
+			return fmt.Errorf("failed to stream event: %w", err)
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+
+	log.Printf("Handling new run via API: %s", config.RunID)
+
+	if !s.tracker.acquire(runCtx, config.RunID) {
+		if err := emitter.Cancelled(config.RunID); err != nil {
+			log.Printf("Failed to emit cancelled event: %v", err)
+		}
+		return
+	}
+	defer s.tracker.release()
+
+	if err := RunTests(runCtx, &config, s.self, emitter); err != nil {
+		log.Printf("Error running tests: %v", err)
+		if emitErr := emitter.Error(config.RunID, err.Error()); emitErr != nil {
+			log.Printf("Failed to emit error event: %v", emitErr)
+		}
+	}
+}
+
+// authorize checks the request token against the mounted token file. The file
+// is re-read on every request so a rotated Secret takes effect without a restart.
+func (s *apiServer) authorize(r *http.Request) error {
+	data, err := os.ReadFile(s.tokenFile)
+	if err != nil {
+		return fmt.Errorf("control API disabled: no token available")
+	}
+
+	expected := strings.TrimSpace(string(data))
+	if expected == "" {
+		return fmt.Errorf("control API disabled: empty token")
+	}
+
+	got := r.Header.Get(types.TokenHeader)
+	if subtle.ConstantTimeCompare([]byte(got), []byte(expected)) != 1 {
+		return fmt.Errorf("invalid token")
+	}
+
+	return nil
+}
+
+// serveHTTP runs the agent's HTTP server until the context is cancelled.
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("HTTP server shutdown: %v", err)
+		}
+	}()
+
+	log.Printf("Serving HTTP on %s", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("HTTP server exited: %v", err)
+	}
+}
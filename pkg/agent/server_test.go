@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/metrics"
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+const testToken = "secret-token"
+
+// newTestServer serves the agent's HTTP API with the given token in its token
+// file, or no token file at all when token is nil.
+func newTestServer(t *testing.T, token *string) (*apiServer, *httptest.Server) {
+	t.Helper()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if token != nil {
+		if err := os.WriteFile(tokenFile, []byte(*token+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &apiServer{
+		self:      &SelfInfo{NodeName: "node-a", PodName: "netdebug-host-a"},
+		tracker:   newRunTracker(),
+		tokenFile: tokenFile,
+		recorder:  metrics.NewRecorder(),
+	}
+	server := httptest.NewServer(s.handler())
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+func postRun(t *testing.T, url, token string, config *types.Config) *http.Response {
+	t.Helper()
+
+	body, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url+"/v1/runs", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set(types.TokenHeader, token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestAuthorize(t *testing.T) {
+	token := func(s string) *string { return &s }
+
+	tests := []struct {
+		name      string
+		fileToken *string
+		header    string
+		wantErr   bool
+	}{
+		{name: "matching token", fileToken: token(testToken), header: testToken},
+		{name: "wrong token", fileToken: token(testToken), header: "guess", wantErr: true},
+		{name: "no token sent", fileToken: token(testToken), wantErr: true},
+		{name: "no token file", header: testToken, wantErr: true},
+		{name: "empty token file", fileToken: token(""), header: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t, tt.fileToken)
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/runs", nil)
+			if tt.header != "" {
+				req.Header.Set(types.TokenHeader, tt.header)
+			}
+			if err := s.authorize(req); (err != nil) != tt.wantErr {
+				t.Errorf("authorize() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandleRuns_Rejected(t *testing.T) {
+	token := testToken
+
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		config     *types.Config
+		wantStatus int
+	}{
+		{name: "GET", method: http.MethodGet, token: testToken, wantStatus: http.StatusMethodNotAllowed},
+		{name: "no token", method: http.MethodPost, config: &types.Config{RunID: "run-1"}, wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodPost, token: "guess", config: &types.Config{RunID: "run-1"}, wantStatus: http.StatusUnauthorized},
+		{name: "no run ID", method: http.MethodPost, token: testToken, config: &types.Config{}, wantStatus: http.StatusBadRequest},
+		{name: "cancel", method: http.MethodPost, token: testToken, config: &types.Config{RunID: "run-1", Cancelled: true}, wantStatus: http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, server := newTestServer(t, &token)
+
+			var resp *http.Response
+			if tt.method == http.MethodPost {
+				resp = postRun(t, server.URL, tt.token, tt.config)
+			} else {
+				var err error
+				resp, err = http.Get(server.URL + "/v1/runs")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer resp.Body.Close()
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandleRuns_StreamsEvents(t *testing.T) {
+	token := testToken
+	_, server := newTestServer(t, &token)
+
+	resp := postRun(t, server.URL, testToken, &types.Config{RunID: "run-1"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	var got []types.EventType
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var event types.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", scanner.Text(), err)
+		}
+		if event.RunID != "run-1" || event.Node != "node-a" {
+			t.Errorf("event %+v isn't from node-a's run-1", event)
+		}
+		got = append(got, event.Type)
+	}
+
+	want := []types.EventType{types.EventTypeReady, types.EventTypeComplete}
+	if !slices.Equal(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	// The run was delivered already, e.g. over the ConfigMap
+	if resp := postRun(t, server.URL, testToken, &types.Config{RunID: "run-1"}); resp.StatusCode != http.StatusConflict {
+		t.Errorf("second delivery: status = %d, want %d", resp.StatusCode, http.StatusConflict)
+	}
+}
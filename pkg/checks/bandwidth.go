@@ -5,17 +5,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os/exec"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ryanelliottsmith/network-debugger/pkg/types"
 )
 
 const BandwidthDuration = 10
 
+// iperf3StatusTimeout bounds the request for the target agent's iperf3
+// server status after a failed test.
+const iperf3StatusTimeout = 3 * time.Second
+
+// UDPMaxLossPercent is the share of datagrams a UDP test may lose before it
+// fails.
+const UDPMaxLossPercent = 1.0
+
 type BandwidthCheck struct {
-	iperfArgs string
+	iperfArgs  string
+	udpBitrate string
 }
 
 func (c *BandwidthCheck) Name() string {
@@ -23,7 +35,7 @@ func (c *BandwidthCheck) Name() string {
 }
 
 func (c *BandwidthCheck) Description() string {
-	return "Tests network bandwidth between nodes using iperf. Results display throughput speed, TCP retransmit counts, and test duration."
+	return "Tests network bandwidth between nodes using iperf. Results display throughput speed, TCP retransmit counts, and test duration, or in UDP mode jitter, lost and out-of-order datagrams at the target bitrate."
 }
 
 func (c *BandwidthCheck) Run(ctx context.Context, target string) (*types.TestResult, error) {
@@ -33,36 +45,92 @@ func (c *BandwidthCheck) Run(ctx context.Context, target string) (*types.TestRes
 		Status: types.StatusPass,
 	}
 
-	details, err := c.runIperf3(ctx, target)
+	output, err := c.runIperf3(ctx, target)
 	if err != nil {
 		result.Status = types.StatusFail
 		result.Error = err.Error()
-		log.Printf("[bandwidth] Failed: %v", err)
+		if serverErr := iperf3ServerError(ctx, target); serverErr != "" {
+			result.Error += "; " + serverErr
+		}
+		log.Printf("[bandwidth] Failed: %s", result.Error)
 		return result, nil
 	}
 
-	log.Printf("[bandwidth] Result: SPEED: %.2f Mbps, RETRANSMITS: %d, RUNTIME: %ds", details.BandwidthMbps, details.Retransmits, details.Duration)
 	result.Details = make(map[string]interface{})
+
+	if c.udp() {
+		details, err := c.parseIperf3UDPOutput(output)
+		if err != nil {
+			log.Printf("[bandwidth] parse error: %v", err)
+			result.Status = types.StatusFail
+			result.Error = err.Error()
+			return result, nil
+		}
+
+		log.Printf("[bandwidth] Result: SPEED: %.2f Mbps, JITTER: %.3f ms, LOST: %d/%d, OUT OF ORDER: %d, RUNTIME: %ds",
+			details.BandwidthMbps, details.JitterMS, details.LostDatagrams, details.TotalDatagrams, details.OutOfOrder, details.Duration)
+		result.Details["udp_bandwidth"] = details
+
+		if details.LostPercent > UDPMaxLossPercent {
+			result.Status = types.StatusFail
+			result.Error = fmt.Sprintf("lost %.2f%% of datagrams at %s (%d/%d)", details.LostPercent, details.TargetBitrate, details.LostDatagrams, details.TotalDatagrams)
+		}
+		return result, nil
+	}
+
+	details, err := c.parseIperf3Output(output)
+	if err != nil {
+		log.Printf("[bandwidth] parse error: %v", err)
+		result.Status = types.StatusFail
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	log.Printf("[bandwidth] Result: SPEED: %.2f Mbps, RETRANSMITS: %d, RUNTIME: %ds", details.BandwidthMbps, details.Retransmits, details.Duration)
 	result.Details["bandwidth"] = details
 	return result, nil
 }
 
-func (c *BandwidthCheck) runIperf3(ctx context.Context, target string) (types.BandwidthCheckDetails, error) {
+// udp reports whether the test runs over UDP, either because a target bitrate
+// was set or because the custom args ask for it.
+func (c *BandwidthCheck) udp() bool {
+	if c.udpBitrate != "" {
+		return true
+	}
+	for _, arg := range strings.Fields(c.iperfArgs) {
+		if arg == "-u" || arg == "--udp" {
+			return true
+		}
+	}
+	return false
+}
+
+// duration returns the iperf3 test length in seconds, honouring any -t in the custom args.
+func (c *BandwidthCheck) duration() int {
 	duration := BandwidthDuration
+	fields := strings.Fields(c.iperfArgs)
+	for i, arg := range fields {
+		if arg == "-t" && i+1 < len(fields) {
+			if t, err := strconv.Atoi(fields[i+1]); err == nil {
+				duration = t
+			}
+		}
+	}
+	return duration
+}
+
+// runIperf3 runs the iperf3 client against target and returns its JSON output.
+func (c *BandwidthCheck) runIperf3(ctx context.Context, target string) ([]byte, error) {
+	duration := c.duration()
 	args := []string{"-c", target, "-J"}
 	if c.iperfArgs != "" {
 		args = append(args, strings.Fields(c.iperfArgs)...)
-		fields := strings.Fields(c.iperfArgs)
-		for i, arg := range fields {
-			if arg == "-t" && i+1 < len(fields) {
-				if t, err := strconv.Atoi(fields[i+1]); err == nil {
-					duration = t
-				}
-			}
-		}
 	} else {
 		args = append(args, "-t", fmt.Sprintf("%d", BandwidthDuration))
 	}
+	if c.udpBitrate != "" {
+		args = append(args, "-u", "-b", c.udpBitrate)
+	}
 	log.Printf("[bandwidth] Starting iperf3 test to %s for %d seconds", target, duration)
 	cmd := exec.CommandContext(ctx, "iperf3", args...)
 	output, err := cmd.CombinedOutput()
@@ -74,16 +142,42 @@ func (c *BandwidthCheck) runIperf3(ctx context.Context, target string) (types.Ba
 
 	if err != nil {
 		log.Printf("[bandwidth] iperf3 command error: %v", err)
-		return types.BandwidthCheckDetails{}, fmt.Errorf("iperf3 failed: %v", err)
+		return output, fmt.Errorf("iperf3 failed: %v", err)
 	}
 
-	details, parseErr := c.parseIperf3Output(output)
-	if parseErr != nil {
-		log.Printf("[bandwidth] parse error: %v", parseErr)
-		return details, parseErr
+	return output, nil
+}
+
+// iperf3ServerError asks the target's agent whether its iperf3 server is
+// running, since agents stay ready without one, and describes why it isn't.
+// It returns "" if the server is running or the agent can't tell.
+func iperf3ServerError(ctx context.Context, target string) string {
+	ctx, cancel := context.WithTimeout(ctx, iperf3StatusTimeout)
+	defer cancel()
+
+	url := fmt.Sprintf("http://%s/readyz", net.JoinHostPort(target, strconv.Itoa(types.AgentPort)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return ""
 	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
 
-	return details, nil
+	// /readyz answers 503 with the same body when the agent isn't ready
+	var status struct {
+		Iperf3Server bool   `json:"iperf3_server"`
+		Iperf3Error  string `json:"iperf3_error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil || status.Iperf3Server {
+		return ""
+	}
+	if status.Iperf3Error != "" {
+		return fmt.Sprintf("iperf3 server on %s is not running: %s", target, status.Iperf3Error)
+	}
+	return fmt.Sprintf("iperf3 server on %s is not running", target)
 }
 
 func (c *BandwidthCheck) parseIperf3Output(output []byte) (types.BandwidthCheckDetails, error) {
@@ -132,6 +226,75 @@ func (c *BandwidthCheck) parseIperf3Output(output []byte) (types.BandwidthCheckD
 	return details, nil
 }
 
+// parseIperf3UDPOutput reads the receiver-side results of a UDP test: the
+// throughput that arrived, jitter, lost datagrams and reordering.
+func (c *BandwidthCheck) parseIperf3UDPOutput(output []byte) (types.UDPBandwidthCheckDetails, error) {
+	details := types.UDPBandwidthCheckDetails{
+		TargetBitrate: c.udpBitrate,
+		Duration:      c.duration(),
+	}
+	if details.TargetBitrate == "" {
+		details.TargetBitrate = "1M"
+		fields := strings.Fields(c.iperfArgs)
+		for i, arg := range fields {
+			if (arg == "-b" || arg == "--bitrate") && i+1 < len(fields) {
+				details.TargetBitrate = fields[i+1]
+			}
+		}
+	}
+
+	var iperf3Result struct {
+		Error string `json:"error"`
+		End   struct {
+			Streams []struct {
+				UDP struct {
+					OutOfOrder int `json:"out_of_order"`
+				} `json:"udp"`
+			} `json:"streams"`
+			Sum struct {
+				BitsPerSecond float64 `json:"bits_per_second"`
+				JitterMS      float64 `json:"jitter_ms"`
+				LostPackets   int     `json:"lost_packets"`
+				Packets       int     `json:"packets"`
+				LostPercent   float64 `json:"lost_percent"`
+			} `json:"sum"`
+			// Newer iperf3 versions report the receiver side separately
+			SumReceived struct {
+				BitsPerSecond float64 `json:"bits_per_second"`
+			} `json:"sum_received"`
+		} `json:"end"`
+	}
+
+	if err := json.Unmarshal(output, &iperf3Result); err != nil {
+		return details, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	if iperf3Result.Error != "" {
+		return details, fmt.Errorf("iperf3: %s", iperf3Result.Error)
+	}
+
+	sum := iperf3Result.End.Sum
+	bitsPerSecond := iperf3Result.End.SumReceived.BitsPerSecond
+	if bitsPerSecond == 0 {
+		bitsPerSecond = sum.BitsPerSecond
+	}
+
+	details.BandwidthMbps = bitsPerSecond / 1000000.0
+	details.JitterMS = sum.JitterMS
+	details.LostDatagrams = sum.LostPackets
+	details.TotalDatagrams = sum.Packets
+	details.LostPercent = sum.LostPercent
+	for _, stream := range iperf3Result.End.Streams {
+		details.OutOfOrder += stream.UDP.OutOfOrder
+	}
+
+	if details.TotalDatagrams == 0 {
+		return details, fmt.Errorf("iperf3 sent no UDP datagrams - test may have failed")
+	}
+
+	return details, nil
+}
+
 func (c *BandwidthCheck) IsLocal() bool {
 	return false
 }
@@ -144,6 +307,11 @@ func (c *BandwidthCheck) AlwaysShow() bool {
 	return true
 }
 
+// DefaultTimeout is the iperf3 test duration plus time to connect and report.
+func (c *BandwidthCheck) DefaultTimeout() time.Duration {
+	return time.Duration(c.duration()+5) * time.Second
+}
+
 func (c *BandwidthCheck) FormatSummary(details interface{}, quiet bool) string {
 	if details == nil {
 		return ""
@@ -152,6 +320,9 @@ func (c *BandwidthCheck) FormatSummary(details interface{}, quiet bool) string {
 	// Details can be a map or struct depending on how it was serialized
 	switch d := details.(type) {
 	case map[string]interface{}:
+		if udp, ok := d["udp_bandwidth"].(map[string]interface{}); ok {
+			return formatUDPBandwidthMap(udp)
+		}
 		// Check for nested "bandwidth" key (as stored in TestResult.Details)
 		if bw, ok := d["bandwidth"]; ok {
 			if bwMap, ok := bw.(map[string]interface{}); ok {
@@ -184,10 +355,27 @@ func formatBandwidthMap(m map[string]interface{}) string {
 	return fmt.Sprintf("SPEED: %.2f Mbps, RETRANSMITS: %d%s", mbps, int(retransmits), durationStr)
 }
 
-func NewBandwidthCheck(args string) *BandwidthCheck {
-	return &BandwidthCheck{iperfArgs: args}
+// formatUDPBandwidthMap summarizes what the table's UDP columns (bitrate,
+// jitter and loss) don't show.
+func formatUDPBandwidthMap(m map[string]interface{}) string {
+	bitrate, _ := m["target_bitrate"].(string)
+	outOfOrder, _ := m["out_of_order"].(float64)
+	duration, _ := m["duration_seconds"].(float64)
+
+	durationStr := ""
+	if duration > 0 {
+		durationStr = fmt.Sprintf(", RUNTIME: %ds", int(duration))
+	}
+
+	return fmt.Sprintf("UDP %s, OUT OF ORDER: %d%s", bitrate, int(outOfOrder), durationStr)
+}
+
+// NewBandwidthCheck builds a bandwidth check passing args to iperf3. A non-empty
+// udpBitrate runs a UDP test at that target bitrate instead of TCP.
+func NewBandwidthCheck(args, udpBitrate string) *BandwidthCheck {
+	return &BandwidthCheck{iperfArgs: args, udpBitrate: udpBitrate}
 }
 
 func init() {
-	types.DefaultRegistry.Register(NewBandwidthCheck(""))
+	types.DefaultRegistry.Register(NewBandwidthCheck("", ""))
 }
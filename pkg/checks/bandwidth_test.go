@@ -0,0 +1,77 @@
+package checks
+
+import (
+	"testing"
+)
+
+const iperf3UDPOutput = `{
+	"start": {},
+	"intervals": [],
+	"end": {
+		"streams": [{
+			"udp": {
+				"bits_per_second": 99876543.2,
+				"jitter_ms": 0.042,
+				"lost_packets": 12,
+				"packets": 86000,
+				"lost_percent": 0.013953,
+				"out_of_order": 3
+			}
+		}],
+		"sum": {
+			"bits_per_second": 99876543.2,
+			"jitter_ms": 0.042,
+			"lost_packets": 12,
+			"packets": 86000,
+			"lost_percent": 0.013953
+		},
+		"sum_received": {
+			"bits_per_second": 99800000
+		}
+	}
+}`
+
+func TestParseIperf3UDPOutput(t *testing.T) {
+	check := NewBandwidthCheck("", "100M")
+
+	details, err := check.parseIperf3UDPOutput([]byte(iperf3UDPOutput))
+	if err != nil {
+		t.Fatalf("parseIperf3UDPOutput returned error: %v", err)
+	}
+
+	if details.TargetBitrate != "100M" {
+		t.Errorf("TargetBitrate = %q, want 100M", details.TargetBitrate)
+	}
+	if details.BandwidthMbps != 99.8 {
+		t.Errorf("BandwidthMbps = %v, want receiver-side 99.8", details.BandwidthMbps)
+	}
+	if details.JitterMS != 0.042 {
+		t.Errorf("JitterMS = %v, want 0.042", details.JitterMS)
+	}
+	if details.LostDatagrams != 12 || details.TotalDatagrams != 86000 {
+		t.Errorf("lost/total = %d/%d, want 12/86000", details.LostDatagrams, details.TotalDatagrams)
+	}
+	if details.OutOfOrder != 3 {
+		t.Errorf("OutOfOrder = %d, want 3", details.OutOfOrder)
+	}
+	if details.Duration != BandwidthDuration {
+		t.Errorf("Duration = %d, want %d", details.Duration, BandwidthDuration)
+	}
+}
+
+func TestParseIperf3UDPOutput_Error(t *testing.T) {
+	check := NewBandwidthCheck("-u -b 1G -t 5", "")
+	if !check.udp() {
+		t.Fatal("udp() = false for custom args with -u")
+	}
+
+	_, err := check.parseIperf3UDPOutput([]byte(`{"error": "unable to connect to server"}`))
+	if err == nil {
+		t.Fatal("expected error for iperf3 error output")
+	}
+
+	details, _ := check.parseIperf3UDPOutput([]byte(`{"end": {"sum": {"packets": 10}}}`))
+	if details.TargetBitrate != "1G" || details.Duration != 5 {
+		t.Errorf("bitrate/duration = %s/%d, want 1G/5 from custom args", details.TargetBitrate, details.Duration)
+	}
+}
@@ -11,15 +11,46 @@ const (
 	// DefaultCheckTimeout is the default timeout for most checks
 	DefaultCheckTimeout = 5 * time.Second
 
-	// DefaultPingTimeout is the default timeout for ping checks
-	DefaultPingTimeout = 3 * time.Second
+	// DefaultPingTimeout is the default timeout for ping checks. It covers
+	// DefaultPingCount packets, which the pinger gives one second each.
+	DefaultPingTimeout = DefaultPingCount*time.Second + 2*time.Second
+
+	// DefaultTCPPingTimeout is the default timeout for tcpping checks. It covers
+	// DefaultPingCount handshakes at their full dial timeout plus the interval.
+	DefaultTCPPingTimeout = DefaultPingCount*(tcpPingDialTimeout+tcpPingInterval) + 2*time.Second
 
 	// DefaultPortsTimeout is the default timeout for port checks
 	DefaultPortsTimeout = 10 * time.Second
+
+	// DefaultPMTUTimeout is the default timeout for path MTU discovery, which
+	// can take a dozen probe rounds on a path with an MTU problem
+	DefaultPMTUTimeout = 20 * time.Second
+
+	// DefaultTracerouteTimeout is the default timeout for tracing the path to a
+	// target over all traceroute protocols
+	DefaultTracerouteTimeout = 30 * time.Second
+
+	// DefaultServiceTimeout is the default timeout for the service check. It
+	// covers ServiceRequests requests even when a few time out.
+	DefaultServiceTimeout = 25 * time.Second
+
+	// DefaultNodePortTimeout is the default timeout for probing both node ports
+	// of one node, with retries while kube-proxy catches up with new Services
+	DefaultNodePortTimeout = 20 * time.Second
+
+	// DefaultDNSTimeout is the default timeout for the whole list of DNS lookups
+	DefaultDNSTimeout = 10 * time.Second
+
+	// DefaultDNSRecordsTimeout is the default timeout for resolving the
+	// headless Service's records, with retries while CoreDNS catches up with
+	// its endpoints
+	DefaultDNSRecordsTimeout = 30 * time.Second
 )
 
-func RunWithTimeout(check types.Check, target string, timeout time.Duration) *types.TestResult {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+// RunWithTimeout runs the check with a timeout. Cancelling parent aborts the
+// check, including any child processes it started.
+func RunWithTimeout(parent context.Context, check types.Check, target string, timeout time.Duration) *types.TestResult {
+	ctx, cancel := context.WithTimeout(parent, timeout)
 	defer cancel()
 
 	startTime := time.Now()
@@ -41,7 +72,10 @@ func RunWithTimeout(check types.Check, target string, timeout time.Duration) *ty
 	result.Duration = endTime.Sub(startTime)
 
 	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
+		if parent.Err() != nil {
+			result.Status = types.StatusFail
+			result.Error = "cancelled"
+		} else if ctx.Err() == context.DeadlineExceeded {
 			result.Status = types.StatusFail
 			result.Error = "timeout after " + timeout.String()
 		} else {
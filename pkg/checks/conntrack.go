@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ryanelliottsmith/network-debugger/pkg/types"
 	"github.com/ryanelliottsmith/network-debugger/pkg/util"
@@ -134,6 +135,10 @@ func (c *ConntrackCheck) AlwaysShow() bool {
 	return false
 }
 
+func (c *ConntrackCheck) DefaultTimeout() time.Duration {
+	return DefaultCheckTimeout
+}
+
 func (c *ConntrackCheck) FormatSummary(details interface{}, quiet bool) string {
 	if details == nil {
 		return ""
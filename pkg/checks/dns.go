@@ -5,16 +5,41 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+	"golang.org/x/net/dns/dnsmessage"
 )
 
 // DefaultDNSNames are the default DNS names to resolve when none are specified
 var DefaultDNSNames = []string{"kubernetes.default.svc.cluster.local", "google.com"}
 
+// dnsQueryTimeout is how long one DNS server is given to answer one
+// question before the next nameserver is tried.
+const dnsQueryTimeout = 2 * time.Second
+
 type DNSCheck struct {
+	// Names are queries in the form types.ParseDNSQuery reads. A plain name is
+	// looked up as A and AAAA through the nameservers in /etc/resolv.conf.
 	Names []string
+	// Servers are queried directly for every query without its own server, in
+	// addition to the lookups through the local resolver, so one bad CoreDNS
+	// replica stands out.
+	Servers []types.DNSServer
+	// Transport sends every successful lookup again over plain UDP, UDP with
+	// EDNS0 buffers of 1232 and 4096 bytes, and TCP.
+	Transport bool
+	// Burst sends this many pairs of parallel A and AAAA queries for every
+	// successful lookup, to catch intermittent failures and 5s delays.
+	Burst int
+	// Conntrack reads the node's conntrack insert_failed counter around each
+	// burst, which only the host network agent can see.
+	Conntrack bool
+
+	// resolvConf is read for nameservers and the search path. Defaults to
+	// resolvConfPath.
+	resolvConf string
 }
 
 func (c *DNSCheck) Name() string {
@@ -22,7 +47,7 @@ func (c *DNSCheck) Name() string {
 }
 
 func (c *DNSCheck) Description() string {
-	return "Tests DNS resolution against the local resolver (/etc/resolv.conf). Verifies Cluster DNS on the overlay network and the host's default resolver on the host network."
+	return "Tests DNS resolution against the local resolver (/etc/resolv.conf) or the given servers, for A, AAAA, SRV, PTR and CNAME records, optionally checking the answer. Verifies Cluster DNS on the overlay network, also querying the kube-dns VIP and each CoreDNS replica directly, and the host's default resolver on the host network. Optionally repeats each lookup over UDP, EDNS0 and TCP, or in bursts of parallel A and AAAA queries."
 }
 
 func (c *DNSCheck) Run(ctx context.Context, target string) (*types.TestResult, error) {
@@ -32,13 +57,36 @@ func (c *DNSCheck) Run(ctx context.Context, target string) (*types.TestResult, e
 		Status: types.StatusPass,
 	}
 
+	path := c.resolvConf
+	if path == "" {
+		path = resolvConfPath
+	}
+	conf, confErr := readResolvConf(path)
+
 	var allDetails []types.DNSCheckDetails
+	var queries []types.DNSQuery
 	var errors []string
 
-	for _, name := range c.Names {
-		details, err := c.resolveWithTiming(ctx, name)
+	for _, spec := range c.Names {
+		query, err := types.ParseDNSQuery(spec)
 		if err != nil {
-			errors = append(errors, fmt.Sprintf("%s: %v", name, err))
+			allDetails = append(allDetails, types.DNSCheckDetails{Query: spec, Error: err.Error()})
+			errors = append(errors, err.Error())
+			result.Status = types.StatusFail
+			continue
+		}
+		queries = append(queries, *query)
+
+		if query.Server == "" && confErr != nil {
+			allDetails = append(allDetails, types.DNSCheckDetails{Query: spec, Error: confErr.Error()})
+			errors = append(errors, fmt.Sprintf("%s: %v", spec, confErr))
+			result.Status = types.StatusFail
+			continue
+		}
+
+		details := lookup(ctx, *query, conf)
+		if details.Error != "" {
+			errors = append(errors, fmt.Sprintf("%s: %s", spec, details.Error))
 			result.Status = types.StatusFail
 		}
 		allDetails = append(allDetails, details)
@@ -50,6 +98,49 @@ func (c *DNSCheck) Run(ctx context.Context, target string) (*types.TestResult, e
 	}
 	result.Details["lookups"] = allDetails
 
+	if len(c.Servers) > 0 {
+		servers := c.queryServers(ctx, queries)
+		for _, server := range servers {
+			if server.Failed > 0 {
+				errors = append(errors, fmt.Sprintf("%s: %d/%d lookups failed", serverLabel(server), server.Failed, server.Queries))
+				result.Status = types.StatusFail
+			}
+		}
+		result.Details["servers"] = servers
+	}
+
+	if c.Transport {
+		var transports []types.DNSTransportDetails
+		for _, lookup := range allDetails {
+			if lookup.Error != "" || ctx.Err() != nil {
+				continue
+			}
+			transport := probeTransports(ctx, lookup)
+			if len(transport.Issues) > 0 {
+				errors = append(errors, transport.Issues...)
+				result.Status = types.StatusFail
+			}
+			transports = append(transports, transport)
+		}
+		result.Details["transports"] = transports
+	}
+
+	if c.Burst > 0 {
+		var bursts []types.DNSBurstDetails
+		for _, lookup := range allDetails {
+			if lookup.Error != "" || ctx.Err() != nil {
+				continue
+			}
+			burst := runBurst(ctx, lookup, c.Burst, c.Conntrack)
+			if burst.Timeouts > 0 || burst.Over5s > 0 {
+				errors = append(errors, fmt.Sprintf("%s: %d/%d query pairs timed out, %d took over 5s", lookup.Query, burst.Timeouts, burst.Pairs, burst.Over5s))
+				result.Status = types.StatusFail
+			}
+			bursts = append(bursts, burst)
+		}
+		result.Details["bursts"] = bursts
+	}
+
 	if len(errors) > 0 {
 		result.Error = strings.Join(errors, "; ")
 		result.Details["errors"] = errors
@@ -58,27 +149,211 @@ func (c *DNSCheck) Run(ctx context.Context, target string) (*types.TestResult, e
 	return result, nil
 }
 
-func (c *DNSCheck) resolveWithTiming(ctx context.Context, name string) (types.DNSCheckDetails, error) {
+// lookup runs one query and records its answers, latency and any error,
+// including an answer that doesn't match the expected one.
+func lookup(ctx context.Context, query types.DNSQuery, conf *resolvConf) types.DNSCheckDetails {
 	details := types.DNSCheckDetails{
-		Query: name,
+		Query:    query.String(),
+		Server:   query.Server,
+		Type:     query.Type,
+		Expected: query.Expected,
 	}
 
 	start := time.Now()
+	answers, server, name, err := resolve(ctx, query, conf)
+	details.LatencyMS = float64(time.Since(start).Microseconds()) / 1000.0
+	details.Server = server
+	details.Name = name
 
-	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", name)
-	elapsed := time.Since(start)
+	if err == nil && query.Expected != "" && !containsAnswer(answers, query.Expected) {
+		err = fmt.Errorf("expected %s, got %s", query.Expected, strings.Join(answers, ", "))
+	}
+	if err != nil {
+		details.Error = err.Error()
+	}
 
-	details.LatencyMS = float64(elapsed.Microseconds()) / 1000.0
+	switch query.Type {
+	case "", "A", "AAAA":
+		details.ResolvedIPs = answers
+	default:
+		details.Answers = answers
+	}
 
-	if err != nil {
-		return details, err
+	return details
+}
+
+// resolve sends query to its server, or else to the nameservers of conf with
+// its search path applied, and returns the answers, the server that gave them
+// and the fully qualified name they are for. A name with a server of its own
+// is sent as-is.
+func resolve(ctx context.Context, query types.DNSQuery, conf *resolvConf) ([]string, string, string, error) {
+	qtypes := []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	if query.Type != "" {
+		qtypes = []dnsmessage.Type{dnsRecordTypes[query.Type]}
+	}
+
+	var names, servers []string
+	if ip := net.ParseIP(query.Name); ip != nil && query.Type == "PTR" {
+		names = []string{reverseName(ip)}
+	} else if query.Server != "" {
+		names = []string{strings.TrimSuffix(query.Name, ".") + "."}
+	} else {
+		names = conf.candidates(query.Name)
+	}
+	if query.Server != "" {
+		servers = []string{query.Server}
+	} else {
+		servers = conf.Nameservers
+		if len(servers) == 0 {
+			servers = []string{"127.0.0.1:53"}
+		}
+	}
+
+	var lastErr error
+	for _, name := range names {
+		var answers []string
+		var server string
+		nxdomain := false
+
+		for _, qtype := range qtypes {
+			resp, answeredBy, err := queryNameservers(ctx, servers, name, qtype)
+			if err != nil {
+				return nil, "", "", err
+			}
+			server = answeredBy
+
+			switch resp.RCode {
+			case dnsmessage.RCodeSuccess:
+				answers = append(answers, dnsAnswers(resp, qtype)...)
+			case dnsmessage.RCodeNameError:
+				nxdomain = true
+			default:
+				return nil, server, name, rcodeError(resp.RCode)
+			}
+		}
+
+		if len(answers) > 0 {
+			return answers, server, name, nil
+		}
+		if nxdomain {
+			lastErr = rcodeError(dnsmessage.RCodeNameError)
+		} else {
+			lastErr = fmt.Errorf("no %s records", recordTypeName(query.Type))
+		}
+		if ctx.Err() != nil {
+			return nil, server, name, ctx.Err()
+		}
+	}
+
+	return nil, "", "", lastErr
+}
+
+// queryNameservers asks each server in turn until one answers.
+func queryNameservers(ctx context.Context, servers []string, name string, qtype dnsmessage.Type) (*dnsmessage.Message, string, error) {
+	var lastErr error
+	for _, server := range servers {
+		queryCtx, cancel := context.WithTimeout(ctx, dnsQueryTimeout)
+		resp, err := dnsQuery(queryCtx, server, name, qtype)
+		cancel()
+		if err == nil {
+			return resp, server, nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		lastErr = fmt.Errorf("%s: %w", server, err)
+	}
+	return nil, "", lastErr
+}
+
+// containsAnswer reports whether expected is among answers, comparing IPs by
+// value and names without case or trailing dot.
+func containsAnswer(answers []string, expected string) bool {
+	expectedIP := net.ParseIP(expected)
+	for _, answer := range answers {
+		if expectedIP != nil {
+			if expectedIP.Equal(net.ParseIP(answer)) {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(strings.TrimSuffix(answer, "."), strings.TrimSuffix(expected, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+func recordTypeName(t string) string {
+	if t == "" {
+		return "A/AAAA"
+	}
+	return t
+}
+
+// queryServers sends every query without a server of its own to each server
+// in parallel.
+func (c *DNSCheck) queryServers(ctx context.Context, queries []types.DNSQuery) []types.DNSServerDetails {
+	results := make([]types.DNSServerDetails, len(c.Servers))
+
+	var wg sync.WaitGroup
+	for i, server := range c.Servers {
+		wg.Add(1)
+		go func(i int, server types.DNSServer) {
+			defer wg.Done()
+			results[i] = queryServer(ctx, server, queries)
+		}(i, server)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// queryServer runs the queries against one DNS server, bypassing the
+// servers in /etc/resolv.conf.
+func queryServer(ctx context.Context, server types.DNSServer, queries []types.DNSQuery) types.DNSServerDetails {
+	details := types.DNSServerDetails{
+		Name:     server.Name,
+		Address:  server.Address,
+		NodeName: server.NodeName,
+	}
+
+	var total float64
+	for _, query := range queries {
+		if query.Server != "" {
+			continue
+		}
+		query.Server = server.Address
+
+		lookup := lookup(ctx, query, nil)
+		details.Queries++
+		if lookup.Error != "" {
+			details.Failed++
+			details.Errors = append(details.Errors, fmt.Sprintf("%s: %s", query.Name, lookup.Error))
+			continue
+		}
+
+		total += lookup.LatencyMS
+		if lookup.LatencyMS > details.MaxLatencyMS {
+			details.MaxLatencyMS = lookup.LatencyMS
+		}
 	}
 
-	for _, ip := range ips {
-		details.ResolvedIPs = append(details.ResolvedIPs, ip.String())
+	if succeeded := details.Queries - details.Failed; succeeded > 0 {
+		details.AvgLatencyMS = total / float64(succeeded)
 	}
 
-	return details, nil
+	return details
+}
+
+// serverLabel names a DNS server in errors, e.g. "coredns-abc (10.42.1.5:53)
+// on node-1".
+func serverLabel(server types.DNSServerDetails) string {
+	label := fmt.Sprintf("%s (%s)", server.Name, server.Address)
+	if server.NodeName != "" {
+		label += " on " + server.NodeName
+	}
+	return label
 }
 
 func (c *DNSCheck) IsLocal() bool {
@@ -93,6 +368,17 @@ func (c *DNSCheck) AlwaysShow() bool {
 	return false
 }
 
+func (c *DNSCheck) DefaultTimeout() time.Duration {
+	timeout := DefaultDNSTimeout
+	if c.Transport {
+		timeout += transportTimeout(len(c.Names))
+	}
+	if c.Burst > 0 {
+		timeout += burstTimeout(len(c.Names), c.Burst)
+	}
+	return timeout
+}
+
 func (c *DNSCheck) FormatSummary(details interface{}, quiet bool) string {
 	if details == nil {
 		return ""
@@ -128,62 +414,121 @@ func (c *DNSCheck) FormatSummary(details interface{}, quiet bool) string {
 		}
 
 		query, _ := lookupMap["query"].(string)
-		resolvedIPsRaw, hasIPs := lookupMap["resolved_ips"]
 		latency, _ := lookupMap["latency_ms"].(float64)
+		lookupErr, _ := lookupMap["error"].(string)
 
-		if hasIPs {
-			resolvedIPs, ok := resolvedIPsRaw.([]interface{})
-			if ok && len(resolvedIPs) > 0 {
-				successCount++
+		// Address lookups report resolved_ips, other record types answers
+		answersRaw, _ := lookupMap["resolved_ips"].([]interface{})
+		if len(answersRaw) == 0 {
+			answersRaw, _ = lookupMap["answers"].([]interface{})
+		}
+		var answers []string
+		for _, answer := range answersRaw {
+			if answerStr, ok := answer.(string); ok {
+				answers = append(answers, answerStr)
 			}
 		}
 
+		ok = len(answers) > 0 && lookupErr == ""
+		if ok {
+			successCount++
+		}
+
 		if !quiet && query != "" {
-			if resolvedIPsRaw != nil {
-				if resolvedIPs, ok := resolvedIPsRaw.([]interface{}); ok && len(resolvedIPs) > 0 {
-					var ips []string
-					for _, ip := range resolvedIPs {
-						if ipStr, ok := ip.(string); ok {
-							ips = append(ips, ipStr)
-						}
-					}
-					lookupDetails = append(lookupDetails, fmt.Sprintf("%s: %s (%.2fms)", query, fmt.Sprintf("%v", ips), latency))
-				} else {
-					lookupDetails = append(lookupDetails, fmt.Sprintf("%s: failed", query))
-				}
+			if ok {
+				lookupDetails = append(lookupDetails, fmt.Sprintf("%s: %v (%.2fms)", query, answers, latency))
+			} else {
+				lookupDetails = append(lookupDetails, fmt.Sprintf("%s: failed", query))
 			}
 		}
 	}
 
 	summary := fmt.Sprintf("%d/%d lookups OK", successCount, len(lookups))
 	if !quiet && len(lookupDetails) > 0 {
-		return summary + " | " + strings.Join(lookupDetails, ", ")
+		summary += " | " + strings.Join(lookupDetails, ", ")
+	}
+	if servers := formatDNSServers(detailsMap["servers"], quiet); servers != "" {
+		summary += " | " + servers
+	}
+	if transports := formatDNSTransports(detailsMap["transports"], quiet); transports != "" {
+		summary += " | " + transports
+	}
+	if bursts := formatDNSBursts(detailsMap["bursts"], quiet); bursts != "" {
+		summary += " | " + bursts
 	}
 	return summary
 }
 
-func NewDNSCheck(names []string, networkType types.NetworkType) *DNSCheck {
+// formatDNSServers summarizes the per-server lookups, e.g. "servers: kube-dns
+// 2/2 1.20ms, coredns-abc 0/2". Quiet output only lists failing servers.
+func formatDNSServers(raw interface{}, quiet bool) string {
+	servers, ok := raw.([]interface{})
+	if !ok || len(servers) == 0 {
+		return ""
+	}
+
+	var parts []string
+	for _, s := range servers {
+		server, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := server["name"].(string)
+		queries, _ := server["queries"].(float64)
+		failed, _ := server["failed"].(float64)
+		avg, _ := server["avg_latency_ms"].(float64)
+
+		if quiet && failed == 0 {
+			continue
+		}
+		part := fmt.Sprintf("%s %d/%d", name, int(queries-failed), int(queries))
+		if failed < queries {
+			part += fmt.Sprintf(" %.2fms", avg)
+		}
+		if node, _ := server["node_name"].(string); node != "" && failed > 0 {
+			part += " on " + node
+		}
+		parts = append(parts, part)
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+	return "servers: " + strings.Join(parts, ", ")
+}
+
+// NewDNSCheck builds a dns check. Servers are only queried from the overlay,
+// since pods resolve through cluster DNS and host network pods don't.
+func NewDNSCheck(names []string, servers []types.DNSServer, networkType types.NetworkType) *DNSCheck {
 	if len(names) == 0 {
 		names = DefaultDNSNames
 	}
 	if networkType == types.NetworkTypeHost {
 		names = filterClusterLocalNames(names)
+		servers = nil
 	}
 	return &DNSCheck{
-		Names: names,
+		Names:     names,
+		Servers:   servers,
+		Conntrack: networkType == types.NetworkTypeHost,
 	}
 }
 
+// filterClusterLocalNames drops cluster.local queries sent through the local
+// resolver, which on the host network isn't cluster DNS. Queries to a given
+// server, and ones that don't parse, are kept.
 func filterClusterLocalNames(names []string) []string {
 	var filtered []string
 	for _, name := range names {
-		if !strings.HasSuffix(name, ".cluster.local") {
-			filtered = append(filtered, name)
+		query, err := types.ParseDNSQuery(name)
+		if err == nil && query.Server == "" && strings.HasSuffix(strings.TrimSuffix(query.Name, "."), ".cluster.local") {
+			continue
 		}
+		filtered = append(filtered, name)
 	}
 	return filtered
 }
 
 func init() {
-	types.DefaultRegistry.Register(NewDNSCheck(nil, ""))
+	types.DefaultRegistry.Register(NewDNSCheck(nil, nil, ""))
 }
@@ -0,0 +1,198 @@
+package checks
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestNewDNSCheck_Servers(t *testing.T) {
+	servers := []types.DNSServer{{Name: "kube-dns", Address: "10.43.0.10:53"}}
+
+	if got := NewDNSCheck(nil, servers, types.NetworkTypeOverlay).Servers; len(got) != 1 {
+		t.Errorf("overlay: %d servers, want 1", len(got))
+	}
+	if got := NewDNSCheck(nil, servers, types.NetworkTypeHost).Servers; got != nil {
+		t.Errorf("host network: servers = %v, want none", got)
+	}
+}
+
+func TestNewDNSCheck_Conntrack(t *testing.T) {
+	if NewDNSCheck(nil, nil, types.NetworkTypeOverlay).Conntrack {
+		t.Error("overlay: reads conntrack counters of its own network namespace")
+	}
+	if !NewDNSCheck(nil, nil, types.NetworkTypeHost).Conntrack {
+		t.Error("host network: doesn't read the node's conntrack counters")
+	}
+}
+
+func TestFormatDNSServers(t *testing.T) {
+	servers := []types.DNSServerDetails{
+		{Name: "kube-dns", Address: "10.43.0.10:53", Queries: 2, AvgLatencyMS: 1.5},
+		{Name: "coredns-b", Address: "10.42.1.5:53", NodeName: "node-2", Queries: 2, Failed: 2},
+	}
+
+	// FormatSummary sees details after a JSON round trip
+	data, err := json.Marshal(servers)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		quiet bool
+		want  string
+	}{
+		{"all servers", false, "servers: kube-dns 2/2 1.50ms, coredns-b 0/2 on node-2"},
+		{"quiet lists failures only", true, "servers: coredns-b 0/2 on node-2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatDNSServers(raw, tt.quiet); got != tt.want {
+				t.Errorf("formatDNSServers() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// startDNSServer serves A and SRV records for test.example. over UDP and TCP
+// on the same port. UDP answers to truncate.example. are truncated, so only
+// TCP gets the records.
+func startDNSServer(t *testing.T) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start UDP listener: %v", err)
+	}
+	ln, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		pc.Close()
+		t.Fatalf("Failed to start TCP listener: %v", err)
+	}
+	t.Cleanup(func() {
+		pc.Close()
+		ln.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := answerDNS(buf[:n], true); resp != nil {
+				pc.WriteTo(resp, addr)
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			var length [2]byte
+			if _, err := io.ReadFull(conn, length[:]); err == nil {
+				msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, msg); err == nil {
+					if resp := answerDNS(msg, false); resp != nil {
+						conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+					}
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	return pc.LocalAddr().String()
+}
+
+func answerDNS(raw []byte, udp bool) []byte {
+	var query dnsmessage.Message
+	if err := query.Unpack(raw); err != nil || len(query.Questions) != 1 {
+		return nil
+	}
+	q := query.Questions[0]
+
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true, RCode: dnsmessage.RCodeNameError},
+		Questions: query.Questions,
+	}
+	header := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: 30}
+
+	switch q.Name.String() {
+	case "test.example.":
+		resp.RCode = dnsmessage.RCodeSuccess
+		switch q.Type {
+		case dnsmessage.TypeA:
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: [4]byte{10, 43, 0, 1}}})
+		case dnsmessage.TypeSRV:
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.SRVResource{
+				Port:   443,
+				Target: dnsmessage.MustNewName("api.test.example."),
+			}})
+		}
+	case "truncate.example.":
+		resp.RCode = dnsmessage.RCodeSuccess
+		if udp {
+			resp.Truncated = true
+		} else if q.Type == dnsmessage.TypeA {
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: [4]byte{10, 0, 0, 2}}})
+		}
+	}
+
+	packed, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	return packed
+}
+
+func TestLookup(t *testing.T) {
+	server := startDNSServer(t)
+
+	tests := []struct {
+		name        string
+		query       types.DNSQuery
+		wantAnswers []string
+		wantErr     string
+	}{
+		{"A and AAAA", types.DNSQuery{Name: "test.example"}, []string{"10.43.0.1"}, ""},
+		{"expected answer", types.DNSQuery{Name: "test.example", Type: "A", Expected: "10.43.0.1"}, []string{"10.43.0.1"}, ""},
+		{"unexpected answer", types.DNSQuery{Name: "test.example", Type: "A", Expected: "10.43.0.10"}, []string{"10.43.0.1"}, "expected 10.43.0.10, got 10.43.0.1"},
+		{"SRV", types.DNSQuery{Name: "test.example", Type: "SRV", Expected: "api.test.example:443"}, []string{"api.test.example:443"}, ""},
+		{"no records", types.DNSQuery{Name: "test.example", Type: "CNAME"}, nil, "no CNAME records"},
+		{"NXDOMAIN", types.DNSQuery{Name: "missing.example", Type: "A"}, nil, "NXDOMAIN"},
+		{"truncated retries over TCP", types.DNSQuery{Name: "truncate.example", Type: "A"}, []string{"10.0.0.2"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Server = server
+			details := lookup(context.Background(), tt.query, nil)
+
+			if details.Error != tt.wantErr {
+				t.Errorf("error = %q, want %q", details.Error, tt.wantErr)
+			}
+			answers := append(details.ResolvedIPs, details.Answers...)
+			if !slices.Equal(answers, tt.wantAnswers) {
+				t.Errorf("answers = %v, want %v", answers, tt.wantAnswers)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package checks
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// dnsBurstConcurrency is how many query pairs of a burst are in flight at
+	// once.
+	dnsBurstConcurrency = 10
+
+	// dnsBurstRetryAfter is when a pair's unanswered query is sent again,
+	// glibc's default "options timeout:5". A lost query therefore shows up as
+	// an answer after 5s, as it does for applications.
+	dnsBurstRetryAfter = 5 * time.Second
+
+	// dnsBurstRetryTimeout is how long the retried query is given before the
+	// pair counts as timed out.
+	dnsBurstRetryTimeout = 2 * time.Second
+
+	// conntrackStatPath holds the conntrack counters of the agent's network
+	// namespace. Only the host network agent shares the node's, where the DNAT
+	// to the DNS Service and its insert race happen.
+	conntrackStatPath = "/proc/net/stat/nf_conntrack"
+)
+
+// dnsBurstBucketsMS are the upper bounds of the burst latency histogram.
+var dnsBurstBucketsMS = []float64{10, 100, 1000, 5000}
+
+// burstTimeout is how long a burst of pairs per lookup may take at worst.
+func burstTimeout(lookups, pairs int) time.Duration {
+	rounds := (pairs + dnsBurstConcurrency - 1) / dnsBurstConcurrency
+	return time.Duration(lookups*rounds) * (dnsBurstRetryAfter + dnsBurstRetryTimeout)
+}
+
+// runBurst sends pairs of parallel A and AAAA queries for a successful lookup
+// to the server that answered it. Like glibc, each pair shares one UDP socket
+// and source port, which is what triggers the conntrack insert race that
+// drops one of them. With conntrack set, the growth of the node's
+// insert_failed counter during the burst is recorded.
+func runBurst(ctx context.Context, lookup types.DNSCheckDetails, pairs int, conntrack bool) types.DNSBurstDetails {
+	details := types.DNSBurstDetails{
+		Query:  lookup.Query,
+		Server: lookup.Server,
+		Name:   lookup.Name,
+		Pairs:  pairs,
+	}
+
+	var insertFailedBefore int
+	if conntrack {
+		var err error
+		insertFailedBefore, err = readConntrackInsertFailed(conntrackStatPath)
+		conntrack = err == nil
+	}
+
+	latencies := make([]float64, pairs)
+	errs := make([]error, pairs)
+	sem := make(chan struct{}, dnsBurstConcurrency)
+
+	var wg sync.WaitGroup
+	for i := 0; i < pairs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+
+			start := time.Now()
+			errs[i] = dnsQueryPair(ctx, lookup.Server, lookup.Name)
+			latencies[i] = float64(time.Since(start).Microseconds()) / 1000.0
+		}(i)
+	}
+	wg.Wait()
+
+	if conntrack {
+		if after, err := readConntrackInsertFailed(conntrackStatPath); err == nil {
+			delta := after - insertFailedBefore
+			details.ConntrackInsertFailed = &delta
+		}
+	}
+
+	var answered []float64
+	for i, err := range errs {
+		if err != nil {
+			details.Timeouts++
+			if details.Error == "" {
+				details.Error = err.Error()
+			}
+			continue
+		}
+		answered = append(answered, latencies[i])
+	}
+	summarizeBurst(&details, answered)
+
+	return details
+}
+
+// summarizeBurst fills the latency statistics and histogram of the answered
+// pairs.
+func summarizeBurst(details *types.DNSBurstDetails, latencies []float64) {
+	details.Answered = len(latencies)
+
+	details.Histogram = make([]types.LatencyBucket, len(dnsBurstBucketsMS)+1)
+	for i, le := range dnsBurstBucketsMS {
+		details.Histogram[i].LeMS = le
+	}
+	if len(latencies) == 0 {
+		return
+	}
+
+	sort.Float64s(latencies)
+
+	var total float64
+	for _, latency := range latencies {
+		total += latency
+		if latency > 1000 {
+			details.Over1s++
+		}
+		if latency > 5000 {
+			details.Over5s++
+		}
+
+		bucket := len(dnsBurstBucketsMS)
+		for i, le := range dnsBurstBucketsMS {
+			if latency <= le {
+				bucket = i
+				break
+			}
+		}
+		details.Histogram[bucket].Count++
+	}
+
+	details.MinLatencyMS = latencies[0]
+	details.MaxLatencyMS = latencies[len(latencies)-1]
+	details.AvgLatencyMS = total / float64(len(latencies))
+	details.P50LatencyMS = percentile(latencies, 50)
+	details.P99LatencyMS = percentile(latencies, 99)
+	details.Over1sPercent = float64(details.Over1s) / float64(details.Pairs) * 100
+	details.Over5sPercent = float64(details.Over5s) / float64(details.Pairs) * 100
+}
+
+// percentile returns the nearest-rank percentile of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// dnsQueryPair sends an A and an AAAA query for name from one UDP socket at
+// the same time and waits for both answers, sending an unanswered query again
+// after dnsBurstRetryAfter.
+func dnsQueryPair(ctx context.Context, server, name string) error {
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return fmt.Errorf("invalid name %q: %w", name, err)
+	}
+
+	queries := make(map[uint16][]byte, 2)
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		id := uint16(rand.Uint32())
+		for queries[id] != nil {
+			id++
+		}
+		msg := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+			Questions: []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+		}
+		packed, err := msg.Pack()
+		if err != nil {
+			return err
+		}
+		queries[id] = packed
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	pending := queries
+	buf := make([]byte, dnsUDPReadSize)
+	for _, wait := range []time.Duration{dnsBurstRetryAfter, dnsBurstRetryTimeout} {
+		for _, packed := range pending {
+			if _, err := conn.Write(packed); err != nil {
+				return err
+			}
+		}
+
+		conn.SetReadDeadline(time.Now().Add(wait))
+		for len(pending) > 0 {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if errors.Is(err, os.ErrDeadlineExceeded) {
+					break
+				}
+				return err
+			}
+			if n >= 2 {
+				delete(pending, binary.BigEndian.Uint16(buf))
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%d of 2 queries unanswered after a retry", len(pending))
+}
+
+// readConntrackInsertFailed sums the per-CPU insert_failed counters of a
+// /proc/net/stat/nf_conntrack file.
+func readConntrackInsertFailed(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	column := -1
+	for i, header := range strings.Fields(lines[0]) {
+		if header == "insert_failed" {
+			column = i
+		}
+	}
+	if column < 0 {
+		return 0, fmt.Errorf("no insert_failed column in %s", path)
+	}
+
+	total := 0
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if column >= len(fields) {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[column], 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid insert_failed value %q: %w", fields[column], err)
+		}
+		total += int(value)
+	}
+	return total, nil
+}
+
+// formatDNSBursts summarizes the bursts, e.g. "burst: google.com 98/100
+// answered, 2 timeouts, 3% >1s, 1% >5s, p99 5004.12ms, conntrack
+// insert_failed +2". Quiet output only lists bursts with slow or lost
+// answers.
+func formatDNSBursts(raw interface{}, quiet bool) string {
+	bursts, ok := raw.([]interface{})
+	if !ok || len(bursts) == 0 {
+		return ""
+	}
+
+	var parts []string
+	for _, b := range bursts {
+		burst, ok := b.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		query, _ := burst["query"].(string)
+		pairs, _ := burst["pairs"].(float64)
+		answered, _ := burst["answered"].(float64)
+		timeouts, _ := burst["timeouts"].(float64)
+		over1s, _ := burst["over_1s_percent"].(float64)
+		over5s, _ := burst["over_5s_percent"].(float64)
+		p99, _ := burst["p99_latency_ms"].(float64)
+
+		if quiet && timeouts == 0 && over1s == 0 {
+			continue
+		}
+
+		part := fmt.Sprintf("%s %d/%d answered", query, int(answered), int(pairs))
+		if timeouts > 0 {
+			part += fmt.Sprintf(", %d timeouts", int(timeouts))
+		}
+		part += fmt.Sprintf(", %.0f%% >1s, %.0f%% >5s, p99 %.2fms", over1s, over5s, p99)
+		if insertFailed, ok := burst["conntrack_insert_failed"].(float64); ok && insertFailed > 0 {
+			part += fmt.Sprintf(", conntrack insert_failed +%d", int(insertFailed))
+		}
+		parts = append(parts, part)
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+	return "burst: " + strings.Join(parts, "; ")
+}
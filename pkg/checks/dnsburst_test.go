@@ -0,0 +1,102 @@
+package checks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+func TestRunBurst(t *testing.T) {
+	server := startDNSServer(t)
+
+	details := runBurst(context.Background(), types.DNSCheckDetails{
+		Query:  "test.example",
+		Server: server,
+		Name:   "test.example.",
+	}, 25, false)
+
+	if details.Answered != 25 || details.Timeouts != 0 {
+		t.Fatalf("got %d answered, %d timeouts, want 25 answered: %s", details.Answered, details.Timeouts, details.Error)
+	}
+	total := 0
+	for _, bucket := range details.Histogram {
+		total += bucket.Count
+	}
+	if total != 25 {
+		t.Errorf("histogram holds %d pairs, want 25", total)
+	}
+	if details.ConntrackInsertFailed != nil {
+		t.Errorf("conntrack insert_failed = %d without conntrack, want unset", *details.ConntrackInsertFailed)
+	}
+}
+
+func TestSummarizeBurst(t *testing.T) {
+	details := types.DNSBurstDetails{Pairs: 5}
+	summarizeBurst(&details, []float64{5002, 3, 40, 1500, 8})
+
+	if details.Answered != 5 {
+		t.Errorf("Answered = %d, want 5", details.Answered)
+	}
+	if details.Over1s != 2 || details.Over5s != 1 {
+		t.Errorf("Over1s, Over5s = %d, %d, want 2, 1", details.Over1s, details.Over5s)
+	}
+	if details.Over1sPercent != 40 || details.Over5sPercent != 20 {
+		t.Errorf("Over1sPercent, Over5sPercent = %v, %v, want 40, 20", details.Over1sPercent, details.Over5sPercent)
+	}
+	if details.MinLatencyMS != 3 || details.MaxLatencyMS != 5002 || details.P50LatencyMS != 40 || details.P99LatencyMS != 5002 {
+		t.Errorf("min/p50/p99/max = %v/%v/%v/%v, want 3/40/5002/5002",
+			details.MinLatencyMS, details.P50LatencyMS, details.P99LatencyMS, details.MaxLatencyMS)
+	}
+
+	want := []types.LatencyBucket{{LeMS: 10, Count: 2}, {LeMS: 100, Count: 1}, {LeMS: 1000}, {LeMS: 5000, Count: 1}, {Count: 1}}
+	if len(details.Histogram) != len(want) {
+		t.Fatalf("got %d buckets, want %d", len(details.Histogram), len(want))
+	}
+	for i := range want {
+		if details.Histogram[i] != want[i] {
+			t.Errorf("bucket %d = %+v, want %+v", i, details.Histogram[i], want[i])
+		}
+	}
+}
+
+func TestReadConntrackInsertFailed(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "sums CPUs",
+			content: "entries  searched  found  new  invalid  ignore  delete  delete_list  insert  insert_failed  drop  early_drop  icmp_error  expect_new  expect_create  expect_delete  search_restart\n" +
+				"000001a4  00000000  00000000  00000000  00000003  00000000  00000000  00000000  00000000  0000000a  00000000  00000000  00000000  00000000  00000000  00000000  00000000\n" +
+				"000001a4  00000000  00000000  00000000  00000001  00000000  00000000  00000000  00000000  00000002  00000000  00000000  00000000  00000000  00000000  00000000  00000000\n",
+			want: 12,
+		},
+		{
+			name:    "no insert_failed column",
+			content: "entries  searched  found\n00000001  00000000  00000000\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "nf_conntrack")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readConntrackInsertFailed(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readConntrackInsertFailed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("readConntrackInsertFailed() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
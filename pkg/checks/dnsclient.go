@@ -0,0 +1,206 @@
+package checks
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsUDPReadSize is how much of a UDP DNS response is read. Without EDNS0 a
+// server sends at most 512 bytes and sets the TC bit on anything bigger; with
+// it, up to the advertised buffer size.
+const dnsUDPReadSize = 65535
+
+// dnsRecordTypes maps the record types of types.DNSRecordTypes to their wire
+// values.
+var dnsRecordTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"SRV":   dnsmessage.TypeSRV,
+	"PTR":   dnsmessage.TypePTR,
+	"CNAME": dnsmessage.TypeCNAME,
+}
+
+// dnsQuery sends one question to server over UDP and, if the answer comes
+// back truncated, again over TCP as a stub resolver would.
+func dnsQuery(ctx context.Context, server, name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	resp, _, err := dnsExchange(ctx, "udp", server, name, qtype, 0)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Truncated {
+		resp, _, err = dnsExchange(ctx, "tcp", server, name, qtype, 0)
+	}
+	return resp, err
+}
+
+// dnsExchange sends one question to server over network ("udp" or "tcp") and
+// returns the response and its size on the wire. A non-zero ednsSize adds an
+// EDNS0 OPT record advertising that UDP buffer size.
+func dnsExchange(ctx context.Context, network, server, name string, qtype dnsmessage.Type, ednsSize int) (*dnsmessage.Message, int, error) {
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid name %q: %w", name, err)
+	}
+
+	id := uint16(rand.Uint32())
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  qname,
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	if ednsSize > 0 {
+		var opt dnsmessage.ResourceHeader
+		if err := opt.SetEDNS0(ednsSize, dnsmessage.RCodeSuccess, false); err != nil {
+			return nil, 0, err
+		}
+		query.Additionals = append(query.Additionals, dnsmessage.Resource{Header: opt, Body: &dnsmessage.OPTResource{}})
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Unblock reads when the run is cancelled
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var raw []byte
+	if network == "tcp" {
+		raw, err = dnsExchangeTCP(conn, packed)
+	} else {
+		raw, err = dnsExchangeUDP(conn, packed, id)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+		return nil, 0, err
+	}
+
+	var resp dnsmessage.Message
+	if err := resp.Unpack(raw); err != nil {
+		return nil, 0, fmt.Errorf("invalid response: %w", err)
+	}
+	if resp.ID != id {
+		return nil, 0, errors.New("response ID mismatch")
+	}
+	return &resp, len(raw), nil
+}
+
+// dnsExchangeUDP writes the query and reads until a response with the query's
+// ID arrives, skipping stray datagrams.
+func dnsExchangeUDP(conn net.Conn, packed []byte, id uint16) ([]byte, error) {
+	if _, err := conn.Write(packed); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, dnsUDPReadSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if n >= 2 && binary.BigEndian.Uint16(buf) == id {
+			return buf[:n], nil
+		}
+	}
+}
+
+// dnsExchangeTCP writes the length-prefixed query and reads one response.
+func dnsExchangeTCP(conn net.Conn, packed []byte) ([]byte, error) {
+	msg := binary.BigEndian.AppendUint16(nil, uint16(len(packed)))
+	if _, err := conn.Write(append(msg, packed...)); err != nil {
+		return nil, err
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	raw := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// dnsAnswers returns the answers of type qtype in resp: IPs for A and AAAA,
+// names for PTR and CNAME, and target:port for SRV.
+func dnsAnswers(resp *dnsmessage.Message, qtype dnsmessage.Type) []string {
+	var answers []string
+	for _, rr := range resp.Answers {
+		if rr.Header.Type != qtype {
+			continue
+		}
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			answers = append(answers, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			answers = append(answers, net.IP(body.AAAA[:]).String())
+		case *dnsmessage.CNAMEResource:
+			answers = append(answers, strings.TrimSuffix(body.CNAME.String(), "."))
+		case *dnsmessage.PTRResource:
+			answers = append(answers, strings.TrimSuffix(body.PTR.String(), "."))
+		case *dnsmessage.SRVResource:
+			target := strings.TrimSuffix(body.Target.String(), ".")
+			answers = append(answers, net.JoinHostPort(target, strconv.Itoa(int(body.Port))))
+		}
+	}
+	return answers
+}
+
+// rcodeError describes a failed response code the way dig prints it.
+func rcodeError(rcode dnsmessage.RCode) error {
+	switch rcode {
+	case dnsmessage.RCodeNameError:
+		return errors.New("NXDOMAIN")
+	case dnsmessage.RCodeServerFailure:
+		return errors.New("SERVFAIL")
+	case dnsmessage.RCodeRefused:
+		return errors.New("REFUSED")
+	case dnsmessage.RCodeFormatError:
+		return errors.New("FORMERR")
+	}
+	return fmt.Errorf("rcode %d", rcode)
+}
+
+// reverseName returns the in-addr.arpa or ip6.arpa name of ip for PTR
+// lookups.
+func reverseName(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", v4[3], v4[2], v4[1], v4[0])
+	}
+
+	const hex = "0123456789abcdef"
+	var b strings.Builder
+	for i := len(ip) - 1; i >= 0; i-- {
+		b.WriteByte(hex[ip[i]&0x0f])
+		b.WriteByte('.')
+		b.WriteByte(hex[ip[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String()
+}
@@ -0,0 +1,400 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// dnsRecordsAttempts is how often the records are resolved before a
+	// mismatch counts, since CoreDNS may not have seen the new Service's
+	// endpoints yet.
+	dnsRecordsAttempts = 5
+
+	// dnsRecordsRetryInterval is the pause between attempts.
+	dnsRecordsRetryInterval = time.Second
+)
+
+type DNSRecordsCheck struct {
+	Test        *types.DNSRecordsTest
+	NetworkType types.NetworkType
+
+	// resolvConf is read for the nameservers on the overlay network. Defaults
+	// to resolvConfPath.
+	resolvConf string
+}
+
+func (c *DNSRecordsCheck) Name() string {
+	return "dnsrecords"
+}
+
+func (c *DNSRecordsCheck) Description() string {
+	return "Resolves a temporary headless Service in front of the overlay agents and checks that its A records are exactly the agents' pod IPs, that its SRV records list every agent on the named port, and that every agent's endpoint and pod A records point at it. Reports stale and missing endpoints."
+}
+
+func (c *DNSRecordsCheck) Run(ctx context.Context, target string) (*types.TestResult, error) {
+	result := &types.TestResult{
+		Check:  c.Name(),
+		Target: target,
+		Status: types.StatusPass,
+	}
+
+	if c.Test == nil || c.Test.Service == "" {
+		result.Status = types.StatusFail
+		result.Error = "no headless Service in the run config"
+		return result, nil
+	}
+
+	servers, err := c.servers()
+	if err != nil {
+		result.Status = types.StatusFail
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	details := types.DNSRecordsDetails{
+		Service: c.Test.Service,
+		Server:  strings.Join(servers, ", "),
+	}
+
+	for attempt := 0; attempt < dnsRecordsAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(dnsRecordsRetryInterval):
+			}
+		}
+
+		details.Records = expectedRecords(c.Test)
+		for i := range details.Records {
+			verifyRecord(ctx, servers, &details.Records[i])
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		details.Issues = recordIssues(details.Records, c.Test.Pods)
+		if len(details.Issues) == 0 {
+			break
+		}
+	}
+
+	if len(details.Issues) > 0 {
+		result.Status = types.StatusFail
+		result.Error = strings.Join(details.Issues, "; ")
+	}
+
+	result.Details = map[string]interface{}{
+		"dnsrecords": details,
+	}
+
+	return result, nil
+}
+
+// servers returns the DNS servers to query: the nameservers of the pod's
+// resolv.conf on the overlay, and the kube-dns VIP on the host network, where
+// resolv.conf points at the node's upstream resolvers.
+func (c *DNSRecordsCheck) servers() ([]string, error) {
+	if c.NetworkType == types.NetworkTypeHost {
+		if c.Test.Server == "" {
+			return nil, fmt.Errorf("no cluster DNS server to query from the host network")
+		}
+		return []string{c.Test.Server}, nil
+	}
+
+	path := c.resolvConf
+	if path == "" {
+		path = resolvConfPath
+	}
+	conf, err := readResolvConf(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(conf.Nameservers) == 0 {
+		return nil, fmt.Errorf("no nameservers in %s", path)
+	}
+	return conf.Nameservers, nil
+}
+
+// expectedRecords lists the records of the headless Service and its pods with
+// their expected answers: the Service's A records and the SRV records of its
+// named port, which must cover every pod, and each pod's endpoint record
+// under the Service and its own pod record, which must be its IP.
+func expectedRecords(test *types.DNSRecordsTest) []types.DNSRecordDetails {
+	service := strings.TrimSuffix(test.Service, ".")
+
+	serviceRecord := types.DNSRecordDetails{
+		Kind: "service",
+		Name: service + ".",
+		Type: "A",
+	}
+	srvRecord := types.DNSRecordDetails{
+		Kind: "srv",
+		Name: fmt.Sprintf("_%s._tcp.%s.", test.PortName, service),
+		Type: "SRV",
+	}
+
+	var podRecords []types.DNSRecordDetails
+	for _, pod := range test.Pods {
+		ip := net.ParseIP(pod.IP)
+		if ip == nil {
+			continue
+		}
+		qtype := "A"
+		if ip.To4() == nil {
+			qtype = "AAAA"
+			serviceRecord.Type = "AAAA"
+		}
+		dashed := dashedIP(ip)
+
+		serviceRecord.Expected = append(serviceRecord.Expected, ip.String())
+		srvRecord.Expected = append(srvRecord.Expected, net.JoinHostPort(dashed+"."+service, strconv.Itoa(test.Port)))
+
+		podRecords = append(podRecords,
+			types.DNSRecordDetails{
+				Kind:     "endpoint",
+				Name:     dashed + "." + service + ".",
+				Type:     qtype,
+				NodeName: pod.NodeName,
+				Expected: []string{ip.String()},
+			},
+			types.DNSRecordDetails{
+				Kind:     "pod",
+				Name:     fmt.Sprintf("%s.%s.pod.cluster.local.", dashed, test.Namespace),
+				Type:     qtype,
+				NodeName: pod.NodeName,
+				Expected: []string{ip.String()},
+			},
+		)
+	}
+	sort.Strings(serviceRecord.Expected)
+	sort.Strings(srvRecord.Expected)
+
+	return append([]types.DNSRecordDetails{serviceRecord, srvRecord}, podRecords...)
+}
+
+// dashedIP is the form of an IP CoreDNS uses in pod and endpoint names, e.g.
+// 10-42-1-5.
+func dashedIP(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return strings.ReplaceAll(v4.String(), ".", "-")
+	}
+	return strings.ReplaceAll(ip.String(), ":", "-")
+}
+
+// verifyRecord looks up one record and compares the answers with the
+// expected ones.
+func verifyRecord(ctx context.Context, servers []string, record *types.DNSRecordDetails) {
+	qtype := dnsRecordTypes[record.Type]
+
+	start := time.Now()
+	resp, _, err := queryNameservers(ctx, servers, record.Name, qtype)
+	record.LatencyMS = float64(time.Since(start).Microseconds()) / 1000.0
+
+	switch {
+	case err != nil:
+		record.Error = err.Error()
+		return
+	case resp.RCode != dnsmessage.RCodeSuccess:
+		record.Error = rcodeError(resp.RCode).Error()
+		return
+	}
+
+	record.Answers = dnsAnswers(resp, qtype)
+	sort.Strings(record.Answers)
+	record.Missing, record.Stale = diffAnswers(record.Expected, record.Answers)
+}
+
+// diffAnswers returns the expected answers missing from answers, and the
+// answers that weren't expected.
+func diffAnswers(expected, answers []string) ([]string, []string) {
+	var missing, stale []string
+	for _, want := range expected {
+		if !containsAnswer(answers, want) {
+			missing = append(missing, want)
+		}
+	}
+	for _, got := range answers {
+		if !containsAnswer(expected, got) {
+			stale = append(stale, got)
+		}
+	}
+	return missing, stale
+}
+
+// recordIssues describes the failed records, naming the node of every
+// missing endpoint.
+func recordIssues(records []types.DNSRecordDetails, pods []types.TargetNode) []string {
+	nodes := make(map[string]string)
+	for _, pod := range pods {
+		ip := net.ParseIP(pod.IP)
+		if ip == nil {
+			continue
+		}
+		nodes[ip.String()] = pod.NodeName
+		nodes[dashedIP(ip)] = pod.NodeName
+	}
+
+	// describe adds the node to an IP or SRV target of a known pod
+	describe := func(answer string) string {
+		key := answer
+		if host, _, err := net.SplitHostPort(answer); err == nil {
+			key, _, _ = strings.Cut(host, ".")
+		}
+		if node, ok := nodes[key]; ok {
+			return fmt.Sprintf("%s (%s)", answer, node)
+		}
+		return answer
+	}
+
+	var issues []string
+	for _, record := range records {
+		label := fmt.Sprintf("%s %s", strings.TrimSuffix(record.Name, "."), record.Type)
+		if record.NodeName != "" {
+			label = fmt.Sprintf("%s record of %s's pod", record.Kind, record.NodeName)
+		}
+
+		if record.Error != "" {
+			issue := fmt.Sprintf("%s: %s", label, record.Error)
+			if record.Kind == "pod" && record.Error == rcodeError(dnsmessage.RCodeNameError).Error() {
+				issue += " (are pod records disabled in the CoreDNS kubernetes plugin?)"
+			}
+			issues = append(issues, issue)
+			continue
+		}
+
+		var problems []string
+		if len(record.Missing) > 0 {
+			missing := make([]string, len(record.Missing))
+			for i, answer := range record.Missing {
+				missing[i] = describe(answer)
+			}
+			problems = append(problems, "missing "+strings.Join(missing, ", "))
+		}
+		if len(record.Stale) > 0 {
+			problems = append(problems, "stale "+strings.Join(record.Stale, ", "))
+		}
+		if len(problems) > 0 {
+			issues = append(issues, fmt.Sprintf("%s: %s", label, strings.Join(problems, "; ")))
+		}
+	}
+
+	return issues
+}
+
+func (c *DNSRecordsCheck) IsLocal() bool {
+	return true
+}
+
+func (c *DNSRecordsCheck) HostNetworkOnly() bool {
+	return false
+}
+
+func (c *DNSRecordsCheck) AlwaysShow() bool {
+	return false
+}
+
+// DefaultTimeout covers every attempt timing out on all records: the
+// Service's A and SRV records and two per pod.
+func (c *DNSRecordsCheck) DefaultTimeout() time.Duration {
+	pods := 0
+	if c.Test != nil {
+		pods = len(c.Test.Pods)
+	}
+	lookups := 2*pods + 2
+	attempt := time.Duration(lookups)*dnsQueryTimeout + dnsRecordsRetryInterval
+	return max(DefaultDNSRecordsTimeout, dnsRecordsAttempts*attempt)
+}
+
+// FormatSummary counts the matching records of each kind, e.g. "service A
+// 3/3, SRV 3/3, endpoint A 3/3, pod A 2/3".
+func (c *DNSRecordsCheck) FormatSummary(details interface{}, quiet bool) string {
+	detailsMap, ok := details.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	rd, ok := detailsMap["dnsrecords"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	records, _ := rd["records"].([]interface{})
+
+	kinds := []string{"service", "srv", "endpoint", "pod"}
+	labels := map[string]string{"service": "service", "srv": "SRV", "endpoint": "endpoint", "pod": "pod"}
+	matched := make(map[string]int)
+	total := make(map[string]int)
+	qtypes := make(map[string]string)
+	stale := 0
+
+	for _, r := range records {
+		record, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		kind, _ := record["kind"].(string)
+		qtype, _ := record["type"].(string)
+		recordErr, _ := record["error"].(string)
+		expected, _ := record["expected"].([]interface{})
+		missing, _ := record["missing"].([]interface{})
+		staleAnswers, _ := record["stale"].([]interface{})
+		qtypes[kind] = qtype
+		stale += len(staleAnswers)
+
+		switch kind {
+		case "service", "srv":
+			// Count the pods among the Service's answers
+			total[kind] += len(expected)
+			if recordErr == "" {
+				matched[kind] += len(expected) - len(missing)
+			}
+		default:
+			total[kind]++
+			if recordErr == "" && len(missing) == 0 && len(staleAnswers) == 0 {
+				matched[kind]++
+			}
+		}
+	}
+
+	var parts []string
+	for _, kind := range kinds {
+		if _, ok := qtypes[kind]; !ok {
+			continue
+		}
+		label := labels[kind]
+		if kind != "srv" {
+			label += " " + qtypes[kind]
+		}
+		parts = append(parts, fmt.Sprintf("%s %d/%d", label, matched[kind], total[kind]))
+	}
+	summary := strings.Join(parts, ", ")
+
+	if stale > 0 {
+		summary += fmt.Sprintf(", %d stale", stale)
+	}
+	if !quiet {
+		if server, _ := rd["server"].(string); server != "" {
+			summary += " via " + server
+		}
+	}
+	return summary
+}
+
+func NewDNSRecordsCheck(test *types.DNSRecordsTest, networkType types.NetworkType) *DNSRecordsCheck {
+	return &DNSRecordsCheck{
+		Test:        test,
+		NetworkType: networkType,
+	}
+}
+
+func init() {
+	types.DefaultRegistry.Register(NewDNSRecordsCheck(nil, ""))
+}
@@ -0,0 +1,101 @@
+package checks
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+var testDNSRecordsPods = []types.TargetNode{
+	{NodeName: "node-2", IP: "10.42.1.5"},
+	{NodeName: "node-1", IP: "10.42.0.7"},
+}
+
+func TestExpectedRecords(t *testing.T) {
+	records := expectedRecords(&types.DNSRecordsTest{
+		Service:   "netdebug-headless.netdebug.svc.cluster.local",
+		Namespace: "netdebug",
+		PortName:  "http",
+		Port:      9797,
+		Pods:      testDNSRecordsPods,
+	})
+
+	want := []types.DNSRecordDetails{
+		{Kind: "service", Name: "netdebug-headless.netdebug.svc.cluster.local.", Type: "A", Expected: []string{"10.42.0.7", "10.42.1.5"}},
+		{Kind: "srv", Name: "_http._tcp.netdebug-headless.netdebug.svc.cluster.local.", Type: "SRV", Expected: []string{
+			"10-42-0-7.netdebug-headless.netdebug.svc.cluster.local:9797",
+			"10-42-1-5.netdebug-headless.netdebug.svc.cluster.local:9797",
+		}},
+		{Kind: "endpoint", Name: "10-42-1-5.netdebug-headless.netdebug.svc.cluster.local.", Type: "A", NodeName: "node-2", Expected: []string{"10.42.1.5"}},
+		{Kind: "pod", Name: "10-42-1-5.netdebug.pod.cluster.local.", Type: "A", NodeName: "node-2", Expected: []string{"10.42.1.5"}},
+		{Kind: "endpoint", Name: "10-42-0-7.netdebug-headless.netdebug.svc.cluster.local.", Type: "A", NodeName: "node-1", Expected: []string{"10.42.0.7"}},
+		{Kind: "pod", Name: "10-42-0-7.netdebug.pod.cluster.local.", Type: "A", NodeName: "node-1", Expected: []string{"10.42.0.7"}},
+	}
+
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d", len(records), len(want))
+	}
+	for i := range want {
+		got := records[i]
+		if got.Kind != want[i].Kind || got.Name != want[i].Name || got.Type != want[i].Type || got.NodeName != want[i].NodeName || !slices.Equal(got.Expected, want[i].Expected) {
+			t.Errorf("record %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestRecordIssues(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []types.DNSRecordDetails
+		want    []string
+	}{
+		{
+			name: "all records match",
+			records: []types.DNSRecordDetails{
+				{Kind: "service", Name: "svc.", Type: "A", Expected: []string{"10.42.0.7", "10.42.1.5"}, Answers: []string{"10.42.0.7", "10.42.1.5"}},
+			},
+		},
+		{
+			name: "missing and stale endpoints",
+			records: []types.DNSRecordDetails{
+				{Kind: "service", Name: "svc.", Type: "A", Missing: []string{"10.42.1.5"}, Stale: []string{"10.42.2.9"}},
+				{Kind: "srv", Name: "_http._tcp.svc.", Type: "SRV", Missing: []string{"10-42-1-5.svc:9797"}},
+			},
+			want: []string{
+				"svc A: missing 10.42.1.5 (node-2); stale 10.42.2.9",
+				"_http._tcp.svc SRV: missing 10-42-1-5.svc:9797 (node-2)",
+			},
+		},
+		{
+			name: "pod records disabled",
+			records: []types.DNSRecordDetails{
+				{Kind: "pod", Name: "10-42-0-7.netdebug.pod.cluster.local.", Type: "A", NodeName: "node-1", Error: "NXDOMAIN"},
+			},
+			want: []string{"pod record of node-1's pod: NXDOMAIN (are pod records disabled in the CoreDNS kubernetes plugin?)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := recordIssues(tt.records, testDNSRecordsPods)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("recordIssues() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDNSRecordsCheck_DefaultTimeout(t *testing.T) {
+	if got := NewDNSRecordsCheck(nil, "").DefaultTimeout(); got != DefaultDNSRecordsTimeout {
+		t.Errorf("DefaultTimeout() without pods = %s, want %s", got, DefaultDNSRecordsTimeout)
+	}
+
+	pods := make([]types.TargetNode, 10)
+	check := NewDNSRecordsCheck(&types.DNSRecordsTest{Pods: pods}, types.NetworkTypeOverlay)
+	// 22 lookups of 2s and a 1s pause, 5 times
+	if got, want := check.DefaultTimeout(), 225*time.Second; got != want {
+		t.Errorf("DefaultTimeout() for 10 pods = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,214 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsTransportProbes are the ways each lookup is sent again when transport
+// testing is on: plain UDP, which is truncated at 512 bytes, UDP with the
+// DNS Flag Day 2020 EDNS0 buffer and with a buffer large enough to need IP
+// fragments, and TCP.
+var dnsTransportProbes = []types.DNSTransportProbe{
+	{Transport: "udp"},
+	{Transport: "udp", EDNSSize: 1232},
+	{Transport: "udp", EDNSSize: 4096},
+	{Transport: "tcp"},
+}
+
+// defaultFragmentMTU is assumed for the route to a server when its MTU can't
+// be read.
+const defaultFragmentMTU = 1500
+
+// transportTimeout is how long the transport probes of the lookups may take
+// at worst.
+func transportTimeout(lookups int) time.Duration {
+	return time.Duration(lookups*len(dnsTransportProbes)) * dnsQueryTimeout
+}
+
+// probeTransports sends a successful lookup to the server that answered it
+// once per transport probe, without falling back between transports.
+func probeTransports(ctx context.Context, lookup types.DNSCheckDetails) types.DNSTransportDetails {
+	qtype := lookup.Type
+	if qtype == "" {
+		qtype = "A"
+	}
+
+	details := types.DNSTransportDetails{
+		Query:  lookup.Query,
+		Server: lookup.Server,
+		Name:   lookup.Name,
+		Type:   qtype,
+	}
+
+	// The MTU of the route to the server tells which answers need fragments
+	if host, _, err := net.SplitHostPort(lookup.Server); err == nil {
+		if _, mtu, err := routeMTU(ctx, host); err == nil {
+			details.MTU = mtu
+		}
+	}
+
+	for _, probe := range dnsTransportProbes {
+		queryCtx, cancel := context.WithTimeout(ctx, dnsQueryTimeout)
+		start := time.Now()
+		resp, size, err := dnsExchange(queryCtx, probe.Transport, lookup.Server, lookup.Name, dnsRecordTypes[qtype], probe.EDNSSize)
+		probe.LatencyMS = float64(time.Since(start).Microseconds()) / 1000.0
+		cancel()
+
+		switch {
+		case err != nil:
+			probe.Error = err.Error()
+		case resp.RCode != dnsmessage.RCodeSuccess:
+			probe.Error = rcodeError(resp.RCode).Error()
+		default:
+			probe.Size = size
+			probe.Truncated = resp.Truncated
+			probe.Answers = len(dnsAnswers(resp, dnsRecordTypes[qtype]))
+		}
+		details.Probes = append(details.Probes, probe)
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	details.Issues = transportIssues(details)
+	return details
+}
+
+// transportIssues explains failed probes: TCP/53 being blocked, worst when
+// UDP answers come back truncated, and large EDNS0 answers getting lost while
+// small ones arrive, which points at dropped IP fragments.
+func transportIssues(details types.DNSTransportDetails) []string {
+	var plainUDP, tcp *types.DNSTransportProbe
+	truncated := false
+	for i := range details.Probes {
+		probe := &details.Probes[i]
+		switch {
+		case probe.Transport == "tcp":
+			tcp = probe
+		case probe.EDNSSize == 0:
+			plainUDP = probe
+		}
+		if probe.Truncated {
+			truncated = true
+		}
+	}
+
+	var issues []string
+	for _, probe := range details.Probes {
+		if probe.Error == "" {
+			continue
+		}
+
+		var issue string
+		switch {
+		case probe.Transport == "tcp":
+			issue = fmt.Sprintf("TCP to %s failed: %s", details.Server, probe.Error)
+			if truncated {
+				issue += ", so truncated UDP answers can't be retried"
+			}
+		case probe.EDNSSize > 0 && plainUDP != nil && plainUDP.Error == "":
+			issue = fmt.Sprintf("UDP with a %d-byte EDNS0 buffer failed while plain UDP works: %s", probe.EDNSSize, probe.Error)
+			mtu := details.MTU
+			if mtu == 0 {
+				mtu = defaultFragmentMTU
+			}
+			if tcp != nil && tcp.Size > maxUnfragmentedDNS(details.Server, mtu) {
+				issue += fmt.Sprintf("; the %d-byte answer needs IP fragments at MTU %d, which are likely dropped", tcp.Size, mtu)
+			}
+		case probe.EDNSSize > 0:
+			issue = fmt.Sprintf("UDP with a %d-byte EDNS0 buffer to %s failed: %s", probe.EDNSSize, details.Server, probe.Error)
+		default:
+			issue = fmt.Sprintf("UDP to %s failed: %s", details.Server, probe.Error)
+		}
+		issues = append(issues, fmt.Sprintf("%s: %s", details.Query, issue))
+	}
+
+	return issues
+}
+
+// maxUnfragmentedDNS is the largest DNS message that fits one UDP packet to
+// server at the given MTU.
+func maxUnfragmentedDNS(server string, mtu int) int {
+	ipHeader := 20
+	if host, _, err := net.SplitHostPort(server); err == nil {
+		if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			ipHeader = 40
+		}
+	}
+	return mtu - ipHeader - 8
+}
+
+// formatDNSTransports summarizes the transport probes, e.g. "transports: 2/2
+// OK (google.com udp 512B tc, edns1232 1100B, edns4096 1100B, tcp 1100B)".
+// Quiet output leaves out the per-probe list.
+func formatDNSTransports(raw interface{}, quiet bool) string {
+	lookups, ok := raw.([]interface{})
+	if !ok || len(lookups) == 0 {
+		return ""
+	}
+
+	passed := 0
+	var parts []string
+	for _, l := range lookups {
+		lookup, ok := l.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if issues, _ := lookup["issues"].([]interface{}); len(issues) == 0 {
+			passed++
+		}
+		if quiet {
+			continue
+		}
+
+		query, _ := lookup["query"].(string)
+		probes, _ := lookup["probes"].([]interface{})
+		var probeParts []string
+		for _, p := range probes {
+			probe, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			probeParts = append(probeParts, formatDNSTransportProbe(probe))
+		}
+		parts = append(parts, query+" "+strings.Join(probeParts, ", "))
+	}
+
+	summary := fmt.Sprintf("transports: %d/%d OK", passed, len(lookups))
+	if len(parts) > 0 {
+		summary += " (" + strings.Join(parts, "; ") + ")"
+	}
+	return summary
+}
+
+// formatDNSTransportProbe describes one probe, e.g. "edns1232 1100B" or
+// "tcp FAIL".
+func formatDNSTransportProbe(probe map[string]interface{}) string {
+	transport, _ := probe["transport"].(string)
+	ednsSize, _ := probe["edns_size"].(float64)
+	size, _ := probe["size_bytes"].(float64)
+	truncated, _ := probe["truncated"].(bool)
+	probeErr, _ := probe["error"].(string)
+
+	label := transport
+	if ednsSize > 0 {
+		label = fmt.Sprintf("edns%d", int(ednsSize))
+	}
+
+	switch {
+	case probeErr != "":
+		return label + " FAIL"
+	case truncated:
+		return fmt.Sprintf("%s %dB tc", label, int(size))
+	default:
+		return fmt.Sprintf("%s %dB", label, int(size))
+	}
+}
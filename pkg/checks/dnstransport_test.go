@@ -0,0 +1,95 @@
+package checks
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+func TestProbeTransports(t *testing.T) {
+	server := startDNSServer(t)
+
+	details := probeTransports(context.Background(), types.DNSCheckDetails{
+		Query:  "truncate.example/A",
+		Server: server,
+		Name:   "truncate.example.",
+		Type:   "A",
+	})
+
+	if len(details.Probes) != len(dnsTransportProbes) {
+		t.Fatalf("got %d probes, want %d", len(details.Probes), len(dnsTransportProbes))
+	}
+	for _, probe := range details.Probes {
+		if probe.Error != "" {
+			t.Errorf("%s/%d probe failed: %s", probe.Transport, probe.EDNSSize, probe.Error)
+		}
+		if wantTruncated := probe.Transport == "udp"; probe.Truncated != wantTruncated {
+			t.Errorf("%s/%d probe truncated = %v, want %v", probe.Transport, probe.EDNSSize, probe.Truncated, wantTruncated)
+		}
+	}
+	if len(details.Issues) > 0 {
+		t.Errorf("unexpected issues: %v", details.Issues)
+	}
+}
+
+func TestTransportIssues(t *testing.T) {
+	tests := []struct {
+		name   string
+		mtu    int
+		probes []types.DNSTransportProbe
+		want   []string
+	}{
+		{
+			name: "all transports work",
+			probes: []types.DNSTransportProbe{
+				{Transport: "udp", Size: 100},
+				{Transport: "udp", EDNSSize: 1232, Size: 100},
+				{Transport: "tcp", Size: 100},
+			},
+		},
+		{
+			name: "TCP blocked with truncated answers",
+			probes: []types.DNSTransportProbe{
+				{Transport: "udp", Size: 500, Truncated: true},
+				{Transport: "tcp", Error: "connection refused"},
+			},
+			want: []string{"big.example: TCP to 10.43.0.10:53 failed: connection refused, so truncated UDP answers can't be retried"},
+		},
+		{
+			name: "fragments dropped",
+			probes: []types.DNSTransportProbe{
+				{Transport: "udp", Size: 500, Truncated: true},
+				{Transport: "udp", EDNSSize: 4096, Error: "i/o timeout"},
+				{Transport: "tcp", Size: 3000},
+			},
+			want: []string{"big.example: UDP with a 4096-byte EDNS0 buffer failed while plain UDP works: i/o timeout; the 3000-byte answer needs IP fragments at MTU 1500, which are likely dropped"},
+		},
+		{
+			name: "fragments dropped below the overlay MTU",
+			mtu:  1450,
+			probes: []types.DNSTransportProbe{
+				{Transport: "udp", Size: 500, Truncated: true},
+				{Transport: "udp", EDNSSize: 1232, Size: 1200},
+				{Transport: "udp", EDNSSize: 4096, Error: "i/o timeout"},
+				{Transport: "tcp", Size: 1440},
+			},
+			want: []string{"big.example: UDP with a 4096-byte EDNS0 buffer failed while plain UDP works: i/o timeout; the 1440-byte answer needs IP fragments at MTU 1450, which are likely dropped"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := transportIssues(types.DNSTransportDetails{
+				Query:  "big.example",
+				Server: "10.43.0.10:53",
+				MTU:    tt.mtu,
+				Probes: tt.probes,
+			})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("transportIssues() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -9,11 +9,15 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ryanelliottsmith/network-debugger/pkg/types"
 	"github.com/ryanelliottsmith/network-debugger/pkg/util"
 )
 
+// routeDevRe picks the interface out of "ip route" output.
+var routeDevRe = regexp.MustCompile(`dev (\S+)`)
+
 type HostConfigCheck struct{}
 
 func (c *HostConfigCheck) Name() string {
@@ -94,27 +98,45 @@ func (c *HostConfigCheck) Run(ctx context.Context, target string) (*types.TestRe
 }
 
 func (c *HostConfigCheck) getMTU(ctx context.Context) (int, error) {
-	// Determine the default route interface from "ip route show default"
+	iface, err := defaultRouteInterface(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return interfaceMTU(ctx, iface)
+}
+
+// defaultRouteInterface returns the interface of the default route, taken
+// from "ip route show default".
+func defaultRouteInterface(ctx context.Context) (string, error) {
 	routeOut, err := exec.CommandContext(ctx, "ip", "route", "show", "default").CombinedOutput()
 	if err != nil {
-		return 0, fmt.Errorf("failed to get default route: %w", err)
+		return "", fmt.Errorf("failed to get default route: %w", err)
 	}
 
-	devRe := regexp.MustCompile(`dev (\S+)`)
-	devMatches := devRe.FindStringSubmatch(string(routeOut))
+	devMatches := routeDevRe.FindStringSubmatch(string(routeOut))
 	if len(devMatches) < 2 {
-		return 0, fmt.Errorf("no default route found")
+		return "", fmt.Errorf("no default route found")
 	}
-	iface := devMatches[1]
+	return devMatches[1], nil
+}
 
-	// Get MTU for that specific interface
+// interfaceMTU reads the MTU of a network interface from "ip link show".
+func interfaceMTU(ctx context.Context, iface string) (int, error) {
 	linkOut, err := exec.CommandContext(ctx, "ip", "link", "show", iface).CombinedOutput()
 	if err != nil {
 		return 0, fmt.Errorf("failed to get link info for %s: %w", iface, err)
 	}
 
-	mtuRe := regexp.MustCompile(`mtu (\d+)`)
-	mtuMatches := mtuRe.FindStringSubmatch(string(linkOut))
+	return parseLinkMTU(string(linkOut), iface)
+}
+
+// linkMTURe picks the MTU out of "ip link show" output.
+var linkMTURe = regexp.MustCompile(`mtu (\d+)`)
+
+// parseLinkMTU reads the MTU of iface from its "ip link show" output.
+func parseLinkMTU(linkOut, iface string) (int, error) {
+	mtuMatches := linkMTURe.FindStringSubmatch(linkOut)
 	if len(mtuMatches) < 2 {
 		return 0, fmt.Errorf("could not find MTU for interface %s", iface)
 	}
@@ -158,6 +180,10 @@ func (c *HostConfigCheck) AlwaysShow() bool {
 	return true
 }
 
+func (c *HostConfigCheck) DefaultTimeout() time.Duration {
+	return DefaultCheckTimeout
+}
+
 func (c *HostConfigCheck) FormatSummary(details interface{}, quiet bool) string {
 	hc := extractHostConfig(details)
 	if hc == nil {
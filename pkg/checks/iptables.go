@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/ryanelliottsmith/network-debugger/pkg/types"
 )
@@ -116,6 +117,10 @@ func (c *IptablesCheck) AlwaysShow() bool {
 	return false
 }
 
+func (c *IptablesCheck) DefaultTimeout() time.Duration {
+	return DefaultCheckTimeout
+}
+
 func (c *IptablesCheck) FormatSummary(details interface{}, quiet bool) string {
 	if details == nil {
 		return ""
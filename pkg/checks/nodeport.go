@@ -0,0 +1,236 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+const (
+	// nodePortAttempts is how often a node port is tried before it counts as
+	// unreachable, since kube-proxy may still be programming a new Service.
+	nodePortAttempts = 3
+
+	// nodePortRequestTimeout is how long one request to a node port may take.
+	nodePortRequestTimeout = 2 * time.Second
+
+	// nodePortRetryInterval is the pause between attempts.
+	nodePortRetryInterval = 500 * time.Millisecond
+)
+
+type NodePortCheck struct {
+	ClusterPort int
+	LocalPort   int
+	// LocalBackend is whether the target node runs a backend, and so should
+	// answer on LocalPort.
+	LocalBackend bool
+	// TargetNode is the name of the target node, which must be the backend
+	// answering on LocalPort.
+	TargetNode string
+	// OwnNode is whether the target is the node the check runs on. kube-proxy
+	// sends locally originated traffic to a Local NodePort through the
+	// cluster-wide chain, so any backend may answer and the one that does
+	// isn't checked.
+	OwnNode bool
+}
+
+func (c *NodePortCheck) Name() string {
+	return "nodeport"
+}
+
+func (c *NodePortCheck) Description() string {
+	return "Probes temporary NodePort Services in front of the overlay agents on every node's IP, with externalTrafficPolicy Cluster and Local. Shows broken SNAT, missing kube-proxy rules or firewalls blocking 30000-32767 as an N×N matrix."
+}
+
+func (c *NodePortCheck) Run(ctx context.Context, target string) (*types.TestResult, error) {
+	result := &types.TestResult{
+		Check:  c.Name(),
+		Target: target,
+		Status: types.StatusPass,
+	}
+
+	if c.ClusterPort == 0 || c.LocalPort == 0 {
+		result.Status = types.StatusFail
+		result.Error = "no NodePort Services in the run config"
+		return result, nil
+	}
+
+	client := &http.Client{
+		Timeout:   nodePortRequestTimeout,
+		Transport: &http.Transport{DisableKeepAlives: true},
+	}
+
+	cluster := c.probe(ctx, client, target, "Cluster", c.ClusterPort, true)
+	local := c.probe(ctx, client, target, "Local", c.LocalPort, c.LocalBackend)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	var issues []string
+	if !cluster.Reachable {
+		issues = append(issues, fmt.Sprintf("Cluster port %d: %s", cluster.Port, cluster.Error))
+	}
+	if local.Expected && !local.Reachable {
+		issues = append(issues, fmt.Sprintf("Local port %d: %s", local.Port, local.Error))
+	}
+	if local.Reachable && !c.OwnNode && c.TargetNode != "" && local.Backend != c.TargetNode {
+		issues = append(issues, fmt.Sprintf("Local port %d answered by %s, not a backend on the node", local.Port, local.Backend))
+	}
+
+	if len(issues) > 0 {
+		result.Status = types.StatusFail
+		result.Error = strings.Join(issues, "; ")
+	}
+
+	result.Details = map[string]interface{}{
+		"nodeports": []types.NodePortCheckDetails{cluster, local},
+	}
+
+	return result, nil
+}
+
+// probe requests the whoami endpoint through one node port, retrying a few
+// times. A port that isn't expected to answer is not probed.
+func (c *NodePortCheck) probe(ctx context.Context, client *http.Client, target, policy string, port int, expected bool) types.NodePortCheckDetails {
+	details := types.NodePortCheckDetails{
+		Policy:   policy,
+		Port:     port,
+		Expected: expected,
+	}
+	if !expected {
+		return details
+	}
+
+	url := "http://" + net.JoinHostPort(target, strconv.Itoa(port)) + types.WhoamiPath
+
+	for attempt := 0; attempt < nodePortAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return details
+			case <-time.After(nodePortRetryInterval):
+			}
+		}
+
+		start := time.Now()
+		backend, err := whoami(ctx, client, url)
+		if err != nil {
+			details.Error = err.Error()
+			continue
+		}
+
+		details.Reachable = true
+		details.Backend = backend
+		details.LatencyMS = float64(time.Since(start).Microseconds()) / 1000.0
+		details.Error = ""
+		break
+	}
+
+	return details
+}
+
+// whoami fetches an agent's whoami endpoint and returns the node name of the
+// agent that answered.
+func whoami(ctx context.Context, client *http.Client, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
+
+func (c *NodePortCheck) IsLocal() bool {
+	return false
+}
+
+func (c *NodePortCheck) HostNetworkOnly() bool {
+	return true
+}
+
+func (c *NodePortCheck) AlwaysShow() bool {
+	return false
+}
+
+func (c *NodePortCheck) DefaultTimeout() time.Duration {
+	return DefaultNodePortTimeout
+}
+
+func (c *NodePortCheck) FormatSummary(details interface{}, quiet bool) string {
+	detailsMap, ok := details.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	probes, ok := detailsMap["nodeports"].([]interface{})
+	if !ok {
+		return ""
+	}
+
+	var parts []string
+	for _, p := range probes {
+		probe, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		parts = append(parts, formatNodePortProbe(probe, quiet))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatNodePortProbe describes one node port probe, e.g. "Cluster 31234: ok".
+func formatNodePortProbe(probe map[string]interface{}, quiet bool) string {
+	policy, _ := probe["policy"].(string)
+	port, _ := probe["port"].(float64)
+	reachable, _ := probe["reachable"].(bool)
+	expected, _ := probe["expected"].(bool)
+
+	summary := fmt.Sprintf("%s %d: ", policy, int(port))
+	switch {
+	case !expected:
+		summary += "no backend"
+	case reachable:
+		summary += "ok"
+		if !quiet {
+			backend, _ := probe["backend"].(string)
+			latency, _ := probe["latency_ms"].(float64)
+			summary += fmt.Sprintf(" via %s %.2fms", backend, latency)
+		}
+	default:
+		summary += "FAIL"
+	}
+	return summary
+}
+
+func NewNodePortCheck(clusterPort, localPort int, localBackend bool, targetNode string) *NodePortCheck {
+	return &NodePortCheck{
+		ClusterPort:  clusterPort,
+		LocalPort:    localPort,
+		LocalBackend: localBackend,
+		TargetNode:   targetNode,
+	}
+}
+
+func init() {
+	types.DefaultRegistry.Register(NewNodePortCheck(0, 0, false, ""))
+}
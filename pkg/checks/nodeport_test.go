@@ -0,0 +1,94 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+func TestNodePortCheck_Run(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != types.WhoamiPath {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "node-a")
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name         string
+		localBackend bool
+		targetNode   string
+		want         types.ResultStatus
+	}{
+		{"answered by the node's own backend", true, "node-a", types.StatusPass},
+		{"no backend on the node", false, "node-b", types.StatusPass},
+		{"local answered by another node", true, "node-b", types.StatusFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := NewNodePortCheck(port, port, tt.localBackend, tt.targetNode)
+			result, err := check.Run(context.Background(), "127.0.0.1")
+			if err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+			if result.Status != tt.want {
+				t.Errorf("status = %s, want %s (%s)", result.Status, tt.want, result.Error)
+			}
+
+			probes := result.Details["nodeports"].([]types.NodePortCheckDetails)
+			if !probes[0].Reachable || probes[0].Backend != "node-a" {
+				t.Errorf("Cluster probe = %+v, want reachable via node-a", probes[0])
+			}
+		})
+	}
+}
+
+func TestNodePortCheck_RunOwnNode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "node-b")
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name    string
+		ownNode bool
+		want    types.ResultStatus
+	}{
+		{"own node answered by another backend", true, types.StatusPass},
+		{"remote node answered by another backend", false, types.StatusFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := NewNodePortCheck(port, port, true, "node-a")
+			check.OwnNode = tt.ownNode
+			result, err := check.Run(context.Background(), "127.0.0.1")
+			if err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+			if result.Status != tt.want {
+				t.Errorf("status = %s, want %s (%s)", result.Status, tt.want, result.Error)
+			}
+		})
+	}
+}
+
+func TestNodePortCheck_RunNoServices(t *testing.T) {
+	result, err := NewNodePortCheck(0, 0, false, "").Run(context.Background(), "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if result.Status != types.StatusFail {
+		t.Errorf("status = %s, want fail", result.Status)
+	}
+}
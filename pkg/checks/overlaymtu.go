@@ -0,0 +1,300 @@
+package checks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+	"github.com/ryanelliottsmith/network-debugger/pkg/util"
+)
+
+// sysClassNet is where interface attributes such as the MTU are read from.
+var sysClassNet = "/sys/class/net"
+
+// procRoot lists the host's processes. The host agent runs with hostPID, so
+// it sees the overlay agent on its node and, through its root, the sysfs of
+// the overlay pod's network namespace.
+var procRoot = "/proc"
+
+// errNoOverlayAgent is returned by overlayPodMTU when no overlay agent runs
+// on the node.
+var errNoOverlayAgent = errors.New("no overlay agent on this node")
+
+// iffUp is the IFF_UP bit of an interface's flags.
+const iffUp = 0x1
+
+// tunnelBackend describes a CNI tunnel device and the bytes its encapsulation
+// adds to every packet.
+type tunnelBackend struct {
+	Device   string
+	Backend  string
+	Overhead int
+	// OverheadIPv6 is the overhead when the underlay is IPv6, if different.
+	OverheadIPv6 int
+	// IfUsed only counts the device when it is up or routes traffic, for
+	// devices that exist whether or not the CNI uses them.
+	IfUsed bool
+}
+
+// tunnelBackends are checked in order; the first device present on the host
+// decides the backend.
+var tunnelBackends = []tunnelBackend{
+	{Device: "flannel.1", Backend: "vxlan", Overhead: 50, OverheadIPv6: 70},
+	{Device: "flannel-wg", Backend: "wireguard", Overhead: 60, OverheadIPv6: 80},
+	{Device: "vxlan.calico", Backend: "vxlan", Overhead: 50, OverheadIPv6: 70},
+	{Device: "wireguard.cali", Backend: "wireguard", Overhead: 60, OverheadIPv6: 80},
+	{Device: "cilium_vxlan", Backend: "vxlan", Overhead: 50, OverheadIPv6: 70},
+	{Device: "cilium_geneve", Backend: "geneve", Overhead: 50, OverheadIPv6: 70},
+	{Device: "cilium_wg0", Backend: "wireguard", Overhead: 60, OverheadIPv6: 80},
+	{Device: "wg0", Backend: "wireguard", Overhead: 60, OverheadIPv6: 80},
+	// Loading the ipip module creates tunl0 whether or not the CNI uses it
+	{Device: "tunl0", Backend: "ipip", Overhead: 20, IfUsed: true},
+}
+
+type OverlayMTUCheck struct{}
+
+func (c *OverlayMTUCheck) Name() string {
+	return "overlaymtu"
+}
+
+func (c *OverlayMTUCheck) Description() string {
+	return "Compares the MTU of the overlay pod's eth0 and the CNI tunnel device MTU with the host uplink MTU minus the encapsulation overhead of the detected backend (VXLAN 50, Geneve 50, WireGuard 60/80, IPIP 20)."
+}
+
+func (c *OverlayMTUCheck) Run(ctx context.Context, target string) (*types.TestResult, error) {
+	result := &types.TestResult{
+		Check:  c.Name(),
+		Target: "localhost",
+		Status: types.StatusPass,
+	}
+
+	details := types.OverlayMTUDetails{Backend: "none"}
+
+	uplink, ipv6, err := uplinkInterface(ctx)
+	if err != nil {
+		result.Status = types.StatusFail
+		result.Error = fmt.Sprintf("failed to find uplink: %v", err)
+		return result, nil
+	}
+	uplinkMTU, err := readInterfaceMTU(uplink)
+	if err != nil {
+		result.Status = types.StatusFail
+		result.Error = err.Error()
+		return result, nil
+	}
+	details.UplinkInterface = uplink
+	details.UplinkMTU = uplinkMTU
+
+	for _, backend := range tunnelBackends {
+		mtu, err := readInterfaceMTU(backend.Device)
+		if err != nil {
+			continue
+		}
+		if backend.IfUsed && !tunnelInUse(ctx, backend.Device) {
+			continue
+		}
+		details.Backend = backend.Backend
+		details.TunnelInterface = backend.Device
+		details.TunnelMTU = mtu
+		details.Overhead = backend.Overhead
+		if ipv6 && backend.OverheadIPv6 > 0 {
+			details.Overhead = backend.OverheadIPv6
+		}
+		break
+	}
+
+	details.ExpectedMTU = details.UplinkMTU - details.Overhead
+
+	var issues []string
+	podMTU, err := overlayPodMTU()
+	switch {
+	case errors.Is(err, errNoOverlayAgent):
+		// Without the overlay DaemonSet there is no pod to compare
+		log.Printf("[overlaymtu] Not checking the pod MTU: %v", err)
+	case err != nil:
+		issues = append(issues, err.Error())
+	default:
+		details.PodInterface = "eth0"
+		details.PodMTU = podMTU
+	}
+
+	details.Issues = append(issues, overlayMTUIssues(details)...)
+	if len(details.Issues) > 0 {
+		result.Status = types.StatusFail
+		result.Error = strings.Join(details.Issues, "; ")
+	}
+
+	result.Details = map[string]interface{}{
+		"overlaymtu": details,
+	}
+
+	return result, nil
+}
+
+// readInterfaceMTU reads an interface's MTU from sysfs.
+func readInterfaceMTU(iface string) (int, error) {
+	value, err := util.ReadSysctl(filepath.Join(sysClassNet, iface, "mtu"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read MTU of %s: %w", iface, err)
+	}
+	mtu, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse MTU of %s: %w", iface, err)
+	}
+	return mtu, nil
+}
+
+// overlayMTUIssues compares the tunnel device and pod MTUs with the uplink
+// MTU minus the backend's overhead, and the pod MTU with the tunnel MTU.
+func overlayMTUIssues(details types.OverlayMTUDetails) []string {
+	var issues []string
+
+	if details.TunnelInterface != "" && details.TunnelMTU > details.ExpectedMTU {
+		issues = append(issues, fmt.Sprintf("%s MTU %d exceeds %s MTU %d minus %s overhead %d (%d)",
+			details.TunnelInterface, details.TunnelMTU, details.UplinkInterface, details.UplinkMTU, details.Backend, details.Overhead, details.ExpectedMTU))
+	}
+
+	if details.PodMTU > details.ExpectedMTU {
+		issues = append(issues, fmt.Sprintf("pod MTU %d exceeds %s MTU %d minus %s overhead %d (%d)",
+			details.PodMTU, details.UplinkInterface, details.UplinkMTU, details.Backend, details.Overhead, details.ExpectedMTU))
+	} else if details.TunnelInterface != "" && details.PodMTU > details.TunnelMTU {
+		issues = append(issues, fmt.Sprintf("pod MTU %d exceeds %s MTU %d", details.PodMTU, details.TunnelInterface, details.TunnelMTU))
+	}
+
+	return issues
+}
+
+// tunnelInUse reports whether a tunnel device is up or has routes through it.
+func tunnelInUse(ctx context.Context, device string) bool {
+	flags, err := util.ReadSysctl(filepath.Join(sysClassNet, device, "flags"))
+	if err == nil {
+		if value, err := strconv.ParseUint(flags, 0, 32); err == nil && value&iffUp != 0 {
+			return true
+		}
+	}
+
+	routeOut, err := exec.CommandContext(ctx, "ip", "route", "show", "dev", device).CombinedOutput()
+	return err == nil && strings.TrimSpace(string(routeOut)) != ""
+}
+
+// overlayPodMTU returns the MTU of eth0 in the overlay agent's pod on this
+// node, found as a netdebug agent process outside the host network namespace.
+func overlayPodMTU() (int, error) {
+	hostNetns, err := os.Readlink(filepath.Join(procRoot, "self", "ns", "net"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read own network namespace: %w", err)
+	}
+
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		dir := filepath.Join(procRoot, entry.Name())
+
+		cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+		if err != nil {
+			continue
+		}
+		args := strings.Split(string(cmdline), "\x00")
+		if len(args) < 2 || filepath.Base(args[0]) != "netdebug" || args[1] != "agent" {
+			continue
+		}
+		netns, err := os.Readlink(filepath.Join(dir, "ns", "net"))
+		if err != nil || netns == hostNetns {
+			continue
+		}
+
+		mtu, err := util.ReadSysctl(filepath.Join(dir, "root", "sys", "class", "net", "eth0", "mtu"))
+		if err != nil {
+			return 0, fmt.Errorf("failed to read MTU of the overlay pod's eth0: %w", err)
+		}
+		return strconv.Atoi(mtu)
+	}
+
+	return 0, errNoOverlayAgent
+}
+
+// uplinkInterface returns the interface of the default route, falling back to
+// the IPv6 default route on IPv6-only hosts, and whether it is the IPv6 one.
+func uplinkInterface(ctx context.Context) (string, bool, error) {
+	iface, err := defaultRouteInterface(ctx)
+	if err == nil {
+		return iface, false, nil
+	}
+
+	routeOut, err6 := exec.CommandContext(ctx, "ip", "-6", "route", "show", "default").CombinedOutput()
+	if err6 != nil {
+		return "", false, err
+	}
+	devMatches := routeDevRe.FindStringSubmatch(string(routeOut))
+	if len(devMatches) < 2 {
+		return "", false, err
+	}
+	return devMatches[1], true, nil
+}
+
+func (c *OverlayMTUCheck) IsLocal() bool {
+	return true
+}
+
+func (c *OverlayMTUCheck) HostNetworkOnly() bool {
+	return true
+}
+
+func (c *OverlayMTUCheck) AlwaysShow() bool {
+	return true
+}
+
+func (c *OverlayMTUCheck) DefaultTimeout() time.Duration {
+	return DefaultCheckTimeout
+}
+
+func (c *OverlayMTUCheck) FormatSummary(details interface{}, quiet bool) string {
+	detailsMap, ok := details.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	m, ok := detailsMap["overlaymtu"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	backend, _ := m["backend"].(string)
+	uplink, _ := m["uplink_interface"].(string)
+	uplinkMTU, _ := m["uplink_mtu"].(float64)
+	tunnel, _ := m["tunnel_interface"].(string)
+	tunnelMTU, _ := m["tunnel_mtu"].(float64)
+	podMTU, _ := m["pod_mtu"].(float64)
+	expected, _ := m["expected_mtu"].(float64)
+
+	summary := fmt.Sprintf("%s %d", uplink, int(uplinkMTU))
+	if tunnel != "" {
+		summary += fmt.Sprintf(", %s %s %d", backend, tunnel, int(tunnelMTU))
+	}
+	if podMTU > 0 {
+		summary += fmt.Sprintf(", pods %d", int(podMTU))
+	}
+	summary += fmt.Sprintf(", max %d", int(expected))
+
+	return summary
+}
+
+func NewOverlayMTUCheck() *OverlayMTUCheck {
+	return &OverlayMTUCheck{}
+}
+
+func init() {
+	types.DefaultRegistry.Register(NewOverlayMTUCheck())
+}
@@ -0,0 +1,186 @@
+package checks
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadInterfaceMTU(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "vxlan.calico", "mtu"), "8950\n")
+
+	orig := sysClassNet
+	sysClassNet = dir
+	defer func() { sysClassNet = orig }()
+
+	if mtu, err := readInterfaceMTU("vxlan.calico"); err != nil || mtu != 8950 {
+		t.Errorf("readInterfaceMTU(vxlan.calico) = %d, %v; want 8950", mtu, err)
+	}
+	if _, err := readInterfaceMTU("flannel.1"); err == nil {
+		t.Error("readInterfaceMTU(flannel.1) expected error for a missing interface")
+	}
+}
+
+func TestTunnelInUse(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "tunl0", "flags"), "0xc1\n")
+	writeFile(t, filepath.Join(dir, "tunl9", "flags"), "0x80\n")
+
+	orig := sysClassNet
+	sysClassNet = dir
+	defer func() { sysClassNet = orig }()
+
+	if !tunnelInUse(context.Background(), "tunl0") {
+		t.Error("tunnelInUse(tunl0) = false for an up device, want true")
+	}
+	// tunl9 is down and, not existing on this host, has no routes
+	if tunnelInUse(context.Background(), "tunl9") {
+		t.Error("tunnelInUse(tunl9) = true for a down device without routes, want false")
+	}
+}
+
+func TestOverlayPodMTU(t *testing.T) {
+	tests := []struct {
+		name    string
+		procs   map[string][2]string // pid: cmdline, netns
+		mtu     string
+		want    int
+		wantErr error
+	}{
+		{
+			name: "overlay agent",
+			procs: map[string][2]string{
+				"1":   {"/sbin/init\x00", "net:[1]"},
+				"100": {"netdebug\x00agent\x00--mode=configmap\x00", "net:[1]"},
+				"200": {"netdebug\x00agent\x00--mode=configmap\x00", "net:[2]"},
+			},
+			mtu:  "1450\n",
+			want: 1450,
+		},
+		{
+			name: "only the host agent",
+			procs: map[string][2]string{
+				"100": {"netdebug\x00agent\x00--mode=configmap\x00", "net:[1]"},
+				"300": {"/pause\x00", "net:[3]"},
+			},
+			wantErr: errNoOverlayAgent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			link := func(target, path string) {
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Symlink(target, path); err != nil {
+					t.Fatal(err)
+				}
+			}
+			link("net:[1]", filepath.Join(dir, "self", "ns", "net"))
+			for pid, proc := range tt.procs {
+				writeFile(t, filepath.Join(dir, pid, "cmdline"), proc[0])
+				link(proc[1], filepath.Join(dir, pid, "ns", "net"))
+				if tt.mtu != "" {
+					writeFile(t, filepath.Join(dir, pid, "root", "sys", "class", "net", "eth0", "mtu"), tt.mtu)
+				}
+			}
+
+			orig := procRoot
+			procRoot = dir
+			defer func() { procRoot = orig }()
+
+			got, err := overlayPodMTU()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("overlayPodMTU() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("overlayPodMTU() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverlayMTUIssues(t *testing.T) {
+	vxlan := func(tunnelMTU, podMTU int) types.OverlayMTUDetails {
+		return types.OverlayMTUDetails{
+			Backend:         "vxlan",
+			Overhead:        50,
+			UplinkInterface: "eth0",
+			UplinkMTU:       1500,
+			TunnelInterface: "flannel.1",
+			TunnelMTU:       tunnelMTU,
+			PodMTU:          podMTU,
+			ExpectedMTU:     1450,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		details types.OverlayMTUDetails
+		want    []string
+	}{
+		{
+			name:    "consistent",
+			details: vxlan(1450, 1450),
+		},
+		{
+			name:    "pod below the tunnel",
+			details: vxlan(1450, 1400),
+		},
+		{
+			name:    "tunnel too large",
+			details: vxlan(1500, 1450),
+			want:    []string{"flannel.1 MTU 1500 exceeds eth0 MTU 1500 minus vxlan overhead 50 (1450)"},
+		},
+		{
+			name:    "pod too large",
+			details: vxlan(1450, 1500),
+			want:    []string{"pod MTU 1500 exceeds eth0 MTU 1500 minus vxlan overhead 50 (1450)"},
+		},
+		{
+			name:    "pod above a small tunnel",
+			details: vxlan(1400, 1450),
+			want:    []string{"pod MTU 1450 exceeds flannel.1 MTU 1400"},
+		},
+		{
+			name:    "no pod on the node",
+			details: vxlan(1450, 0),
+		},
+		{
+			name: "no tunnel",
+			details: types.OverlayMTUDetails{
+				Backend:         "none",
+				UplinkInterface: "eth0",
+				UplinkMTU:       9001,
+				PodMTU:          9001,
+				ExpectedMTU:     9001,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := overlayMTUIssues(tt.details); !slices.Equal(got, tt.want) {
+				t.Errorf("overlayMTUIssues() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -99,6 +99,14 @@ func (c *PingCheck) AlwaysShow() bool {
 	return false
 }
 
+// DefaultTimeout leaves room for the pinger's own timeout of one second per packet.
+func (c *PingCheck) DefaultTimeout() time.Duration {
+	if c.Count == 0 || c.Count == DefaultPingCount {
+		return DefaultPingTimeout
+	}
+	return time.Duration(c.Count)*time.Second + 2*time.Second
+}
+
 func (c *PingCheck) FormatSummary(details interface{}, quiet bool) string {
 	if details == nil {
 		return ""
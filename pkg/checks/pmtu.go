@@ -0,0 +1,240 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"time"
+
+	probing "github.com/prometheus-community/pro-bing"
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+const (
+	// MinPathMTU is the smallest path MTU the pmtu check searches down to.
+	// Every IPv4 host must accept datagrams of this size.
+	MinPathMTU = 576
+
+	// pmtuProbeCount is how many DF-flagged pings each probe size gets, so a
+	// single lost packet doesn't read as the size being too large.
+	pmtuProbeCount = 2
+
+	// pmtuProbeTimeout is how long to wait for replies to one probe size.
+	pmtuProbeTimeout = time.Second
+)
+
+type PMTUCheck struct{}
+
+func (c *PMTUCheck) Name() string {
+	return "pmtu"
+}
+
+func (c *PMTUCheck) Description() string {
+	return "Discovers the path MTU to each node with DF-flagged ICMP probes. Fails when the path MTU is smaller than the MTU of the local interface the traffic leaves through, which black-holes large packets while small pings still pass."
+}
+
+func (c *PMTUCheck) Run(ctx context.Context, target string) (*types.TestResult, error) {
+	result := &types.TestResult{
+		Check:  c.Name(),
+		Target: target,
+		Status: types.StatusPass,
+	}
+
+	addr, err := net.ResolveIPAddr("ip", target)
+	if err != nil {
+		result.Status = types.StatusFail
+		result.Error = fmt.Sprintf("failed to resolve target: %v", err)
+		return result, nil
+	}
+
+	overhead := icmpOverhead(addr.IP)
+
+	details := types.PMTUCheckDetails{}
+
+	iface, ifaceMTU, err := routeMTU(ctx, addr.IP.String())
+	if err != nil {
+		result.Status = types.StatusFail
+		result.Error = fmt.Sprintf("failed to get interface MTU: %v", err)
+		return result, nil
+	}
+	details.Interface = iface
+	details.InterfaceMTU = ifaceMTU
+
+	probe := func(mtu int) (bool, error) {
+		details.Probes++
+		return c.probe(ctx, addr, mtu-overhead)
+	}
+
+	details.PathMTU, err = searchPathMTU(ifaceMTU, probe)
+	if err != nil {
+		return nil, err
+	}
+
+	if details.PathMTU > 0 {
+		details.MaxPayload = details.PathMTU - overhead
+	}
+
+	switch {
+	case details.PathMTU == 0:
+		result.Status = types.StatusFail
+		result.Error = fmt.Sprintf("no DF probe got through, even at %d bytes", min(MinPathMTU, ifaceMTU))
+	case details.PathMTU < details.InterfaceMTU:
+		result.Status = types.StatusFail
+		result.Error = fmt.Sprintf("path MTU %d is smaller than %s MTU %d", details.PathMTU, iface, details.InterfaceMTU)
+	}
+
+	result.Details = map[string]interface{}{
+		"pmtu": details,
+	}
+
+	return result, nil
+}
+
+// icmpOverhead is the size of the IP and ICMP headers, which are part of the
+// MTU but not of the ping payload.
+func icmpOverhead(ip net.IP) int {
+	if ip.To4() == nil {
+		return 40 + 8
+	}
+	return 20 + 8
+}
+
+// searchPathMTU finds the largest packet size between MinPathMTU and ifaceMTU
+// that probe gets through, or 0 if not even the smallest does. Sizes above
+// the interface MTU fail locally with DF set, so the search starts there: on
+// a healthy path the first probe is the only one.
+func searchPathMTU(ifaceMTU int, probe func(mtu int) (bool, error)) (int, error) {
+	ok, err := probe(ifaceMTU)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return ifaceMTU, nil
+	}
+	if ifaceMTU <= MinPathMTU {
+		return 0, nil
+	}
+
+	lo, hi := MinPathMTU, ifaceMTU
+	ok, err = probe(lo)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	// lo always gets through and hi never does
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		ok, err = probe(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// probe reports whether a DF-flagged ping with the given payload size gets a
+// reply. An error is only returned when the run itself is cancelled.
+func (c *PMTUCheck) probe(ctx context.Context, addr *net.IPAddr, payload int) (bool, error) {
+	pinger := probing.New("")
+	pinger.SetIPAddr(addr)
+	pinger.SetPrivileged(true)
+	pinger.SetDoNotFragment(true)
+	pinger.Size = payload
+	pinger.Count = pmtuProbeCount
+	pinger.Interval = 100 * time.Millisecond
+	pinger.Timeout = pmtuProbeTimeout
+
+	// Oversized packets fail to send with EMSGSIZE, which is a "no" for this size
+	runErr := pinger.RunWithContext(ctx)
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	return probeReplied(runErr, pinger.Statistics()), nil
+}
+
+// probeReplied reads the outcome of a DF-flagged ping: the size got through
+// if the ping could be sent and at least one reply came back.
+func probeReplied(runErr error, stats *probing.Statistics) bool {
+	return runErr == nil && stats != nil && stats.PacketsRecv > 0
+}
+
+// routeMTU returns the interface traffic to ip leaves through and its MTU.
+func routeMTU(ctx context.Context, ip string) (string, int, error) {
+	routeOut, err := exec.CommandContext(ctx, "ip", "route", "get", ip).CombinedOutput()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get route to %s: %w", ip, err)
+	}
+
+	iface, err := parseRouteDev(string(routeOut), ip)
+	if err != nil {
+		return "", 0, err
+	}
+
+	mtu, err := interfaceMTU(ctx, iface)
+	if err != nil {
+		return "", 0, err
+	}
+	return iface, mtu, nil
+}
+
+// parseRouteDev returns the interface of an "ip route get" route to ip.
+func parseRouteDev(routeOut, ip string) (string, error) {
+	devMatches := routeDevRe.FindStringSubmatch(routeOut)
+	if len(devMatches) < 2 {
+		return "", fmt.Errorf("no route to %s", ip)
+	}
+	return devMatches[1], nil
+}
+
+func (c *PMTUCheck) IsLocal() bool {
+	return false
+}
+
+func (c *PMTUCheck) HostNetworkOnly() bool {
+	return false
+}
+
+func (c *PMTUCheck) AlwaysShow() bool {
+	return false
+}
+
+func (c *PMTUCheck) DefaultTimeout() time.Duration {
+	return DefaultPMTUTimeout
+}
+
+func (c *PMTUCheck) FormatSummary(details interface{}, quiet bool) string {
+	detailsMap, ok := details.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	pmtu, ok := detailsMap["pmtu"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	pathMTU, _ := pmtu["path_mtu"].(float64)
+	ifaceMTU, _ := pmtu["interface_mtu"].(float64)
+	iface, _ := pmtu["interface"].(string)
+
+	summary := fmt.Sprintf("path MTU %d, %s MTU %d", int(pathMTU), iface, int(ifaceMTU))
+	if !quiet {
+		probes, _ := pmtu["probes"].(float64)
+		summary += fmt.Sprintf(" (%d probes)", int(probes))
+	}
+	return summary
+}
+
+func NewPMTUCheck() *PMTUCheck {
+	return &PMTUCheck{}
+}
+
+func init() {
+	types.DefaultRegistry.Register(NewPMTUCheck())
+}
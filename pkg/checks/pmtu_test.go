@@ -0,0 +1,180 @@
+package checks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+
+	probing "github.com/prometheus-community/pro-bing"
+)
+
+func TestSearchPathMTU(t *testing.T) {
+	tests := []struct {
+		name       string
+		ifaceMTU   int
+		pathMTU    int // largest size the fake path lets through, 0 for none
+		want       int
+		wantProbes int
+	}{
+		{name: "healthy path", ifaceMTU: 1500, pathMTU: 1500, want: 1500, wantProbes: 1},
+		{name: "jumbo interface, standard path", ifaceMTU: 9000, pathMTU: 1500, want: 1500},
+		{name: "overlay overhead", ifaceMTU: 1500, pathMTU: 1450, want: 1450},
+		{name: "only the minimum", ifaceMTU: 1500, pathMTU: MinPathMTU, want: MinPathMTU},
+		{name: "one below the interface", ifaceMTU: 1500, pathMTU: 1499, want: 1499},
+		{name: "nothing gets through", ifaceMTU: 1500, want: 0, wantProbes: 2},
+		{name: "interface at the minimum", ifaceMTU: MinPathMTU, want: 0, wantProbes: 1},
+		{name: "interface below the minimum", ifaceMTU: 500, pathMTU: 400, want: 0, wantProbes: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var probes []int
+			got, err := searchPathMTU(tt.ifaceMTU, func(mtu int) (bool, error) {
+				if mtu < MinPathMTU && mtu != tt.ifaceMTU || mtu > tt.ifaceMTU {
+					t.Errorf("probed %d, outside [%d, %d]", mtu, MinPathMTU, tt.ifaceMTU)
+				}
+				probes = append(probes, mtu)
+				return mtu <= tt.pathMTU, nil
+			})
+			if err != nil {
+				t.Fatalf("searchPathMTU() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("searchPathMTU() = %d, want %d (probes %v)", got, tt.want, probes)
+			}
+			if tt.wantProbes > 0 && len(probes) != tt.wantProbes {
+				t.Errorf("searchPathMTU() sent %d probes %v, want %d", len(probes), probes, tt.wantProbes)
+			}
+		})
+	}
+}
+
+func TestSearchPathMTU_Cancelled(t *testing.T) {
+	calls := 0
+	_, err := searchPathMTU(1500, func(mtu int) (bool, error) {
+		calls++
+		if calls == 3 {
+			return false, context.Canceled
+		}
+		return mtu == MinPathMTU, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("searchPathMTU() error = %v, want context.Canceled", err)
+	}
+	if calls != 3 {
+		t.Errorf("searchPathMTU() kept probing after cancellation: %d probes", calls)
+	}
+}
+
+func TestProbeReplied(t *testing.T) {
+	tests := []struct {
+		name   string
+		runErr error
+		stats  *probing.Statistics
+		want   bool
+	}{
+		{name: "replies", stats: &probing.Statistics{PacketsSent: 2, PacketsRecv: 2}, want: true},
+		{name: "one of two lost", stats: &probing.Statistics{PacketsSent: 2, PacketsRecv: 1}, want: true},
+		{name: "no reply", stats: &probing.Statistics{PacketsSent: 2}},
+		{name: "too large to send", runErr: &net.OpError{Op: "write", Err: syscall.EMSGSIZE}, stats: &probing.Statistics{}},
+		{name: "no statistics"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := probeReplied(tt.runErr, tt.stats); got != tt.want {
+				t.Errorf("probeReplied() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIcmpOverhead(t *testing.T) {
+	if got := icmpOverhead(net.ParseIP("10.42.1.5")); got != 28 {
+		t.Errorf("icmpOverhead(IPv4) = %d, want 28", got)
+	}
+	if got := icmpOverhead(net.ParseIP("fd00::5")); got != 48 {
+		t.Errorf("icmpOverhead(IPv6) = %d, want 48", got)
+	}
+}
+
+func TestParseRouteDev(t *testing.T) {
+	tests := []struct {
+		name     string
+		routeOut string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "via gateway",
+			routeOut: "10.0.1.5 via 10.0.0.1 dev eth0 src 10.0.0.2 uid 0 \n    cache \n",
+			want:     "eth0",
+		},
+		{
+			name:     "overlay device",
+			routeOut: "10.42.1.5 via 10.42.1.0 dev flannel.1 src 10.42.0.0 uid 0 \n    cache \n",
+			want:     "flannel.1",
+		},
+		{
+			name:     "local address",
+			routeOut: "local 10.0.0.2 dev lo table local src 10.0.0.2 uid 0 \n    cache <local> \n",
+			want:     "lo",
+		},
+		{
+			name:     "unreachable",
+			routeOut: "RTNETLINK answers: Network is unreachable\n",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRouteDev(tt.routeOut, "10.0.1.5")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRouteDev() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseRouteDev() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLinkMTU(t *testing.T) {
+	tests := []struct {
+		name    string
+		linkOut string
+		want    int
+		wantErr bool
+	}{
+		{
+			name:    "ethernet",
+			linkOut: "2: eth0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 9001 qdisc mq state UP mode DEFAULT group default qlen 1000\n    link/ether 02:42:ac:11:00:02 brd ff:ff:ff:ff:ff:ff\n",
+			want:    9001,
+		},
+		{
+			name:    "vxlan",
+			linkOut: "5: flannel.1: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1450 qdisc noqueue state UNKNOWN mode DEFAULT group default\n",
+			want:    1450,
+		},
+		{
+			name:    "no such device",
+			linkOut: "Device \"eth9\" does not exist.\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLinkMTU(tt.linkOut, "eth0")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLinkMTU() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseLinkMTU() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
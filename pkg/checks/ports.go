@@ -2,14 +2,20 @@ package checks
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/ryanelliottsmith/network-debugger/pkg/types"
 )
 
+// udpPortReadTimeout caps how long a UDP port is given to answer, so silent
+// ports such as VXLAN don't use up the whole check timeout.
+const udpPortReadTimeout = 2 * time.Second
+
 type PortsCheck struct {
 	Ports []types.PortCheck
 }
@@ -19,7 +25,7 @@ func (c *PortsCheck) Name() string {
 }
 
 func (c *PortsCheck) Description() string {
-	return "Tests connectivity across standard RKE2/K3s required ports between nodes."
+	return "Tests connectivity across standard RKE2/K3s required ports between nodes, plus the ports of the detected CNI (VXLAN, BGP, Typha, WireGuard, Cilium health)."
 }
 
 func (c *PortsCheck) Run(ctx context.Context, target string) (*types.TestResult, error) {
@@ -31,23 +37,36 @@ func (c *PortsCheck) Run(ctx context.Context, target string) (*types.TestResult,
 	}
 
 	var portResults []types.PortCheckDetails
-	var failedPorts []string
+	var failedPorts, silentPorts []string
 
 	for _, port := range c.Ports {
 		portResult := c.checkPort(ctx, target, port)
 		portResults = append(portResults, portResult)
 
-		if !portResult.Open {
-			failedPorts = append(failedPorts, fmt.Sprintf("%d/%s:%s", port.Port, port.Protocol, port.Name))
+		// Optional ports are reported but never fail. A silent UDP port may be
+		// open or dropped by a firewall, so it is a warning.
+		if port.Optional {
+			continue
+		}
+		name := fmt.Sprintf("%d/%s:%s", port.Port, port.Protocol, port.Name)
+		switch portResult.State {
+		case types.PortClosed:
+			failedPorts = append(failedPorts, name)
+		case types.PortOpenFiltered:
+			silentPorts = append(silentPorts, name)
 		}
 	}
 
 	result.Details["ports"] = portResults
 
-	if len(failedPorts) > 0 {
+	switch {
+	case len(failedPorts) > 0:
 		result.Status = types.StatusFail
 		result.Error = strings.Join(failedPorts, ", ")
 		result.Details["failed_ports"] = failedPorts
+	case len(silentPorts) > 0:
+		result.Status = types.StatusWarn
+		result.Error = fmt.Sprintf("no reply from %s (open or filtered)", strings.Join(silentPorts, ", "))
 	}
 
 	return result, nil
@@ -58,6 +77,8 @@ func (c *PortsCheck) checkPort(ctx context.Context, host string, port types.Port
 		Port:     port.Port,
 		Protocol: port.Protocol,
 		Open:     false,
+		State:    types.PortClosed,
+		Optional: port.Optional,
 	}
 
 	address := fmt.Sprintf("%s:%d", host, port.Port)
@@ -69,6 +90,7 @@ func (c *PortsCheck) checkPort(ctx context.Context, host string, port types.Port
 		if err == nil {
 			defer conn.Close()
 			details.Open = true
+			details.State = types.PortOpen
 			details.LatencyMS = float64(time.Since(start).Microseconds()) / 1000.0
 		} else {
 			details.Error = err.Error()
@@ -81,10 +103,10 @@ func (c *PortsCheck) checkPort(ctx context.Context, host string, port types.Port
 		if err == nil {
 			defer conn.Close()
 
-			// Set a deadline from context or default to 2 seconds
-			deadline, ok := ctx.Deadline()
-			if !ok {
-				deadline = time.Now().Add(2 * time.Second)
+			// Set a deadline from context, capped at udpPortReadTimeout
+			deadline := time.Now().Add(udpPortReadTimeout)
+			if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+				deadline = ctxDeadline
 			}
 			conn.SetDeadline(deadline)
 
@@ -97,7 +119,12 @@ func (c *PortsCheck) checkPort(ctx context.Context, host string, port types.Port
 				if readErr == nil {
 					// We received data, so it's definitely OPEN
 					details.Open = true
+					details.State = types.PortOpen
 					details.LatencyMS = float64(time.Since(start).Microseconds()) / 1000.0
+				} else if errors.Is(readErr, os.ErrDeadlineExceeded) {
+					// No ICMP port unreachable either: open but silent, or filtered
+					details.State = types.PortOpenFiltered
+					details.Error = "no reply (open or filtered)"
 				} else {
 					details.Error = readErr.Error()
 				}
@@ -124,6 +151,10 @@ func (c *PortsCheck) AlwaysShow() bool {
 	return false
 }
 
+func (c *PortsCheck) DefaultTimeout() time.Duration {
+	return DefaultPortsTimeout
+}
+
 func (c *PortsCheck) FormatSummary(details interface{}, quiet bool) string {
 	if details == nil {
 		return ""
@@ -144,7 +175,7 @@ func (c *PortsCheck) FormatSummary(details interface{}, quiet bool) string {
 		return ""
 	}
 
-	var open, total int
+	var open, openFiltered, total int
 	var portDetails []string
 
 	for _, p := range portsList {
@@ -157,16 +188,27 @@ func (c *PortsCheck) FormatSummary(details interface{}, quiet bool) string {
 		port := int(portMap["port"].(float64))
 		protocol := portMap["protocol"].(string)
 		isOpen, _ := portMap["open"].(bool)
+		state, _ := portMap["state"].(string)
+		optional, _ := portMap["optional"].(bool)
 
-		if isOpen {
+		switch {
+		case isOpen:
 			open++
 			if !quiet {
 				latency, _ := portMap["latency_ms"].(float64)
 				portDetails = append(portDetails, fmt.Sprintf("%d/%s: %.2fms", port, protocol, latency))
 			}
-		} else {
+		case state == types.PortOpenFiltered:
+			openFiltered++
+			if !quiet {
+				portDetails = append(portDetails, fmt.Sprintf("%d/%s: OPEN|FILTERED", port, protocol))
+			}
+		default:
 			if !quiet {
 				msg := fmt.Sprintf("%d/%s: CLOSED", port, protocol)
+				if optional {
+					msg += " (optional)"
+				}
 				if errStr, ok := portMap["error"].(string); ok && errStr != "" {
 					msg = fmt.Sprintf("%s (%s)", msg, errStr)
 				}
@@ -176,6 +218,9 @@ func (c *PortsCheck) FormatSummary(details interface{}, quiet bool) string {
 	}
 
 	summary := fmt.Sprintf("%d/%d open", open, total)
+	if openFiltered > 0 {
+		summary += fmt.Sprintf(", %d open|filtered", openFiltered)
+	}
 	if !quiet && len(portDetails) > 0 {
 		return summary + " | " + strings.Join(portDetails, ", ")
 	}
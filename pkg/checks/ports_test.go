@@ -30,7 +30,13 @@ func TestPortsCheck_UDP(t *testing.T) {
 		}
 	}()
 
-	closedPort := 50000 + (openPort % 1000)
+	// A port that was just free and is closed again
+	closedConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve a closed UDP port: %v", err)
+	}
+	closedPort := closedConn.LocalAddr().(*net.UDPAddr).Port
+	closedConn.Close()
 
 	check := NewPortsCheck([]types.PortCheck{
 		{Port: openPort, Protocol: "udp", Name: "open-udp-service", NodeRole: types.NodeRoleAll},
@@ -110,6 +116,43 @@ func TestPortsCheck_UDP(t *testing.T) {
 	}
 }
 
+func TestPortsCheck_SilentUDPWarns(t *testing.T) {
+	silentConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen udp: %v", err)
+	}
+	defer silentConn.Close()
+	silentPort := silentConn.LocalAddr().(*net.UDPAddr).Port
+
+	tests := []struct {
+		name     string
+		optional bool
+		want     types.ResultStatus
+	}{
+		{name: "required", want: types.StatusWarn},
+		{name: "optional", optional: true, want: types.StatusPass},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := NewPortsCheck([]types.PortCheck{
+				{Port: silentPort, Protocol: "udp", Name: "flannel-vxlan", NodeRole: types.NodeRoleAll, Optional: tt.optional},
+			})
+
+			result, err := check.Run(context.Background(), "127.0.0.1")
+			if err != nil {
+				t.Fatalf("Check run failed: %v", err)
+			}
+			if result.Status != tt.want {
+				t.Errorf("Status = %s, want %s (%s)", result.Status, tt.want, result.Error)
+			}
+			if state := result.Details["ports"].([]types.PortCheckDetails)[0].State; state != types.PortOpenFiltered {
+				t.Errorf("State = %q, want %q", state, types.PortOpenFiltered)
+			}
+		})
+	}
+}
+
 func TestPortsCheck_TCP(t *testing.T) {
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -140,3 +183,41 @@ func TestPortsCheck_TCP(t *testing.T) {
 		}
 	}
 }
+
+func TestPortsCheck_Optional(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen tcp: %v", err)
+	}
+	closedPort := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	tests := []struct {
+		name     string
+		optional bool
+		want     types.ResultStatus
+	}{
+		{name: "required", want: types.StatusFail},
+		{name: "optional", optional: true, want: types.StatusPass},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := NewPortsCheck([]types.PortCheck{
+				{Port: closedPort, Protocol: "tcp", Name: "calico-typha", NodeRole: types.NodeRoleAll, Optional: tt.optional},
+			})
+
+			result, err := check.Run(context.Background(), "127.0.0.1")
+			if err != nil {
+				t.Fatalf("Check run failed: %v", err)
+			}
+			if result.Status != tt.want {
+				t.Errorf("Status = %s, want %s (%s)", result.Status, tt.want, result.Error)
+			}
+			portResult := result.Details["ports"].([]types.PortCheckDetails)[0]
+			if portResult.State != types.PortClosed || portResult.Optional != tt.optional {
+				t.Errorf("port result = %+v, want closed with optional %v", portResult, tt.optional)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package checks
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+// resolvConfPath is the resolver config of the agent's own container. For the
+// host network agent kubelet fills it from its --resolv-conf, as it does for
+// dnsPolicy: Default pods such as CoreDNS.
+const resolvConfPath = "/etc/resolv.conf"
+
+// hostResolvConfs are the host's own resolver configs, reachable through
+// /proc/1/root because the host agent runs with hostPID.
+var hostResolvConfs = []struct {
+	Source string
+	Path   string
+}{
+	{Source: "host", Path: "/proc/1/root/etc/resolv.conf"},
+	{Source: "systemd-resolved", Path: "/proc/1/root/run/systemd/resolve/resolv.conf"},
+}
+
+const (
+	// maxNameservers is how many nameservers glibc and musl use (MAXNS).
+	maxNameservers = 3
+
+	// maxSearchDomains is how many search domains older glibc, and kubelet
+	// without ExpandedDNSConfig, use.
+	maxSearchDomains = 6
+
+	// clusterSearchDomains is how many search domains kubelet gives every
+	// ClusterFirst pod: <ns>.svc.cluster.local, svc.cluster.local and
+	// cluster.local.
+	clusterSearchDomains = 3
+)
+
+// resolvConf is the part of resolv.conf(5) the dns and resolvconf checks use.
+type resolvConf struct {
+	// Nameservers are host:port addresses.
+	Nameservers []string
+	Search      []string
+	Ndots       int
+	Options     []string
+}
+
+// readResolvConf parses the resolv.conf at path.
+func readResolvConf(path string) (*resolvConf, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseResolvConf(f)
+}
+
+// parseResolvConf parses resolv.conf(5). Later search and domain lines
+// replace earlier ones, as in glibc.
+func parseResolvConf(r io.Reader) (*resolvConf, error) {
+	conf := &resolvConf{Ndots: 1}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.IndexAny(line, "#;"); idx >= 0 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "nameserver":
+			if len(fields) > 1 && net.ParseIP(fields[1]) != nil {
+				conf.Nameservers = append(conf.Nameservers, net.JoinHostPort(fields[1], "53"))
+			}
+		case "search":
+			conf.Search = fields[1:]
+		case "domain":
+			if len(fields) > 1 {
+				conf.Search = fields[1:2]
+			}
+		case "options":
+			conf.Options = append(conf.Options, fields[1:]...)
+			for _, option := range fields[1:] {
+				if value, ok := strings.CutPrefix(option, "ndots:"); ok {
+					if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+						conf.Ndots = min(n, 15)
+					}
+				}
+			}
+		}
+	}
+
+	return conf, scanner.Err()
+}
+
+// candidates returns the fully qualified names a resolver tries for name, in
+// order: with the search domains first when name has fewer than ndots dots.
+func (c *resolvConf) candidates(name string) []string {
+	if strings.HasSuffix(name, ".") {
+		return []string{name}
+	}
+
+	var searched []string
+	for _, domain := range c.Search {
+		searched = append(searched, name+"."+strings.TrimSuffix(domain, ".")+".")
+	}
+
+	if strings.Count(name, ".") >= c.Ndots {
+		return append([]string{name + "."}, searched...)
+	}
+	return append(searched, name+".")
+}
+
+type ResolvConfCheck struct {
+	NetworkType types.NetworkType
+}
+
+func (c *ResolvConfCheck) Name() string {
+	return "resolvconf"
+}
+
+func (c *ResolvConfCheck) Description() string {
+	return "Parses /etc/resolv.conf, and on the host network the host's own and systemd-resolved's, for known-bad patterns: ndots:5 search-path storms, more than 3 nameservers or 6 search domains, and loopback nameservers such as the systemd-resolved stub that make CoreDNS forward to itself."
+}
+
+func (c *ResolvConfCheck) Run(ctx context.Context, target string) (*types.TestResult, error) {
+	result := &types.TestResult{
+		Check:  c.Name(),
+		Target: "localhost",
+		Status: types.StatusPass,
+	}
+
+	source := "pod"
+	if c.NetworkType == types.NetworkTypeHost {
+		source = "kubelet"
+	}
+
+	details := types.ResolvConfDetails{}
+
+	conf, err := readResolvConf(resolvConfPath)
+	if err != nil {
+		details.Issues = append(details.Issues, fmt.Sprintf("failed to read %s: %v", resolvConfPath, err))
+	} else {
+		file := resolvConfFile(source, resolvConfPath, conf)
+		details.Files = append(details.Files, file)
+		details.Issues = append(details.Issues, resolvConfIssues(file)...)
+	}
+
+	if c.NetworkType == types.NetworkTypeHost {
+		for _, hostConf := range hostResolvConfs {
+			conf, err := readResolvConf(hostConf.Path)
+			if err != nil {
+				// systemd-resolved isn't on every host
+				if !os.IsNotExist(err) {
+					details.Issues = append(details.Issues, fmt.Sprintf("failed to read %s: %v", hostConf.Path, err))
+				}
+				continue
+			}
+			file := resolvConfFile(hostConf.Source, hostConf.Path, conf)
+			details.Files = append(details.Files, file)
+			details.Issues = append(details.Issues, resolvConfIssues(file)...)
+		}
+	}
+
+	if len(details.Issues) > 0 {
+		result.Status = types.StatusFail
+	}
+
+	result.Details = map[string]interface{}{
+		"resolvconf": details,
+	}
+
+	return result, nil
+}
+
+// resolvConfFile turns a parsed resolv.conf into check details.
+func resolvConfFile(source, path string, conf *resolvConf) types.ResolvConfFile {
+	file := types.ResolvConfFile{
+		Source:  source,
+		Path:    path,
+		Search:  conf.Search,
+		Ndots:   conf.Ndots,
+		Options: conf.Options,
+	}
+	for _, server := range conf.Nameservers {
+		host, _, _ := net.SplitHostPort(server)
+		file.Nameservers = append(file.Nameservers, host)
+	}
+	return file
+}
+
+// resolvConfIssues returns the known-bad patterns in one resolv.conf.
+func resolvConfIssues(file types.ResolvConfFile) []string {
+	var issues []string
+
+	if len(file.Nameservers) > maxNameservers {
+		issues = append(issues, fmt.Sprintf("%s: %d nameservers, only the first %d are used (%s)",
+			file.Source, len(file.Nameservers), maxNameservers, strings.Join(file.Nameservers[maxNameservers:], ", ")+" ignored"))
+	}
+
+	if len(file.Search) > maxSearchDomains {
+		issues = append(issues, fmt.Sprintf("%s: %d search domains, more than the %d older glibc and kubelet use",
+			file.Source, len(file.Search), maxSearchDomains))
+	}
+
+	// Every ClusterFirst pod has ndots:5 and the three cluster domains; search
+	// domains inherited from the host on top of them multiply every external lookup
+	if file.Ndots >= 5 && len(file.Search) > clusterSearchDomains {
+		issues = append(issues, fmt.Sprintf("%s: ndots:%d with %d search domains, so a name like google.com is tried %d times (each for A and AAAA) before it resolves",
+			file.Source, file.Ndots, len(file.Search), len(file.Search)+1))
+	}
+
+	// The host's own resolv.conf may point at a local stub; the files handed
+	// to pods must not, since a pod's loopback is its own
+	if file.Source == "pod" || file.Source == "kubelet" {
+		for _, ns := range file.Nameservers {
+			ip := net.ParseIP(ns)
+			if ip == nil || !ip.IsLoopback() {
+				continue
+			}
+			issue := fmt.Sprintf("%s: loopback nameserver %s", file.Source, ns)
+			if file.Source == "kubelet" {
+				issue += " is handed to dnsPolicy: Default pods, so CoreDNS forwards to itself"
+				if ns == "127.0.0.53" {
+					issue += " (systemd-resolved stub; point kubelet --resolv-conf at /run/systemd/resolve/resolv.conf)"
+				}
+			} else {
+				issue += " points at the pod itself"
+			}
+			issues = append(issues, issue)
+		}
+	}
+
+	return issues
+}
+
+func (c *ResolvConfCheck) IsLocal() bool {
+	return true
+}
+
+func (c *ResolvConfCheck) HostNetworkOnly() bool {
+	return false
+}
+
+func (c *ResolvConfCheck) AlwaysShow() bool {
+	return false
+}
+
+func (c *ResolvConfCheck) DefaultTimeout() time.Duration {
+	return DefaultCheckTimeout
+}
+
+func (c *ResolvConfCheck) FormatSummary(details interface{}, quiet bool) string {
+	detailsMap, ok := details.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	rc, ok := detailsMap["resolvconf"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	var parts []string
+	files, _ := rc["files"].([]interface{})
+	for _, f := range files {
+		file, ok := f.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		source, _ := file["source"].(string)
+		nameservers, _ := file["nameservers"].([]interface{})
+		search, _ := file["search"].([]interface{})
+		ndots, _ := file["ndots"].(float64)
+
+		part := fmt.Sprintf("%s: %d nameservers, %d search, ndots:%d", source, len(nameservers), len(search), int(ndots))
+		if !quiet && len(nameservers) > 0 {
+			servers := make([]string, 0, len(nameservers))
+			for _, ns := range nameservers {
+				if s, ok := ns.(string); ok {
+					servers = append(servers, s)
+				}
+			}
+			part += " (" + strings.Join(servers, ", ") + ")"
+		}
+		parts = append(parts, part)
+	}
+	summary := strings.Join(parts, ", ")
+
+	if issues, _ := rc["issues"].([]interface{}); len(issues) > 0 {
+		strs := make([]string, len(issues))
+		for i, issue := range issues {
+			strs[i], _ = issue.(string)
+		}
+		summary += " | " + strings.Join(strs, "; ")
+	}
+
+	return summary
+}
+
+func NewResolvConfCheck(networkType types.NetworkType) *ResolvConfCheck {
+	return &ResolvConfCheck{
+		NetworkType: networkType,
+	}
+}
+
+func init() {
+	types.DefaultRegistry.Register(NewResolvConfCheck(""))
+}
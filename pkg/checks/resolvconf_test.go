@@ -0,0 +1,88 @@
+package checks
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+func TestParseResolvConf(t *testing.T) {
+	conf, err := parseResolvConf(strings.NewReader(`# generated by kubelet
+search default.svc.cluster.local svc.cluster.local cluster.local
+nameserver 10.43.0.10
+nameserver bogus
+options ndots:5 timeout:1
+`))
+	if err != nil {
+		t.Fatalf("parseResolvConf: %v", err)
+	}
+
+	if !slices.Equal(conf.Nameservers, []string{"10.43.0.10:53"}) {
+		t.Errorf("Nameservers = %v", conf.Nameservers)
+	}
+	if conf.Ndots != 5 {
+		t.Errorf("Ndots = %d, want 5", conf.Ndots)
+	}
+
+	want := []string{
+		"kubernetes.default.default.svc.cluster.local.",
+		"kubernetes.default.svc.cluster.local.",
+		"kubernetes.default.cluster.local.",
+		"kubernetes.default.",
+	}
+	if got := conf.candidates("kubernetes.default"); !slices.Equal(got, want) {
+		t.Errorf("candidates = %v, want %v", got, want)
+	}
+	if got := conf.candidates("google.com."); !slices.Equal(got, []string{"google.com."}) {
+		t.Errorf("candidates of a fully qualified name = %v", got)
+	}
+}
+
+func TestResolvConfIssues(t *testing.T) {
+	clusterSearch := []string{"default.svc.cluster.local", "svc.cluster.local", "cluster.local"}
+
+	tests := []struct {
+		name string
+		file types.ResolvConfFile
+		want []string
+	}{
+		{
+			name: "default pod",
+			file: types.ResolvConfFile{Source: "pod", Nameservers: []string{"10.43.0.10"}, Search: clusterSearch, Ndots: 5},
+		},
+		{
+			name: "host search domains on ndots:5",
+			file: types.ResolvConfFile{Source: "pod", Nameservers: []string{"10.43.0.10"}, Search: append(clusterSearch, "ec2.internal"), Ndots: 5},
+			want: []string{"pod: ndots:5 with 4 search domains, so a name like google.com is tried 5 times (each for A and AAAA) before it resolves"},
+		},
+		{
+			name: "too many nameservers",
+			file: types.ResolvConfFile{Source: "host", Nameservers: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"}, Ndots: 1},
+			want: []string{"host: 4 nameservers, only the first 3 are used (10.0.0.4 ignored)"},
+		},
+		{
+			name: "too many search domains",
+			file: types.ResolvConfFile{Source: "host", Search: []string{"a", "b", "c", "d", "e", "f", "g"}, Ndots: 1},
+			want: []string{"host: 7 search domains, more than the 6 older glibc and kubelet use"},
+		},
+		{
+			name: "systemd-resolved stub on the host is fine",
+			file: types.ResolvConfFile{Source: "host", Nameservers: []string{"127.0.0.53"}, Ndots: 1},
+		},
+		{
+			name: "systemd-resolved stub handed to pods",
+			file: types.ResolvConfFile{Source: "kubelet", Nameservers: []string{"127.0.0.53"}, Ndots: 1},
+			want: []string{"kubelet: loopback nameserver 127.0.0.53 is handed to dnsPolicy: Default pods, so CoreDNS forwards to itself (systemd-resolved stub; point kubelet --resolv-conf at /run/systemd/resolve/resolv.conf)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolvConfIssues(tt.file); !slices.Equal(got, tt.want) {
+				t.Errorf("resolvConfIssues() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+const (
+	// ServiceRequests is how many connections the service check opens to the
+	// Service, each one load balanced on its own.
+	ServiceRequests = 20
+
+	// serviceRequestsPerBackend is how many requests each expected backend
+	// gets on average, so a backend that never answers is unlikely to be down
+	// to chance.
+	serviceRequestsPerBackend = 5
+
+	// serviceRequestTimeout is how long one request through the Service may take.
+	serviceRequestTimeout = time.Second
+)
+
+type ServiceCheck struct {
+	// Requests is the number of requests, by default ServiceRequests or
+	// serviceRequestsPerBackend per expected backend, whichever is more.
+	Requests int
+	// Backends are the node names of the overlay agents behind the Service.
+	Backends []string
+}
+
+func (c *ServiceCheck) Name() string {
+	return "service"
+}
+
+func (c *ServiceCheck) Description() string {
+	return "Connects to the ClusterIP Service in front of the overlay agents over and over and records which backends answered. Failed requests point at stale or missing kube-proxy (iptables/IPVS) or eBPF service rules on the node."
+}
+
+func (c *ServiceCheck) Run(ctx context.Context, target string) (*types.TestResult, error) {
+	result := &types.TestResult{
+		Check:  c.Name(),
+		Target: target,
+		Status: types.StatusPass,
+	}
+
+	if target == "" {
+		result.Status = types.StatusFail
+		result.Error = "no Service address in the run config"
+		return result, nil
+	}
+
+	requests := c.requests()
+
+	// A new connection per request, so every request is load balanced again
+	client := &http.Client{
+		Timeout:   serviceRequestTimeout,
+		Transport: &http.Transport{DisableKeepAlives: true},
+	}
+	url := "http://" + target + types.WhoamiPath
+
+	details := types.ServiceCheckDetails{
+		Address:  target,
+		Requests: requests,
+		Backends: make(map[string]int),
+		Errors:   make(map[string]int),
+	}
+
+	for i := 0; i < requests; i++ {
+		backend, err := whoami(ctx, client, url)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			details.Errors[err.Error()]++
+			continue
+		}
+		details.Succeeded++
+		details.Backends[backend]++
+	}
+
+	if details.Succeeded < requests {
+		result.Status = types.StatusFail
+		result.Error = fmt.Sprintf("%d/%d requests failed: %s", requests-details.Succeeded, requests, mostCommon(details.Errors))
+	}
+
+	// Load balancing may skip a backend by chance, so a silent one is only
+	// a warning
+	details.Missing = missingBackends(c.Backends, details.Backends)
+	if len(details.Missing) > 0 {
+		log.Printf("[service] Warning: no answer from the backends on %s", strings.Join(details.Missing, ", "))
+	}
+
+	result.Details = map[string]interface{}{
+		"service": details,
+	}
+
+	return result, nil
+}
+
+func (c *ServiceCheck) requests() int {
+	if c.Requests > 0 {
+		return c.Requests
+	}
+	return max(ServiceRequests, serviceRequestsPerBackend*len(c.Backends))
+}
+
+// missingBackends returns the expected backends that never answered, sorted.
+func missingBackends(expected []string, answered map[string]int) []string {
+	var missing []string
+	for _, backend := range expected {
+		if answered[backend] == 0 {
+			missing = append(missing, backend)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// mostCommon returns the most frequent key of counts.
+func mostCommon(counts map[string]int) string {
+	best, bestCount := "", 0
+	for key, count := range counts {
+		if count > bestCount || (count == bestCount && key < best) {
+			best, bestCount = key, count
+		}
+	}
+	return best
+}
+
+func (c *ServiceCheck) IsLocal() bool {
+	return true
+}
+
+func (c *ServiceCheck) HostNetworkOnly() bool {
+	return false
+}
+
+func (c *ServiceCheck) AlwaysShow() bool {
+	return false
+}
+
+// DefaultTimeout covers every request timing out, which for more than
+// ServiceRequests requests is longer than DefaultServiceTimeout.
+func (c *ServiceCheck) DefaultTimeout() time.Duration {
+	return max(DefaultServiceTimeout, time.Duration(c.requests())*serviceRequestTimeout+5*time.Second)
+}
+
+func (c *ServiceCheck) FormatSummary(details interface{}, quiet bool) string {
+	detailsMap, ok := details.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	m, ok := detailsMap["service"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	address, _ := m["address"].(string)
+	requests, _ := m["requests"].(float64)
+	succeeded, _ := m["succeeded"].(float64)
+	backends, _ := m["backends"].(map[string]interface{})
+
+	summary := fmt.Sprintf("%s: %d/%d answered by %d backends", address, int(succeeded), int(requests), len(backends))
+	if !quiet && len(backends) > 0 {
+		names := make([]string, 0, len(backends))
+		for name := range backends {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		parts := make([]string, 0, len(names))
+		for _, name := range names {
+			count, _ := backends[name].(float64)
+			parts = append(parts, fmt.Sprintf("%s %d", name, int(count)))
+		}
+		summary += " (" + strings.Join(parts, ", ") + ")"
+	}
+	if missing, _ := m["missing"].([]interface{}); len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for _, name := range missing {
+			if s, ok := name.(string); ok {
+				names = append(names, s)
+			}
+		}
+		summary += "; warning: no answer from " + strings.Join(names, ", ")
+	}
+	return summary
+}
+
+// NewServiceCheck builds a service check expecting answers from the given
+// backends. requests of 0 picks the number of requests from the backends.
+func NewServiceCheck(requests int, backends []string) *ServiceCheck {
+	return &ServiceCheck{
+		Requests: requests,
+		Backends: backends,
+	}
+}
+
+func init() {
+	types.DefaultRegistry.Register(NewServiceCheck(0, nil))
+}
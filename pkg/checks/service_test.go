@@ -0,0 +1,94 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+func TestServiceCheck_Run(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != types.WhoamiPath {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "node-a")
+	}))
+	defer server.Close()
+
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	result, err := NewServiceCheck(5, nil).Run(context.Background(), address)
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if result.Status != types.StatusPass {
+		t.Fatalf("status = %s, want pass (%s)", result.Status, result.Error)
+	}
+
+	details := result.Details["service"].(types.ServiceCheckDetails)
+	if details.Succeeded != 5 || details.Backends["node-a"] != 5 {
+		t.Errorf("succeeded = %d, backends = %v, want 5 answers from node-a", details.Succeeded, details.Backends)
+	}
+
+	server.Close()
+
+	result, err = NewServiceCheck(2, nil).Run(context.Background(), address)
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if result.Status != types.StatusFail {
+		t.Errorf("status with no backend = %s, want fail", result.Status)
+	}
+}
+
+func TestServiceCheck_NoAddress(t *testing.T) {
+	result, err := NewServiceCheck(0, nil).Run(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if result.Status != types.StatusFail {
+		t.Errorf("status without address = %s, want fail", result.Status)
+	}
+}
+
+func TestServiceCheck_MissingBackends(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "node-a")
+	}))
+	defer server.Close()
+
+	check := NewServiceCheck(0, []string{"node-c", "node-a", "node-b"})
+	if got := check.requests(); got != ServiceRequests {
+		t.Errorf("requests() for 3 backends = %d, want %d", got, ServiceRequests)
+	}
+
+	result, err := check.Run(context.Background(), strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if result.Status != types.StatusPass {
+		t.Errorf("status = %s, want pass with a warning (%s)", result.Status, result.Error)
+	}
+
+	details := result.Details["service"].(types.ServiceCheckDetails)
+	if want := []string{"node-b", "node-c"}; !slices.Equal(details.Missing, want) {
+		t.Errorf("missing = %v, want %v", details.Missing, want)
+	}
+}
+
+func TestServiceCheck_Requests(t *testing.T) {
+	backends := make([]string, 10)
+	if got := NewServiceCheck(0, backends).requests(); got != 10*serviceRequestsPerBackend {
+		t.Errorf("requests() for 10 backends = %d, want %d", got, 10*serviceRequestsPerBackend)
+	}
+	if got := NewServiceCheck(7, backends).requests(); got != 7 {
+		t.Errorf("requests() with an explicit count = %d, want 7", got)
+	}
+}
@@ -0,0 +1,171 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+const (
+	// KubeletPort is open on every node, which makes it the tcpping target on
+	// the host network.
+	KubeletPort = 10250
+
+	// tcpPingDialTimeout is how long a single handshake may take before it
+	// counts as lost.
+	tcpPingDialTimeout = time.Second
+
+	// tcpPingInterval is the pause between handshakes.
+	tcpPingInterval = 200 * time.Millisecond
+)
+
+type TCPPingCheck struct {
+	Port  int
+	Count int
+}
+
+func (c *TCPPingCheck) Name() string {
+	return "tcpping"
+}
+
+func (c *TCPPingCheck) Description() string {
+	return "Measures TCP handshake latency to a port known to be open on each node (the kubelet on the host network, the netdebug agent on the overlay). Use it in place of ping where ICMP is filtered."
+}
+
+func (c *TCPPingCheck) Run(ctx context.Context, target string) (*types.TestResult, error) {
+	result := &types.TestResult{
+		Check:  c.Name(),
+		Target: target,
+		Status: types.StatusPass,
+	}
+
+	count := c.Count
+	if count == 0 {
+		count = DefaultPingCount
+	}
+
+	address := net.JoinHostPort(target, strconv.Itoa(c.Port))
+	dialer := &net.Dialer{Timeout: tcpPingDialTimeout}
+
+	var rtts []time.Duration
+	var lastErr error
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(tcpPingInterval):
+			}
+		}
+
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+		rtts = append(rtts, time.Since(start))
+		conn.Close()
+	}
+
+	details := types.TCPPingCheckDetails{
+		Port:            c.Port,
+		PacketsSent:     count,
+		PacketsReceived: len(rtts),
+		PacketLoss:      float64(count-len(rtts)) / float64(count) * 100,
+	}
+
+	if len(rtts) > 0 {
+		minRTT, maxRTT, total := rtts[0], rtts[0], time.Duration(0)
+		for _, rtt := range rtts {
+			minRTT = min(minRTT, rtt)
+			maxRTT = max(maxRTT, rtt)
+			total += rtt
+		}
+		details.MinLatencyMS = float64(minRTT.Microseconds()) / 1000.0
+		details.AvgLatencyMS = float64((total / time.Duration(len(rtts))).Microseconds()) / 1000.0
+		details.MaxLatencyMS = float64(maxRTT.Microseconds()) / 1000.0
+	}
+
+	if details.PacketLoss > 0 {
+		result.Status = types.StatusFail
+		result.Error = fmt.Sprintf("%.1f%% loss to port %d: %v", details.PacketLoss, c.Port, lastErr)
+	}
+
+	result.Details = map[string]interface{}{
+		"tcpping": details,
+	}
+
+	return result, nil
+}
+
+func (c *TCPPingCheck) IsLocal() bool {
+	return false
+}
+
+func (c *TCPPingCheck) HostNetworkOnly() bool {
+	return false
+}
+
+func (c *TCPPingCheck) AlwaysShow() bool {
+	return false
+}
+
+// DefaultTimeout gives every handshake its full dial timeout.
+func (c *TCPPingCheck) DefaultTimeout() time.Duration {
+	if c.Count == 0 || c.Count == DefaultPingCount {
+		return DefaultTCPPingTimeout
+	}
+	return time.Duration(c.Count)*(tcpPingDialTimeout+tcpPingInterval) + 2*time.Second
+}
+
+func (c *TCPPingCheck) FormatSummary(details interface{}, quiet bool) string {
+	detailsMap, ok := details.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	m, ok := detailsMap["tcpping"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	port, _ := m["port"].(float64)
+	sent, _ := m["packets_sent"].(float64)
+	received, _ := m["packets_received"].(float64)
+	loss, _ := m["packet_loss_percent"].(float64)
+	minLatency, _ := m["min_latency_ms"].(float64)
+	avgLatency, _ := m["avg_latency_ms"].(float64)
+	maxLatency, _ := m["max_latency_ms"].(float64)
+
+	return fmt.Sprintf("port %.0f: %.0f sent, %.0f received, %.1f%% loss, min/avg/max %.2f/%.2f/%.2fms",
+		port, sent, received, loss, minLatency, avgLatency, maxLatency)
+}
+
+// NewTCPPingCheck builds a tcpping check against the port that is known to be
+// open for the network type, unless port is set.
+func NewTCPPingCheck(port, count int, networkType types.NetworkType) *TCPPingCheck {
+	if port == 0 {
+		port = KubeletPort
+		if networkType == types.NetworkTypeOverlay {
+			port = types.AgentPort
+		}
+	}
+	if count == 0 {
+		count = DefaultPingCount
+	}
+	return &TCPPingCheck{
+		Port:  port,
+		Count: count,
+	}
+}
+
+func init() {
+	types.DefaultRegistry.Register(NewTCPPingCheck(0, 0, ""))
+}
@@ -0,0 +1,76 @@
+package checks
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+func TestNewTCPPingCheck_Port(t *testing.T) {
+	tests := []struct {
+		name        string
+		port        int
+		networkType types.NetworkType
+		want        int
+	}{
+		{"host uses kubelet", 0, types.NetworkTypeHost, KubeletPort},
+		{"overlay uses agent", 0, types.NetworkTypeOverlay, types.AgentPort},
+		{"explicit port wins", 6443, types.NetworkTypeOverlay, 6443},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewTCPPingCheck(tt.port, 0, tt.networkType).Port; got != tt.want {
+				t.Errorf("Port = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTCPPingCheck_Run(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start TCP listener: %v", err)
+	}
+	openPort := ln.Addr().(*net.TCPAddr).Port
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	ctx := context.Background()
+
+	result, err := NewTCPPingCheck(openPort, 3, "").Run(ctx, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if result.Status != types.StatusPass {
+		t.Errorf("open port: status = %s, want pass (%s)", result.Status, result.Error)
+	}
+	details := result.Details["tcpping"].(types.TCPPingCheckDetails)
+	if details.PacketsSent != 3 || details.PacketsReceived != 3 {
+		t.Errorf("open port: sent/received = %d/%d, want 3/3", details.PacketsSent, details.PacketsReceived)
+	}
+
+	ln.Close()
+
+	result, err = NewTCPPingCheck(openPort, 2, "").Run(ctx, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if result.Status != types.StatusFail {
+		t.Errorf("closed port: status = %s, want fail", result.Status)
+	}
+	details = result.Details["tcpping"].(types.TCPPingCheckDetails)
+	if details.PacketLoss != 100 {
+		t.Errorf("closed port: loss = %.1f%%, want 100%%", details.PacketLoss)
+	}
+}
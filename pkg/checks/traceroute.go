@@ -0,0 +1,251 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+const (
+	// TracerouteMaxHops is the deepest hop probed.
+	TracerouteMaxHops = 15
+
+	// tracerouteQueries is the number of probes sent to each hop.
+	tracerouteQueries = 3
+)
+
+// TracerouteProtocols are the probe types the traceroute check runs, in order.
+var TracerouteProtocols = []string{"udp", "icmp", "tcp"}
+
+type TracerouteCheck struct {
+	// TCPPort is the destination port for TCP SYN probes. A closed port still
+	// answers with a RST, which is enough to show the target was reached.
+	TCPPort int
+}
+
+func (c *TracerouteCheck) Name() string {
+	return "traceroute"
+}
+
+func (c *TracerouteCheck) Description() string {
+	return "Traces the path to each node over UDP, ICMP and TCP SYN, recording every hop with its RTT and loss. Runs automatically against targets that fail ping, to tell a dead node from a broken hop in between."
+}
+
+func (c *TracerouteCheck) Run(ctx context.Context, target string) (*types.TestResult, error) {
+	result := &types.TestResult{
+		Check:  c.Name(),
+		Target: target,
+		Status: types.StatusPass,
+	}
+
+	var traces []types.TracerouteDetails
+	reached := false
+
+	for _, protocol := range TracerouteProtocols {
+		trace := c.trace(ctx, target, protocol)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if trace.Reached {
+			reached = true
+		}
+		traces = append(traces, trace)
+	}
+
+	result.Details = map[string]interface{}{
+		"traces": traces,
+	}
+
+	if !reached {
+		result.Status = types.StatusFail
+		result.Error = "target not reached over " + strings.Join(TracerouteProtocols, ", ")
+	}
+
+	return result, nil
+}
+
+// trace runs traceroute once with the given probe protocol.
+func (c *TracerouteCheck) trace(ctx context.Context, target, protocol string) types.TracerouteDetails {
+	details := types.TracerouteDetails{Protocol: protocol}
+
+	args := []string{"-n", "-q", strconv.Itoa(tracerouteQueries), "-w", "1", "-m", strconv.Itoa(TracerouteMaxHops)}
+	switch protocol {
+	case "icmp":
+		args = append(args, "-I")
+	case "tcp":
+		args = append(args, "-T", "-p", strconv.Itoa(c.TCPPort))
+	}
+	args = append(args, target)
+
+	out, err := exec.CommandContext(ctx, "traceroute", args...).CombinedOutput()
+	if err != nil {
+		details.Error = fmt.Sprintf("traceroute failed: %v: %s", err, strings.TrimSpace(string(out)))
+		return details
+	}
+
+	details.Hops = ParseTraceroute(string(out))
+
+	targetIP := target
+	if ip := net.ParseIP(target); ip == nil {
+		if addrs, err := net.DefaultResolver.LookupHost(ctx, target); err == nil && len(addrs) > 0 {
+			targetIP = addrs[0]
+		}
+	}
+	for _, hop := range details.Hops {
+		if hop.Address == targetIP {
+			details.Reached = true
+			break
+		}
+	}
+
+	return details
+}
+
+// ParseTraceroute parses the hops out of `traceroute -n` output. Each hop line
+// holds the hop number followed by, per probe, either "*" or an address (only
+// repeated when it changes) with its RTT and an optional "!" annotation.
+func ParseTraceroute(output string) []types.TracerouteHop {
+	var hops []types.TracerouteHop
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		hopNum, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+
+		hop := types.TracerouteHop{Hop: hopNum}
+		var rtts []float64
+		addr := ""
+
+		for i := 1; i < len(fields); i++ {
+			field := fields[i]
+			switch {
+			case field == "*":
+				hop.Sent++
+			case field == "ms":
+			case strings.HasPrefix(field, "!"):
+				hop.Note = field
+			case net.ParseIP(field) != nil:
+				addr = field
+				if hop.Address == "" {
+					hop.Address = field
+				}
+			default:
+				rtt, err := strconv.ParseFloat(field, 64)
+				if err != nil || addr == "" {
+					continue
+				}
+				hop.Sent++
+				hop.Received++
+				rtts = append(rtts, rtt)
+			}
+		}
+
+		if len(rtts) > 0 {
+			var sum float64
+			for _, rtt := range rtts {
+				sum += rtt
+			}
+			hop.AvgRTTMS = sum / float64(len(rtts))
+		}
+		if hop.Sent > 0 {
+			hop.Loss = float64(hop.Sent-hop.Received) / float64(hop.Sent) * 100
+		}
+
+		hops = append(hops, hop)
+	}
+
+	return hops
+}
+
+func (c *TracerouteCheck) IsLocal() bool {
+	return false
+}
+
+func (c *TracerouteCheck) HostNetworkOnly() bool {
+	return false
+}
+
+func (c *TracerouteCheck) AlwaysShow() bool {
+	return false
+}
+
+func (c *TracerouteCheck) DefaultTimeout() time.Duration {
+	return DefaultTracerouteTimeout
+}
+
+func (c *TracerouteCheck) FormatSummary(details interface{}, quiet bool) string {
+	detailsMap, ok := details.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	traces, ok := detailsMap["traces"].([]interface{})
+	if !ok {
+		return ""
+	}
+
+	var parts []string
+	for _, t := range traces {
+		trace, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		protocol, _ := trace["protocol"].(string)
+		parts = append(parts, protocol+": "+formatTrace(trace))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// formatTrace describes one trace: the hop count if the target was reached,
+// otherwise the last hop that answered, which is where the path breaks.
+func formatTrace(trace map[string]interface{}) string {
+	if errStr, _ := trace["error"].(string); errStr != "" {
+		return "error"
+	}
+
+	hops, _ := trace["hops"].([]interface{})
+	if reached, _ := trace["reached"].(bool); reached {
+		return fmt.Sprintf("reached in %d hops", len(hops))
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := hops[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if addr, _ := hop["address"].(string); addr != "" {
+			num, _ := hop["hop"].(float64)
+			summary := fmt.Sprintf("stops after hop %d (%s)", int(num), addr)
+			if note, _ := hop["note"].(string); note != "" {
+				summary += " " + note
+			}
+			return summary
+		}
+	}
+
+	return "no hop answered"
+}
+
+func NewTracerouteCheck(tcpPort int) *TracerouteCheck {
+	if tcpPort == 0 {
+		tcpPort = types.AgentPort
+	}
+	return &TracerouteCheck{
+		TCPPort: tcpPort,
+	}
+}
+
+func init() {
+	types.DefaultRegistry.Register(NewTracerouteCheck(0))
+}
@@ -0,0 +1,39 @@
+package checks
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseTraceroute(t *testing.T) {
+	output := `traceroute to 10.0.2.5 (10.0.2.5), 15 hops max, 60 byte packets
+ 1  10.0.0.1  0.412 ms  0.380 ms  0.355 ms
+ 2  10.0.1.1  1.100 ms 10.0.1.2  1.300 ms  *
+ 3  * * *
+ 4  10.0.2.5  2.000 ms !H  *  *
+`
+
+	hops := ParseTraceroute(output)
+	if len(hops) != 4 {
+		t.Fatalf("ParseTraceroute returned %d hops, want 4: %+v", len(hops), hops)
+	}
+
+	if hops[0].Address != "10.0.0.1" || hops[0].Received != 3 || hops[0].Loss != 0 {
+		t.Errorf("hop 1 = %+v, want 10.0.0.1 with 3/3 replies", hops[0])
+	}
+
+	if hops[1].Address != "10.0.1.1" || hops[1].Sent != 3 || hops[1].Received != 2 {
+		t.Errorf("hop 2 = %+v, want first address 10.0.1.1 with 2/3 replies", hops[1])
+	}
+	if math.Abs(hops[1].AvgRTTMS-1.2) > 1e-9 {
+		t.Errorf("hop 2 avg RTT = %v, want 1.2", hops[1].AvgRTTMS)
+	}
+
+	if hops[2].Address != "" || hops[2].Sent != 3 || hops[2].Loss != 100 {
+		t.Errorf("hop 3 = %+v, want no address and 100%% loss", hops[2])
+	}
+
+	if hops[3].Note != "!H" || hops[3].Received != 1 {
+		t.Errorf("hop 4 = %+v, want !H with 1 reply", hops[3])
+	}
+}
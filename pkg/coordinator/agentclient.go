@@ -0,0 +1,142 @@
+package coordinator
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// AgentClient sends runs to agents over their HTTP control API, reached through
+// the API server pod proxy, and streams the resulting events back.
+type AgentClient struct {
+	clientset *kubernetes.Clientset
+	namespace string
+	token     string
+	eventChan chan *types.Event
+	errorChan chan error
+	wg        sync.WaitGroup
+}
+
+func NewAgentClient(clientset *kubernetes.Clientset, namespace, token string) *AgentClient {
+	return &AgentClient{
+		clientset: clientset,
+		namespace: namespace,
+		token:     token,
+		eventChan: make(chan *types.Event, 100),
+		errorChan: make(chan error, 10),
+	}
+}
+
+func (ac *AgentClient) EventChan() <-chan *types.Event {
+	return ac.eventChan
+}
+
+func (ac *AgentClient) ErrorChan() <-chan error {
+	return ac.errorChan
+}
+
+// Ping checks that the agent's HTTP server is reachable through the pod proxy.
+func (ac *AgentClient) Ping(ctx context.Context, podName string) error {
+	_, err := ac.clientset.CoreV1().Pods(ac.namespace).
+		ProxyGet("http", podName, strconv.Itoa(types.AgentPort), "healthz", nil).
+		DoRaw(ctx)
+	if err != nil {
+		return fmt.Errorf("agent API on pod %s unreachable: %w", podName, err)
+	}
+	return nil
+}
+
+// StartRun posts the config to the pod's agent and streams its events until
+// the run finishes or the context is cancelled.
+func (ac *AgentClient) StartRun(ctx context.Context, podName string, config *types.Config) {
+	ac.wg.Add(1)
+	go ac.streamRun(ctx, podName, config)
+}
+
+func (ac *AgentClient) streamRun(ctx context.Context, podName string, config *types.Config) {
+	defer ac.wg.Done()
+
+	body, err := json.Marshal(config)
+	if err != nil {
+		ac.sendError(ctx, fmt.Errorf("failed to marshal config: %w", err))
+		return
+	}
+
+	stream, err := ac.clientset.CoreV1().RESTClient().Post().
+		Namespace(ac.namespace).
+		Resource("pods").
+		Name(fmt.Sprintf("%s:%d", podName, types.AgentPort)).
+		SubResource("proxy").
+		Suffix("v1", "runs").
+		SetHeader(types.TokenHeader, ac.token).
+		SetHeader("Content-Type", "application/json").
+		Body(body).
+		Stream(ctx)
+	if err != nil {
+		ac.sendError(ctx, fmt.Errorf("failed to start run on pod %s: %w", podName, err))
+		return
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event types.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+
+		select {
+		case ac.eventChan <- &event:
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		ac.sendError(ctx, fmt.Errorf("error reading events from pod %s: %w", podName, err))
+	}
+}
+
+// CancelRun asks the pod's agent to abort the run.
+func (ac *AgentClient) CancelRun(ctx context.Context, podName, runID string) error {
+	body, err := json.Marshal(&types.Config{RunID: runID, Cancelled: true})
+	if err != nil {
+		return fmt.Errorf("failed to marshal cancellation: %w", err)
+	}
+
+	err = ac.clientset.CoreV1().RESTClient().Post().
+		Namespace(ac.namespace).
+		Resource("pods").
+		Name(fmt.Sprintf("%s:%d", podName, types.AgentPort)).
+		SubResource("proxy").
+		Suffix("v1", "runs").
+		SetHeader(types.TokenHeader, ac.token).
+		SetHeader("Content-Type", "application/json").
+		Body(body).
+		Do(ctx).
+		Error()
+	if err != nil {
+		return fmt.Errorf("failed to cancel run on pod %s: %w", podName, err)
+	}
+	return nil
+}
+
+func (ac *AgentClient) sendError(ctx context.Context, err error) {
+	select {
+	case ac.errorChan <- err:
+	case <-ctx.Done():
+	}
+}
+
+func (ac *AgentClient) Close() {
+	ac.wg.Wait()
+	close(ac.eventChan)
+	close(ac.errorChan)
+}
@@ -1,6 +1,7 @@
 package coordinator
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/ryanelliottsmith/network-debugger/pkg/types"
@@ -44,6 +45,11 @@ func (a *Aggregator) AddEvent(event *types.Event) {
 		a.readyPods[podKey] = true
 	case types.EventTypeComplete:
 		a.completedPods[podKey] = true
+	case types.EventTypeCancelled, types.EventTypeCrashed:
+		// A pod that crashed or was cancelled before it got ready won't ever
+		// be, so it mustn't hold up the wait for the others
+		a.readyPods[podKey] = true
+		a.completedPods[podKey] = true
 	}
 }
 
@@ -123,3 +129,146 @@ func (a *Aggregator) GetExpectedCount() int {
 	defer a.mu.RUnlock()
 	return len(a.expectedPods)
 }
+
+// Reasons given on synthesized incomplete results.
+const (
+	reasonNeverReady  = "pod never ready"
+	reasonTimeout     = "no result before timeout"
+	reasonInterrupted = "run interrupted"
+	reasonCancelled   = "run cancelled"
+	reasonNotReported = "no result reported"
+)
+
+// expectedTest is one (pod, check, target) combination a run should report.
+// Target is empty for local checks, which run once per pod.
+type expectedTest struct {
+	pod    string
+	node   string
+	check  string
+	target string
+}
+
+// expectedTests builds the test matrix the agents should report for the config,
+// mirroring how agent.RunTests fans checks out over targets.
+func expectedTests(config *types.Config, podNames []string, podNodes map[string]string) []expectedTest {
+	var tests []expectedTest
+
+	for _, pod := range podNames {
+		node := podNodes[pod]
+
+		for _, checkName := range config.Checks {
+			if checkName == "bandwidth" {
+				continue
+			}
+			check := types.DefaultRegistry.Get(checkName)
+			if check == nil {
+				continue
+			}
+
+			if check.IsLocal() {
+				tests = append(tests, expectedTest{pod: pod, node: node, check: checkName})
+				continue
+			}
+
+			for _, target := range config.Targets {
+				ownNode := target.PodName == pod || (node != "" && target.NodeName == node)
+				if ownNode && !config.NetworkType.TargetsOwnNode() && checkName != "nodeport" {
+					continue
+				}
+				// nodeport results, like bandwidth, name the target node
+				targetKey := target.IP
+				if checkName == "nodeport" {
+					targetKey = target.NodeName
+				}
+				tests = append(tests, expectedTest{pod: pod, node: node, check: checkName, target: targetKey})
+			}
+		}
+	}
+
+	if bw := config.BandwidthTest; bw != nil && bw.Active {
+		for _, pod := range podNames {
+			if pod == bw.SourcePod {
+				tests = append(tests, expectedTest{pod: pod, node: bw.SourceNode, check: "bandwidth", target: bw.TargetNode})
+			}
+		}
+	}
+
+	return tests
+}
+
+// IncompleteResults returns an incomplete test_result event for every test the
+// config expects that never reported. pending is the reason given for pods
+// that were still running when collection stopped.
+func (a *Aggregator) IncompleteResults(config *types.Config, pending string) []*types.Event {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	podNodes := make(map[string]string)
+	for _, target := range config.Targets {
+		if target.PodName != "" {
+			podNodes[target.PodName] = target.NodeName
+		}
+	}
+
+	reported := make(map[expectedTest]bool)
+	podReasons := make(map[string]string)
+	for _, event := range a.events {
+		podKey := event.Pod
+		if podKey == "" {
+			podKey = event.Node
+		}
+
+		switch event.Type {
+		case types.EventTypeReady:
+			if event.Node != "" {
+				podNodes[podKey] = event.Node
+			}
+		case types.EventTypeTestResult:
+			key := expectedTest{pod: podKey, check: event.Check, target: event.Target}
+			if check := types.DefaultRegistry.Get(event.Check); check != nil && check.IsLocal() {
+				key.target = ""
+			}
+			reported[key] = true
+		case types.EventTypeCrashed:
+			podReasons[podKey] = event.Error
+		case types.EventTypeCancelled:
+			podReasons[podKey] = reasonCancelled
+		case types.EventTypeError:
+			podReasons[podKey] = "agent error: " + event.Error
+		case types.EventTypeComplete:
+			podReasons[podKey] = reasonNotReported
+		}
+	}
+
+	podNames := make([]string, 0, len(a.expectedPods))
+	for pod := range a.expectedPods {
+		podNames = append(podNames, pod)
+	}
+	sort.Strings(podNames)
+
+	var incomplete []*types.Event
+	for _, test := range expectedTests(config, podNames, podNodes) {
+		if reported[expectedTest{pod: test.pod, check: test.check, target: test.target}] {
+			continue
+		}
+
+		reason := podReasons[test.pod]
+		if reason == "" {
+			reason = pending
+			if !a.readyPods[test.pod] {
+				reason = reasonNeverReady
+			}
+		}
+
+		node := test.node
+		if node == "" {
+			node = test.pod
+		}
+
+		event := types.TestResultEvent(node, "", test.pod, test.check, test.target, string(types.StatusIncomplete), nil, config.RunID)
+		event.Error = reason
+		incomplete = append(incomplete, event)
+	}
+
+	return incomplete
+}
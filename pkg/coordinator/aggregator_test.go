@@ -0,0 +1,118 @@
+package coordinator
+
+import (
+	"testing"
+
+	_ "github.com/ryanelliottsmith/network-debugger/pkg/checks"
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+func TestIncompleteResults(t *testing.T) {
+	config := &types.Config{
+		RunID:  "run-1",
+		Checks: []string{"ping", "dns"},
+		Targets: []types.TargetNode{
+			{NodeName: "node-a", PodName: "pod-a", IP: "10.0.0.1"},
+			{NodeName: "node-b", PodName: "pod-b", IP: "10.0.0.2"},
+			{NodeName: "node-c", PodName: "pod-c", IP: "10.0.0.3"},
+		},
+	}
+
+	agg := NewAggregator([]string{"pod-a", "pod-b", "pod-c"})
+	events := []*types.Event{
+		types.ReadyEvent("node-a", "", "pod-a", "run-1"),
+		types.TestResultEvent("node-a", "", "pod-a", "ping", "10.0.0.2", "pass", nil, "run-1"),
+		types.TestResultEvent("node-a", "", "pod-a", "ping", "10.0.0.3", "pass", nil, "run-1"),
+		types.TestResultEvent("node-a", "", "pod-a", "dns", "dns-test", "pass", nil, "run-1"),
+		types.ReadyEvent("node-b", "", "pod-b", "run-1"),
+		types.TestResultEvent("node-b", "", "pod-b", "dns", "dns-test", "pass", nil, "run-1"),
+		types.CrashedEvent("node-b", "", "pod-b", "agent container restarted (1 restarts)", "run-1"),
+	}
+	for _, event := range events {
+		agg.AddEvent(event)
+	}
+
+	got := make(map[string]string)
+	for _, event := range agg.IncompleteResults(config, reasonTimeout) {
+		if event.Status != string(types.StatusIncomplete) {
+			t.Errorf("incomplete result %s/%s has status %q", event.Pod, event.Check, event.Status)
+		}
+		got[event.Pod+"/"+event.Check+"/"+event.Target] = event.Error
+	}
+
+	want := map[string]string{
+		"pod-b/ping/10.0.0.1": "agent container restarted (1 restarts)",
+		"pod-b/ping/10.0.0.3": "agent container restarted (1 restarts)",
+		"pod-c/ping/10.0.0.1": reasonNeverReady,
+		"pod-c/ping/10.0.0.2": reasonNeverReady,
+		"pod-c/dns/":          reasonNeverReady,
+	}
+	if len(got) != len(want) {
+		t.Errorf("IncompleteResults returned %v, want %v", got, want)
+	}
+	for key, reason := range want {
+		if got[key] != reason {
+			t.Errorf("IncompleteResults[%s] = %q, want %q", key, got[key], reason)
+		}
+	}
+}
+
+func TestAggregator_CrashedPodIsReady(t *testing.T) {
+	agg := NewAggregator([]string{"pod-a", "pod-b"})
+	agg.AddEvent(types.ReadyEvent("node-a", "", "pod-a", "run-1"))
+	if agg.AllPodsReady() {
+		t.Fatal("AllPodsReady() before pod-b reported")
+	}
+
+	agg.AddEvent(types.CrashedEvent("node-b", "", "pod-b", "pod deleted", "run-1"))
+	if !agg.AllPodsReady() {
+		t.Error("AllPodsReady() = false after pod-b crashed, want true")
+	}
+	if agg.AllPodsComplete() {
+		t.Error("AllPodsComplete() = true while pod-a is running")
+	}
+
+	agg.AddEvent(types.CompleteEvent("node-a", "", "pod-a", nil, "run-1"))
+	if !agg.AllPodsComplete() {
+		t.Error("AllPodsComplete() = false after pod-a completed, want true")
+	}
+}
+
+func TestExpectedTests_OwnNode(t *testing.T) {
+	targets := []types.TargetNode{
+		{NodeName: "node-a", PodName: "overlay-a", IP: "10.42.0.5"},
+		{NodeName: "node-b", PodName: "overlay-b", IP: "10.42.1.5"},
+	}
+	podNodes := map[string]string{"host-a": "node-a"}
+
+	tests := []struct {
+		network types.NetworkType
+		want    int
+	}{
+		{types.NetworkTypeOverlay, 1},
+		{types.NetworkTypeHostToOverlay, 2},
+	}
+
+	for _, tt := range tests {
+		config := &types.Config{NetworkType: tt.network, Checks: []string{"ping"}, Targets: targets}
+		if got := expectedTests(config, []string{"host-a"}, podNodes); len(got) != tt.want {
+			t.Errorf("%s: expectedTests() = %+v, want %d tests", tt.network, got, tt.want)
+		}
+	}
+}
+
+func TestExpectedTests_NodePort(t *testing.T) {
+	config := &types.Config{
+		NetworkType: types.NetworkTypeHost,
+		Checks:      []string{"nodeport"},
+		Targets: []types.TargetNode{
+			{NodeName: "node-a", PodName: "host-a", IP: "10.0.0.1"},
+			{NodeName: "node-b", PodName: "host-b", IP: "10.0.0.2"},
+		},
+	}
+
+	got := expectedTests(config, []string{"host-a"}, map[string]string{"host-a": "node-a"})
+	if len(got) != 2 || got[0].target != "node-a" || got[1].target != "node-b" {
+		t.Errorf("expectedTests() = %+v, want nodeport against node-a and node-b", got)
+	}
+}
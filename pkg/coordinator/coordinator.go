@@ -3,29 +3,77 @@ package coordinator
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/ryanelliottsmith/network-debugger/pkg/k8s"
 	"github.com/ryanelliottsmith/network-debugger/pkg/types"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
 
+// Transport selects how runs are sent to agents and how events come back.
+type Transport string
+
+const (
+	// TransportAuto uses the CRDs when installed and the agent API when every pod answers on it,
+	// and the ConfigMap otherwise.
+	TransportAuto Transport = "auto"
+	// TransportCRD creates a NetdebugRun and reads results from NetdebugResults, so runs
+	// survive the CLI disconnecting. Bandwidth pairs don't, since the CLI starts
+	// them one after another.
+	TransportCRD Transport = "crd"
+	// TransportAPI posts runs to each agent's HTTP API through the pod proxy and streams events back.
+	TransportAPI Transport = "api"
+	// TransportConfigMap writes runs to the ConfigMap and reads events from pod logs.
+	TransportConfigMap Transport = "configmap"
+)
+
+// TokenSecretName is the Secret holding the agent API token.
+const TokenSecretName = "netdebug-token"
+
 type Coordinator struct {
-	clientset *kubernetes.Clientset
-	namespace string
-	configMap string
+	clientset     *kubernetes.Clientset
+	dynamicClient dynamic.Interface
+	namespace     string
+	configMap     string
+	transport     Transport
+	token         string
+	lock          *RunLock
 }
 
-func NewCoordinator(clientset *kubernetes.Clientset, namespace, configMap string) *Coordinator {
+// eventSource delivers agent events for a run, from pod logs, the agent API or NetdebugResults.
+type eventSource interface {
+	EventChan() <-chan *types.Event
+	ErrorChan() <-chan error
+	Close()
+}
+
+func NewCoordinator(clientset *kubernetes.Clientset, dynamicClient dynamic.Interface, namespace, configMap string) *Coordinator {
 	return &Coordinator{
-		clientset: clientset,
-		namespace: namespace,
-		configMap: configMap,
+		clientset:     clientset,
+		dynamicClient: dynamicClient,
+		namespace:     namespace,
+		configMap:     configMap,
+		transport:     TransportAuto,
 	}
 }
 
+func (c *Coordinator) SetTransport(transport Transport) {
+	c.transport = transport
+}
+
+// SetRunLock has runs record their ID in the held run lock.
+func (c *Coordinator) SetRunLock(lock *RunLock) {
+	c.lock = lock
+}
+
 func (c *Coordinator) UpdateConfig(ctx context.Context, config *types.Config) error {
 	configJSON, err := json.Marshal(config)
 	if err != nil {
@@ -51,23 +99,76 @@ func (c *Coordinator) UpdateConfig(ctx context.Context, config *types.Config) er
 }
 
 func (c *Coordinator) RunTests(ctx context.Context, config *types.Config, podNames []string, timeout time.Duration) ([]*types.Event, error) {
-	if err := c.UpdateConfig(ctx, config); err != nil {
-		return nil, fmt.Errorf("failed to update config: %w", err)
+	if c.lock != nil {
+		c.lock.SetRunID(config.RunID)
 	}
 
-	watcher := NewLogWatcher(c.clientset, c.namespace)
-	defer watcher.Close()
-
-	// Create cancellable context for log watchers
+	// Create cancellable context for event watchers
 	watchCtx, watchCancel := context.WithCancel(ctx)
-	defer watchCancel()
 
-	agg := NewAggregator(podNames)
+	watcher, transport, err := c.startRun(watchCtx, config, podNames)
+	if err != nil {
+		watchCancel()
+		return nil, err
+	}
+	defer func() {
+		watchCancel()
+		watcher.Close()
+	}()
 
-	for _, podName := range podNames {
-		watcher.WatchPod(watchCtx, podName)
+	events, err := c.collect(ctx, config, watcher, podNames, timeout)
+	if err != nil {
+		// Don't leave agents running a run nobody is waiting for
+		if cancelErr := c.cancelRun(config, transport, podNames); cancelErr != nil {
+			fmt.Printf("Warning: failed to cancel run %s: %v\n", config.RunID, cancelErr)
+		} else {
+			fmt.Printf("Cancelled run %s\n", config.RunID)
+		}
+	}
+	return events, err
+}
+
+// Attach reconnects to a run stored in a NetdebugRun and collects its results,
+// including those written while nobody was watching.
+func (c *Coordinator) Attach(ctx context.Context, runID string, timeout time.Duration) ([]*types.Event, error) {
+	run, err := c.dynamicClient.Resource(k8s.NetdebugRunGVR).Namespace(c.namespace).Get(ctx, runID, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get NetdebugRun %s: %w", runID, err)
 	}
 
+	var spec types.NetdebugRunSpec
+	if err := k8s.FromUnstructuredField(run, "spec", &spec); err != nil {
+		return nil, err
+	}
+
+	if len(spec.Pods) == 0 {
+		return nil, fmt.Errorf("NetdebugRun %s does not list its pods", runID)
+	}
+
+	// The other pairs of the test were never started, so this run's result
+	// alone would pass for a complete bandwidth test
+	if spec.Config.BandwidthTest != nil {
+		return nil, fmt.Errorf("NetdebugRun %s is one pair of a bandwidth test, which is sequenced by the CLI and can't be reattached; rerun it with --checks=bandwidth", runID)
+	}
+
+	watchCtx, watchCancel := context.WithCancel(ctx)
+
+	watcher := NewResultWatcher(c.dynamicClient, c.namespace)
+	watcher.Watch(watchCtx, runID)
+	defer func() {
+		watchCancel()
+		watcher.Close()
+	}()
+
+	return c.collect(ctx, &spec.Config, watcher, spec.Pods, timeout)
+}
+
+// collect aggregates events for the run until every pod has completed. Tests
+// the config expects but that never reported come back as incomplete results.
+func (c *Coordinator) collect(ctx context.Context, config *types.Config, watcher eventSource, podNames []string, timeout time.Duration) ([]*types.Event, error) {
+	runID := config.RunID
+	agg := NewAggregator(podNames)
+
 	testCtx := ctx
 	if timeout > 0 {
 		var cancel context.CancelFunc
@@ -75,6 +176,22 @@ func (c *Coordinator) RunTests(ctx context.Context, config *types.Config, podNam
 		defer cancel()
 	}
 
+	// results returns everything collected so far, with the gaps filled in
+	results := func() []*types.Event {
+		pending := reasonTimeout
+		if ctx.Err() != nil {
+			pending = reasonInterrupted
+		}
+		events := append(agg.GetEvents(), agg.IncompleteResults(config, pending)...)
+		// Only the CRD transport labels events with their network
+		for _, event := range events {
+			if event.Network == "" {
+				event.Network = string(config.NetworkType)
+			}
+		}
+		return events
+	}
+
 	readyTimeout := time.After(30 * time.Second)
 	readyTicker := time.NewTicker(500 * time.Millisecond)
 	defer readyTicker.Stop()
@@ -83,18 +200,18 @@ readyLoop:
 	for {
 		select {
 		case event := <-watcher.EventChan():
-			if event.RunID == config.RunID {
+			if event.RunID == runID {
 				agg.AddEvent(event)
 				if agg.AllPodsReady() {
 					break readyLoop
 				}
 			}
 		case err := <-watcher.ErrorChan():
-			fmt.Printf("Warning: log watcher error: %v\n", err)
+			fmt.Printf("Warning: event stream error: %v\n", err)
 		case <-readyTimeout:
-			return nil, fmt.Errorf("timeout waiting for pods to be ready (%d/%d ready)", agg.GetReadyCount(), agg.GetExpectedCount())
+			return results(), fmt.Errorf("timeout waiting for pods to be ready (%d/%d ready)", agg.GetReadyCount(), agg.GetExpectedCount())
 		case <-testCtx.Done():
-			return nil, fmt.Errorf("context cancelled while waiting for pods to be ready")
+			return results(), fmt.Errorf("context cancelled while waiting for pods to be ready")
 		case <-readyTicker.C:
 			if agg.AllPodsReady() {
 				break readyLoop
@@ -108,24 +225,176 @@ readyLoop:
 	for {
 		select {
 		case event := <-watcher.EventChan():
-			if event.RunID == config.RunID {
+			if event.RunID == runID {
 				agg.AddEvent(event)
 				if agg.AllPodsComplete() {
-					return agg.GetEvents(), nil
+					return results(), nil
 				}
 			}
 		case err := <-watcher.ErrorChan():
-			fmt.Printf("Warning: log watcher error: %v\n", err)
+			fmt.Printf("Warning: event stream error: %v\n", err)
 		case <-testCtx.Done():
-			return agg.GetEvents(), fmt.Errorf("timeout waiting for tests to complete (%d/%d complete)", agg.GetCompletedCount(), agg.GetExpectedCount())
+			if ctx.Err() != nil {
+				return results(), fmt.Errorf("interrupted while waiting for tests to complete (%d/%d complete)", agg.GetCompletedCount(), agg.GetExpectedCount())
+			}
+			return results(), fmt.Errorf("timeout waiting for tests to complete (%d/%d complete)", agg.GetCompletedCount(), agg.GetExpectedCount())
 		case <-completeTicker.C:
 			if agg.AllPodsComplete() {
-				return agg.GetEvents(), nil
+				return results(), nil
 			}
 		}
 	}
 }
 
+// startRun hands the config to the agents over the selected transport and
+// returns the source their events will arrive on.
+func (c *Coordinator) startRun(ctx context.Context, config *types.Config, podNames []string) (eventSource, Transport, error) {
+	transport, err := c.selectTransport(ctx, podNames)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch transport {
+	case TransportCRD:
+		if err := c.createRun(ctx, config, podNames); err != nil {
+			return nil, "", err
+		}
+		watcher := NewResultWatcher(c.dynamicClient, c.namespace)
+		watcher.Watch(ctx, config.RunID)
+		return watcher, transport, nil
+	case TransportAPI:
+		client := NewAgentClient(c.clientset, c.namespace, c.token)
+		for _, podName := range podNames {
+			client.StartRun(ctx, podName, config)
+		}
+		return client, transport, nil
+	}
+
+	if err := c.UpdateConfig(ctx, config); err != nil {
+		return nil, "", fmt.Errorf("failed to update config: %w", err)
+	}
+
+	watcher := NewLogWatcher(c.clientset, c.namespace)
+	for _, podName := range podNames {
+		watcher.WatchPod(ctx, podName, config.RunID)
+	}
+	return watcher, transport, nil
+}
+
+// cancelRun tells the agents to abort the run over the transport it was
+// started on. It uses its own context since the run's may already be done.
+func (c *Coordinator) cancelRun(config *types.Config, transport Transport, podNames []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	switch transport {
+	case TransportCRD:
+		patch := []byte(`{"spec":{"config":{"cancelled":true}}}`)
+		_, err := c.dynamicClient.Resource(k8s.NetdebugRunGVR).Namespace(c.namespace).
+			Patch(ctx, config.RunID, apitypes.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to update NetdebugRun: %w", err)
+		}
+		return nil
+	case TransportAPI:
+		client := NewAgentClient(c.clientset, c.namespace, c.token)
+		var errs []error
+		for _, podName := range podNames {
+			if err := client.CancelRun(ctx, podName, config.RunID); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	cancelled := *config
+	cancelled.Cancelled = true
+	return c.UpdateConfig(ctx, &cancelled)
+}
+
+// selectTransport decides how this run reaches the agents. In auto mode the
+// agent API doubles as a version check: agents that answer on it also watch
+// NetdebugRuns, so the CRDs are used when installed. The ConfigMap is the
+// fallback when the token Secret is missing or any pod doesn't answer, e.g.
+// agents running an older image.
+func (c *Coordinator) selectTransport(ctx context.Context, podNames []string) (Transport, error) {
+	switch c.transport {
+	case TransportConfigMap:
+		return TransportConfigMap, nil
+	case TransportCRD:
+		if !k8s.CRDsInstalled(ctx, c.dynamicClient, c.namespace) {
+			return "", fmt.Errorf("NetdebugRun CRD is not installed (run 'netdebug deploy install')")
+		}
+		return TransportCRD, nil
+	}
+
+	if err := c.loadToken(ctx); err != nil {
+		if c.transport == TransportAPI {
+			return "", err
+		}
+		return TransportConfigMap, nil
+	}
+
+	client := NewAgentClient(c.clientset, c.namespace, c.token)
+	for _, podName := range podNames {
+		if err := client.Ping(ctx, podName); err != nil {
+			if c.transport == TransportAPI {
+				return "", err
+			}
+			fmt.Printf("Agent API unavailable (%v), falling back to ConfigMap\n", err)
+			return TransportConfigMap, nil
+		}
+	}
+
+	if c.transport == TransportAuto && k8s.CRDsInstalled(ctx, c.dynamicClient, c.namespace) {
+		return TransportCRD, nil
+	}
+
+	return TransportAPI, nil
+}
+
+// createRun stores the run as a NetdebugRun named after its run ID.
+func (c *Coordinator) createRun(ctx context.Context, config *types.Config, podNames []string) error {
+	spec, err := k8s.ToUnstructuredContent(types.NetdebugRunSpec{
+		Config: *config,
+		Pods:   podNames,
+	})
+	if err != nil {
+		return err
+	}
+
+	run := &unstructured.Unstructured{}
+	run.SetAPIVersion(k8s.CRDGroup + "/" + k8s.CRDVersion)
+	run.SetKind("NetdebugRun")
+	run.SetName(config.RunID)
+	run.Object["spec"] = spec
+
+	_, err = c.dynamicClient.Resource(k8s.NetdebugRunGVR).Namespace(c.namespace).Create(ctx, run, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create NetdebugRun: %w", err)
+	}
+	return nil
+}
+
+func (c *Coordinator) loadToken(ctx context.Context) error {
+	if c.token != "" {
+		return nil
+	}
+
+	secret, err := c.clientset.CoreV1().Secrets(c.namespace).Get(ctx, TokenSecretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get agent API token: %w", err)
+	}
+
+	token := strings.TrimSpace(string(secret.Data["token"]))
+	if token == "" {
+		return fmt.Errorf("secret %s has no token", TokenSecretName)
+	}
+
+	c.token = token
+	return nil
+}
+
 func GenerateRunID() string {
 	return uuid.New().String()
 }
@@ -0,0 +1,350 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// LockName is the Lease that serializes `netdebug run` invocations in a namespace.
+	LockName = "netdebug-run"
+
+	lockDuration      = 30 * time.Second
+	lockRenewInterval = 10 * time.Second
+	lockPollInterval  = 5 * time.Second
+
+	annotationLockUser  = "netdebug.io/user"
+	annotationLockRunID = "netdebug.io/run-id"
+)
+
+// LockHeldError is returned when another invocation holds the run lock.
+type LockHeldError struct {
+	// ID is the holding invocation's lock ID.
+	ID string
+	// RunID is the run the holder is currently running, empty until it
+	// starts one.
+	RunID string
+	User  string
+	Since time.Time
+}
+
+func (e *LockHeldError) Error() string {
+	if e.RunID == "" {
+		return fmt.Sprintf("netdebug run %s by %s starting since %s", e.ID, e.User, e.Since.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("run %s by %s in progress since %s", e.RunID, e.User, e.Since.Format(time.RFC3339))
+}
+
+type LockOptions struct {
+	// Wait polls until the lock is free instead of failing.
+	Wait bool
+	// Force takes the lock even if another invocation holds it.
+	Force bool
+}
+
+// RunLock is a held run lock, renewed in the background until released.
+type RunLock struct {
+	clientset *kubernetes.Clientset
+	namespace string
+	id        string
+	user      string
+	stop      context.CancelFunc
+	done      chan struct{}
+
+	mu    sync.Mutex
+	runID string
+
+	// lost is closed when renewing fails for good, with lostErr saying why
+	lost    chan struct{}
+	lostErr error
+}
+
+// AcquireRunLock takes the namespace's run lock so concurrent invocations
+// don't overwrite each other's runs. A lock that hasn't been renewed within
+// its lease duration, e.g. after the holder crashed, is taken over.
+func AcquireRunLock(ctx context.Context, clientset *kubernetes.Clientset, namespace string, opts LockOptions) (*RunLock, error) {
+	l := &RunLock{
+		clientset: clientset,
+		namespace: namespace,
+		id:        GenerateRunID()[:8],
+		user:      currentUser(),
+		lost:      make(chan struct{}),
+	}
+
+	waiting := false
+	for {
+		err := l.tryAcquire(ctx, opts.Force)
+		if err == nil {
+			break
+		}
+
+		var held *LockHeldError
+		if !errors.As(err, &held) || !opts.Wait {
+			return nil, err
+		}
+
+		if !waiting {
+			fmt.Printf("Waiting for lock: %v\n", err)
+			waiting = true
+		}
+
+		select {
+		case <-time.After(lockPollInterval):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("interrupted while waiting for lock: %w", err)
+		}
+	}
+
+	renewCtx, cancel := context.WithCancel(context.Background())
+	l.stop = cancel
+	l.done = make(chan struct{})
+	go l.renewLoop(renewCtx)
+
+	return l, nil
+}
+
+func (l *RunLock) tryAcquire(ctx context.Context, force bool) error {
+	leases := l.clientset.CoordinationV1().Leases(l.namespace)
+	now := metav1.NewMicroTime(time.Now())
+
+	lease, err := leases.Get(ctx, LockName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        LockName,
+				Namespace:   l.namespace,
+				Annotations: map[string]string{annotationLockUser: l.user},
+			},
+			Spec: l.leaseSpec(now),
+		}
+		_, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return l.tryAcquire(ctx, force)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create lock: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get lock: %w", err)
+	}
+
+	if held := heldBy(lease); held != nil && held.ID != l.id && !force {
+		return held
+	}
+
+	if lease.Annotations == nil {
+		lease.Annotations = make(map[string]string)
+	}
+	lease.Annotations[annotationLockUser] = l.user
+	delete(lease.Annotations, annotationLockRunID)
+	lease.Spec = l.leaseSpec(now)
+
+	if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		if apierrors.IsConflict(err) {
+			return l.tryAcquire(ctx, force)
+		}
+		return fmt.Errorf("failed to take lock: %w", err)
+	}
+	return nil
+}
+
+func (l *RunLock) leaseSpec(now metav1.MicroTime) coordinationv1.LeaseSpec {
+	holder := l.id
+	duration := int32(lockDuration.Seconds())
+	return coordinationv1.LeaseSpec{
+		HolderIdentity:       &holder,
+		LeaseDurationSeconds: &duration,
+		AcquireTime:          &now,
+		RenewTime:            &now,
+	}
+}
+
+// heldBy returns who holds the lease, or nil if it is free or expired.
+func heldBy(lease *coordinationv1.Lease) *LockHeldError {
+	spec := lease.Spec
+	if spec.HolderIdentity == nil || *spec.HolderIdentity == "" || spec.RenewTime == nil {
+		return nil
+	}
+
+	duration := lockDuration
+	if spec.LeaseDurationSeconds != nil {
+		duration = time.Duration(*spec.LeaseDurationSeconds) * time.Second
+	}
+	if time.Since(spec.RenewTime.Time) > duration {
+		return nil
+	}
+
+	held := &LockHeldError{
+		ID:    *spec.HolderIdentity,
+		RunID: lease.Annotations[annotationLockRunID],
+		User:  lease.Annotations[annotationLockUser],
+		Since: spec.RenewTime.Time,
+	}
+	if spec.AcquireTime != nil {
+		held.Since = spec.AcquireTime.Time
+	}
+	if held.User == "" {
+		held.User = "unknown"
+	}
+	return held
+}
+
+// renewLoop renews the lease until stopped. The lock counts as lost once
+// another invocation holds it, or when renewing has failed for a whole lease
+// duration and another invocation may have taken it over.
+func (l *RunLock) renewLoop(ctx context.Context) {
+	defer close(l.done)
+
+	ticker := time.NewTicker(lockRenewInterval)
+	defer ticker.Stop()
+
+	renewed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := l.renew(ctx)
+		if err == nil {
+			renewed = time.Now()
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		var held *LockHeldError
+		if errors.As(err, &held) || time.Since(renewed) >= lockDuration {
+			fmt.Printf("Error: %v, cancelling the run\n", err)
+			l.lostErr = err
+			close(l.lost)
+			return
+		}
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+func (l *RunLock) renew(ctx context.Context) error {
+	leases := l.clientset.CoordinationV1().Leases(l.namespace)
+
+	lease, err := leases.Get(ctx, LockName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to renew lock: %w", err)
+	}
+
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.id {
+		held := heldBy(lease)
+		if held == nil {
+			held = &LockHeldError{ID: "unknown", User: "unknown", Since: time.Now()}
+		}
+		return fmt.Errorf("lost lock, %w", held)
+	}
+
+	if runID := l.RunID(); runID != "" {
+		if lease.Annotations == nil {
+			lease.Annotations = make(map[string]string)
+		}
+		lease.Annotations[annotationLockRunID] = runID
+	}
+
+	now := metav1.NewMicroTime(time.Now())
+	lease.Spec.RenewTime = &now
+	if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to renew lock: %w", err)
+	}
+	return nil
+}
+
+// Context returns a copy of parent that is cancelled when the lock is lost, so
+// the run doesn't carry on next to the invocation that took over.
+func (l *RunLock) Context(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	go func() {
+		select {
+		case <-l.lost:
+			cancel(l.lostErr)
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// SetRunID records the run in progress, so lock errors of other invocations
+// name a run ID that `netdebug run --attach` accepts. It is written to the
+// Lease on the next renewal.
+func (l *RunLock) SetRunID(runID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.runID = runID
+}
+
+// RunID returns the run recorded with SetRunID.
+func (l *RunLock) RunID() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.runID
+}
+
+// Release stops renewing and frees the lock if it is still held by us.
+func (l *RunLock) Release() error {
+	l.stop()
+	<-l.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	leases := l.clientset.CoordinationV1().Leases(l.namespace)
+	lease, err := leases.Get(ctx, LockName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.id {
+		return nil
+	}
+
+	err = leases.Delete(ctx, LockName, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+	return nil
+}
+
+// ID identifies this invocation in the lock and in lock errors.
+func (l *RunLock) ID() string {
+	return l.id
+}
+
+func currentUser() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		name = u.Username
+	}
+	if name == "" {
+		name = "unknown"
+	}
+
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return name + "@" + host
+	}
+	return name
+}
@@ -0,0 +1,65 @@
+package coordinator
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHeldBy(t *testing.T) {
+	holder := "ab12cd34"
+	duration := int32(lockDuration.Seconds())
+	fresh := metav1.NewMicroTime(time.Now())
+	expired := metav1.NewMicroTime(time.Now().Add(-2 * lockDuration))
+
+	lease := func(renew metav1.MicroTime, annotations map[string]string) *coordinationv1.Lease {
+		return &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Annotations: annotations},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &holder,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &renew,
+				RenewTime:            &renew,
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		lease   *coordinationv1.Lease
+		want    bool
+		wantMsg string
+	}{
+		{
+			name:    "names the run in progress",
+			lease:   lease(fresh, map[string]string{annotationLockUser: "alice@laptop", annotationLockRunID: "run-1234"}),
+			want:    true,
+			wantMsg: "run run-1234 by alice@laptop in progress",
+		},
+		{
+			name:    "holder without a run yet",
+			lease:   lease(fresh, map[string]string{annotationLockUser: "alice@laptop"}),
+			want:    true,
+			wantMsg: "netdebug run ab12cd34 by alice@laptop starting",
+		},
+		{
+			name:  "expired",
+			lease: lease(expired, map[string]string{annotationLockRunID: "run-1234"}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			held := heldBy(tt.lease)
+			if (held != nil) != tt.want {
+				t.Fatalf("heldBy() = %v, want held %v", held, tt.want)
+			}
+			if held != nil && !strings.HasPrefix(held.Error(), tt.wantMsg) {
+				t.Errorf("Error() = %q, want prefix %q", held.Error(), tt.wantMsg)
+			}
+		})
+	}
+}
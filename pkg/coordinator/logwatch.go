@@ -5,14 +5,21 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/ryanelliottsmith/network-debugger/pkg/types"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
+// logReconnectDelay is how long the watcher waits before reopening a log
+// stream that ended while the pod was still running.
+const logReconnectDelay = 2 * time.Second
+
 type LogWatcher struct {
 	clientset *kubernetes.Clientset
 	namespace string
@@ -38,33 +45,85 @@ func (lw *LogWatcher) ErrorChan() <-chan error {
 	return lw.errorChan
 }
 
-func (lw *LogWatcher) WatchPod(ctx context.Context, podName string) {
+// WatchPod follows the pod's logs for events of the given run. The stream is
+// reopened if it drops, and a crashed event is sent if the agent container
+// restarts or the pod goes away before the run ends.
+func (lw *LogWatcher) WatchPod(ctx context.Context, podName, runID string) {
 	lw.wg.Add(1)
-	go lw.watchPodLogs(ctx, podName)
+	go lw.watchPodLogs(ctx, podName, runID)
 }
 
-func (lw *LogWatcher) watchPodLogs(ctx context.Context, podName string) {
+func (lw *LogWatcher) watchPodLogs(ctx context.Context, podName, runID string) {
 	defer lw.wg.Done()
 
+	pod, err := lw.clientset.CoreV1().Pods(lw.namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		lw.sendError(ctx, fmt.Errorf("failed to get pod %s: %w", podName, err))
+		return
+	}
+	nodeName := pod.Spec.NodeName
+	restarts := restartCount(pod)
+
+	cursor := &logCursor{}
+	for {
+		done, err := lw.streamPodLogs(ctx, podName, runID, cursor)
+		if ctx.Err() != nil || done {
+			return
+		}
+		if err != nil {
+			lw.sendError(ctx, fmt.Errorf("log stream from pod %s dropped, reconnecting: %w", podName, err))
+		}
+
+		// Waiting first gives the kubelet time to record a container restart
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(logReconnectDelay):
+		}
+
+		pod, err = lw.clientset.CoreV1().Pods(lw.namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				lw.sendCrashed(ctx, podName, nodeName, runID, "pod deleted")
+				return
+			}
+			lw.sendError(ctx, fmt.Errorf("failed to get pod %s: %w", podName, err))
+		} else if reason := crashReason(pod, restarts); reason != "" {
+			lw.sendCrashed(ctx, podName, nodeName, runID, reason)
+			return
+		}
+	}
+}
+
+// streamPodLogs follows the pod's logs from where the cursor left off and
+// forwards the events in them. It returns true once the pod has reported the
+// end of the run, since nothing more is expected from it.
+func (lw *LogWatcher) streamPodLogs(ctx context.Context, podName, runID string, cursor *logCursor) (bool, error) {
 	podLogOpts := &corev1.PodLogOptions{
 		Follow:     true,
-		Timestamps: false,
+		Timestamps: true,
+	}
+	if !cursor.last.IsZero() {
+		// SinceTime only has second precision, so lines already seen are
+		// replayed and dropped by the cursor.
+		since := metav1.NewTime(cursor.last)
+		podLogOpts.SinceTime = &since
 	}
 
 	req := lw.clientset.CoreV1().Pods(lw.namespace).GetLogs(podName, podLogOpts)
 	stream, err := req.Stream(ctx)
 	if err != nil {
-		select {
-		case lw.errorChan <- fmt.Errorf("failed to stream logs from pod %s: %w", podName, err):
-		case <-ctx.Done():
-		}
-		return
+		return false, err
 	}
 	defer stream.Close()
 
 	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
 	for scanner.Scan() {
-		line := scanner.Text()
+		line, ok := cursor.advance(scanner.Text())
+		if !ok {
+			continue
+		}
 
 		var event types.Event
 		if err := json.Unmarshal([]byte(line), &event); err != nil {
@@ -74,16 +133,30 @@ func (lw *LogWatcher) watchPodLogs(ctx context.Context, podName string) {
 		select {
 		case lw.eventChan <- &event:
 		case <-ctx.Done():
-			return
+			return false, nil
 		}
-	}
 
-	if err := scanner.Err(); err != nil && err != io.EOF {
-		select {
-		case lw.errorChan <- fmt.Errorf("error reading logs from pod %s: %w", podName, err):
-		case <-ctx.Done():
+		if event.RunID == runID && (event.Type == types.EventTypeComplete || event.Type == types.EventTypeCancelled) {
+			return true, nil
 		}
 	}
+
+	return false, scanner.Err()
+}
+
+func (lw *LogWatcher) sendError(ctx context.Context, err error) {
+	select {
+	case lw.errorChan <- err:
+	case <-ctx.Done():
+	}
+}
+
+func (lw *LogWatcher) sendCrashed(ctx context.Context, podName, nodeName, runID, reason string) {
+	event := types.CrashedEvent(nodeName, "", podName, reason, runID)
+	select {
+	case lw.eventChan <- event:
+	case <-ctx.Done():
+	}
 }
 
 func (lw *LogWatcher) Close() {
@@ -91,3 +164,74 @@ func (lw *LogWatcher) Close() {
 	close(lw.eventChan)
 	close(lw.errorChan)
 }
+
+// logCursor tracks the kubelet timestamp of the last log line read so a
+// reopened stream can skip lines that were already delivered.
+type logCursor struct {
+	last time.Time
+	// seen holds the lines read at exactly last, in case several share it.
+	seen map[string]bool
+}
+
+// advance strips the kubelet timestamp from a log line and reports whether
+// the line is new.
+func (c *logCursor) advance(raw string) (string, bool) {
+	stamp, line, ok := strings.Cut(raw, " ")
+	if !ok {
+		return raw, true
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, stamp)
+	if err != nil {
+		return raw, true
+	}
+
+	switch {
+	case ts.Before(c.last):
+		return "", false
+	case ts.Equal(c.last):
+		if c.seen[line] {
+			return "", false
+		}
+	default:
+		c.last = ts
+		c.seen = make(map[string]bool)
+	}
+
+	c.seen[line] = true
+	return line, true
+}
+
+func restartCount(pod *corev1.Pod) int32 {
+	var count int32
+	for _, status := range pod.Status.ContainerStatuses {
+		count += status.RestartCount
+	}
+	return count
+}
+
+// crashReason describes why the pod can no longer deliver the run's events,
+// or returns "" if it is still running the container the watch started with.
+func crashReason(pod *corev1.Pod, restarts int32) string {
+	if pod.DeletionTimestamp != nil {
+		return "pod is terminating"
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodFailed, corev1.PodSucceeded:
+		return fmt.Sprintf("pod %s", strings.ToLower(string(pod.Status.Phase)))
+	}
+
+	if current := restartCount(pod); current > restarts {
+		reason := fmt.Sprintf("agent container restarted (%d restarts)", current)
+		for _, status := range pod.Status.ContainerStatuses {
+			if term := status.LastTerminationState.Terminated; term != nil {
+				reason += fmt.Sprintf(": %s, exit code %d", term.Reason, term.ExitCode)
+				break
+			}
+		}
+		return reason
+	}
+
+	return ""
+}
@@ -0,0 +1,72 @@
+package coordinator
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestLogCursorSkipsReplayedLines(t *testing.T) {
+	cursor := &logCursor{}
+
+	first := []string{
+		`2025-01-01T10:00:00.100000000Z {"type":"ready"}`,
+		`2025-01-01T10:00:00.200000000Z {"type":"test_start"}`,
+		`2025-01-01T10:00:00.200000000Z {"type":"test_result"}`,
+	}
+	for _, raw := range first {
+		if _, ok := cursor.advance(raw); !ok {
+			t.Fatalf("advance(%q) dropped a new line", raw)
+		}
+	}
+
+	// A reconnect with SinceTime=10:00:00 replays everything from that second
+	replayed := append(first, `2025-01-01T10:00:00.300000000Z {"type":"complete"}`)
+	var delivered []string
+	for _, raw := range replayed {
+		if line, ok := cursor.advance(raw); ok {
+			delivered = append(delivered, line)
+		}
+	}
+
+	if len(delivered) != 1 || delivered[0] != `{"type":"complete"}` {
+		t.Errorf("replay delivered %v, want only the complete event", delivered)
+	}
+}
+
+func TestLogCursorPassesUntimestampedLines(t *testing.T) {
+	cursor := &logCursor{}
+	line, ok := cursor.advance(`{"type":"ready"}`)
+	if !ok || line != `{"type":"ready"}` {
+		t.Errorf("advance() = %q, %v; want the line unchanged", line, ok)
+	}
+}
+
+func TestCrashReason(t *testing.T) {
+	running := &corev1.Pod{
+		Status: corev1.PodStatus{
+			Phase:             corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{RestartCount: 1}},
+		},
+	}
+	if reason := crashReason(running, 1); reason != "" {
+		t.Errorf("crashReason for a running pod = %q, want none", reason)
+	}
+
+	restarted := running.DeepCopy()
+	restarted.Status.ContainerStatuses[0].RestartCount = 2
+	restarted.Status.ContainerStatuses[0].LastTerminationState.Terminated = &corev1.ContainerStateTerminated{
+		Reason:   "OOMKilled",
+		ExitCode: 137,
+	}
+	if reason := crashReason(restarted, 1); !strings.Contains(reason, "OOMKilled") {
+		t.Errorf("crashReason for a restarted pod = %q, want it to mention OOMKilled", reason)
+	}
+
+	failed := running.DeepCopy()
+	failed.Status.Phase = corev1.PodFailed
+	if reason := crashReason(failed, 1); reason == "" {
+		t.Error("crashReason for a failed pod is empty")
+	}
+}
@@ -0,0 +1,183 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/k8s"
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+// ResultWatcher turns the NetdebugResults of a run back into events. Results
+// already written when it starts are replayed, which is what lets a CLI
+// reattach to a run it lost track of.
+type ResultWatcher struct {
+	dynamicClient dynamic.Interface
+	namespace     string
+	eventChan     chan *types.Event
+	errorChan     chan error
+	wg            sync.WaitGroup
+
+	// seen tracks what has already been forwarded for each result object.
+	seen map[string]*resultProgress
+}
+
+type resultProgress struct {
+	ready    bool
+	complete bool
+	results  int
+	errors   int
+}
+
+func NewResultWatcher(dynamicClient dynamic.Interface, namespace string) *ResultWatcher {
+	return &ResultWatcher{
+		dynamicClient: dynamicClient,
+		namespace:     namespace,
+		eventChan:     make(chan *types.Event, 100),
+		errorChan:     make(chan error, 10),
+		seen:          make(map[string]*resultProgress),
+	}
+}
+
+func (rw *ResultWatcher) EventChan() <-chan *types.Event {
+	return rw.eventChan
+}
+
+func (rw *ResultWatcher) ErrorChan() <-chan error {
+	return rw.errorChan
+}
+
+func (rw *ResultWatcher) Watch(ctx context.Context, runID string) {
+	rw.wg.Add(1)
+	go rw.watchResults(ctx, runID)
+}
+
+func (rw *ResultWatcher) watchResults(ctx context.Context, runID string) {
+	defer rw.wg.Done()
+
+	client := rw.dynamicClient.Resource(k8s.NetdebugResultGVR).Namespace(rw.namespace)
+	opts := metav1.ListOptions{LabelSelector: k8s.LabelRunID + "=" + runID}
+
+	for ctx.Err() == nil {
+		list, err := client.List(ctx, opts)
+		if err != nil {
+			rw.sendError(ctx, fmt.Errorf("failed to list results for run %s: %w", runID, err))
+			sleepCtx(ctx, 2*time.Second)
+			continue
+		}
+
+		for i := range list.Items {
+			if !rw.forward(ctx, runID, &list.Items[i]) {
+				return
+			}
+		}
+
+		watchOpts := opts
+		watchOpts.ResourceVersion = list.GetResourceVersion()
+		watcher, err := client.Watch(ctx, watchOpts)
+		if err != nil {
+			rw.sendError(ctx, fmt.Errorf("failed to watch results for run %s: %w", runID, err))
+			sleepCtx(ctx, 2*time.Second)
+			continue
+		}
+
+		for event := range watcher.ResultChan() {
+			if event.Type != watch.Added && event.Type != watch.Modified {
+				continue
+			}
+			obj, ok := event.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			if !rw.forward(ctx, runID, obj) {
+				watcher.Stop()
+				return
+			}
+		}
+	}
+}
+
+// forward emits the events for whatever is new in obj since it was last seen.
+// It returns false once the context is cancelled.
+func (rw *ResultWatcher) forward(ctx context.Context, runID string, obj *unstructured.Unstructured) bool {
+	var spec types.NetdebugResultSpec
+	var status types.NetdebugResultStatus
+	if err := k8s.FromUnstructuredField(obj, "spec", &spec); err != nil {
+		rw.sendError(ctx, err)
+		return ctx.Err() == nil
+	}
+	if err := k8s.FromUnstructuredField(obj, "status", &status); err != nil {
+		rw.sendError(ctx, err)
+		return ctx.Err() == nil
+	}
+
+	progress, ok := rw.seen[obj.GetName()]
+	if !ok {
+		progress = &resultProgress{}
+		rw.seen[obj.GetName()] = progress
+	}
+
+	var events []*types.Event
+
+	if !progress.ready && status.IsConditionTrue(types.ConditionReady) {
+		progress.ready = true
+		events = append(events, types.ReadyEvent(spec.Node, spec.Network, spec.Pod, runID))
+	}
+
+	for _, result := range status.Results[min(progress.results, len(status.Results)):] {
+		event := types.TestResultEvent(spec.Node, result.Network, spec.Pod, result.Check, result.Target, string(result.Status), result.Details, runID)
+		event.Error = result.Error
+		event.Timestamp = result.EndTime
+		events = append(events, event)
+	}
+	progress.results = max(progress.results, len(status.Results))
+
+	for _, errMsg := range status.Errors[min(progress.errors, len(status.Errors)):] {
+		events = append(events, types.ErrorEvent(spec.Node, spec.Network, spec.Pod, errMsg, runID))
+	}
+	progress.errors = max(progress.errors, len(status.Errors))
+
+	if !progress.complete && status.IsConditionTrue(types.ConditionComplete) {
+		progress.complete = true
+		if status.GetCondition(types.ConditionComplete).Reason == types.ReasonCancelled {
+			events = append(events, types.CancelledEvent(spec.Node, spec.Network, spec.Pod, runID))
+		} else {
+			events = append(events, types.CompleteEvent(spec.Node, spec.Network, spec.Pod, status.Summary, runID))
+		}
+	}
+
+	for _, event := range events {
+		select {
+		case rw.eventChan <- event:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+func (rw *ResultWatcher) sendError(ctx context.Context, err error) {
+	select {
+	case rw.errorChan <- err:
+	case <-ctx.Done():
+	}
+}
+
+func (rw *ResultWatcher) Close() {
+	rw.wg.Wait()
+	close(rw.eventChan)
+	close(rw.errorChan)
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,81 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// CNINamespaces are searched in order for the DaemonSet of a known CNI.
+var CNINamespaces = []string{"kube-system", "calico-system", "kube-flannel"}
+
+// FlannelBackendAnnotation is set on every node by flannel, including the one
+// K3s runs inside its own process, to the flannel backend type.
+const FlannelBackendAnnotation = "flannel.alpha.coreos.com/backend-type"
+
+// DetectCNI returns the port profile of the CNI whose DaemonSet runs in the
+// cluster, or "" if none was recognised. Flannel's backend, and flannel run
+// by K3s, which has no DaemonSet to find, are told from its node annotation.
+func DetectCNI(ctx context.Context, clientset *kubernetes.Clientset) (string, error) {
+	cni, dsErr := detectCNIDaemonSet(ctx, clientset)
+	if cni != "" && cni != "flannel" {
+		return cni, nil
+	}
+
+	backend, err := flannelBackend(ctx, clientset)
+	if err == nil && backend != "" {
+		return types.FlannelProfile(backend), nil
+	}
+	if cni != "" {
+		return cni, nil
+	}
+	return "", errors.Join(dsErr, err)
+}
+
+// flannelBackend returns the flannel backend type the nodes are annotated
+// with, or "" if flannel doesn't run.
+func flannelBackend(ctx context.Context, clientset *kubernetes.Clientset) (string, error) {
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list nodes: %w", err)
+	}
+	for _, node := range nodes.Items {
+		if backend := node.Annotations[FlannelBackendAnnotation]; backend != "" {
+			return backend, nil
+		}
+	}
+	return "", nil
+}
+
+// detectCNIDaemonSet returns the port profile of the first known CNI
+// DaemonSet in CNINamespaces. Namespaces that can't be listed, e.g. for lack
+// of permission, are skipped, and only fail detection if no CNI is found.
+func detectCNIDaemonSet(ctx context.Context, clientset *kubernetes.Clientset) (string, error) {
+	var listErrs []error
+	for _, namespace := range CNINamespaces {
+		daemonSets, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			listErrs = append(listErrs, fmt.Errorf("failed to list DaemonSets in %s: %w", namespace, err))
+			continue
+		}
+
+		names := make([]string, 0, len(daemonSets.Items))
+		for _, ds := range daemonSets.Items {
+			names = append(names, ds.Name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if cni := types.CNIFromName(name); cni != "" {
+				return cni, nil
+			}
+		}
+	}
+
+	return "", errors.Join(listErrs...)
+}
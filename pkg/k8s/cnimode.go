@@ -0,0 +1,188 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	// calicoIPPoolGVR is Calico's IP pools, which set each pool's
+	// encapsulation.
+	calicoIPPoolGVR = schema.GroupVersionResource{
+		Group:    "crd.projectcalico.org",
+		Version:  "v1",
+		Resource: "ippools",
+	}
+	// calicoInstallationGVR is the Tigera operator's Installation, which
+	// enables BGP for operator installs.
+	calicoInstallationGVR = schema.GroupVersionResource{
+		Group:    "operator.tigera.io",
+		Version:  "v1",
+		Resource: "installations",
+	}
+)
+
+// CalicoTyphaService is the Service in front of Calico's Typha replicas.
+const CalicoTyphaService = "calico-typha"
+
+// DetectCNIMode reads how the detected CNI is set up, to tell which ports of
+// its profile must be open. It returns nil for CNIs without mode-dependent
+// ports, and an error when the mode can't be read, in which case those ports
+// stay optional.
+func DetectCNIMode(ctx context.Context, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface, cni string) (*types.CNIMode, error) {
+	switch cni {
+	case "calico":
+		return detectCalicoMode(ctx, clientset, dynamicClient)
+	case "cilium":
+		return detectCiliumMode(ctx, clientset)
+	}
+	return nil, nil
+}
+
+// detectCalicoMode reads VXLAN from the enabled IP pools, BGP from the
+// calico-config backend or the operator's Installation, and Typha from its
+// Service's endpoints.
+func detectCalicoMode(ctx context.Context, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) (*types.CNIMode, error) {
+	pools, err := dynamicClient.Resource(calicoIPPoolGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Calico IP pools: %w", err)
+	}
+
+	mode := &types.CNIMode{}
+	routedPool := false
+	for _, pool := range pools.Items {
+		if disabled, _, _ := unstructured.NestedBool(pool.Object, "spec", "disabled"); disabled {
+			continue
+		}
+		vxlanMode, _, _ := unstructured.NestedString(pool.Object, "spec", "vxlanMode")
+		if encapsulated(vxlanMode) {
+			mode.VXLAN = true
+		} else {
+			// IP-in-IP and unencapsulated pools are routed by BGP
+			routedPool = true
+		}
+	}
+
+	bgp, known, err := calicoBGP(ctx, clientset, dynamicClient)
+	if err != nil {
+		return nil, err
+	}
+	if known {
+		mode.BGP = bgp
+	} else {
+		mode.BGP = routedPool
+	}
+
+	mode.TyphaNodes, err = calicoTyphaNodes(ctx, clientset)
+	if err != nil {
+		return nil, err
+	}
+	return mode, nil
+}
+
+// encapsulated reports whether a Calico pool's ipipMode or vxlanMode turns the
+// encapsulation on.
+func encapsulated(mode string) bool {
+	return mode != "" && mode != "Never"
+}
+
+// calicoBGP reports whether Calico runs BIRD, from calico-config's
+// calico_backend for manifest installs or the Installation's bgp for operator
+// installs. known is false when neither exists.
+func calicoBGP(ctx context.Context, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) (bgp, known bool, err error) {
+	cm, err := clientset.CoreV1().ConfigMaps("kube-system").Get(ctx, "calico-config", metav1.GetOptions{})
+	switch {
+	case err == nil:
+		if backend, ok := cm.Data["calico_backend"]; ok {
+			return backend == "bird", true, nil
+		}
+	case !apierrors.IsNotFound(err):
+		return false, false, fmt.Errorf("failed to get calico-config: %w", err)
+	}
+
+	installation, err := dynamicClient.Resource(calicoInstallationGVR).Get(ctx, "default", metav1.GetOptions{})
+	switch {
+	case err == nil:
+		setting, _, _ := unstructured.NestedString(installation.Object, "spec", "calicoNetwork", "bgp")
+		// The operator enables BGP unless told otherwise
+		return setting != "Disabled", true, nil
+	case apierrors.IsNotFound(err):
+		return false, false, nil
+	default:
+		return false, false, fmt.Errorf("failed to get Calico Installation: %w", err)
+	}
+}
+
+// calicoTyphaNodes returns the nodes the calico-typha Service's endpoints run
+// on, in kube-system for manifest installs and calico-system for operator
+// installs.
+func calicoTyphaNodes(ctx context.Context, clientset *kubernetes.Clientset) ([]string, error) {
+	var nodes []string
+	for _, namespace := range []string{"kube-system", "calico-system"} {
+		endpointSlices, err := clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: discoveryv1.LabelServiceName + "=" + CalicoTyphaService,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list EndpointSlices for %s in %s: %w", CalicoTyphaService, namespace, err)
+		}
+		for _, slice := range endpointSlices.Items {
+			for _, endpoint := range slice.Endpoints {
+				if endpoint.NodeName != nil && !slices.Contains(nodes, *endpoint.NodeName) {
+					nodes = append(nodes, *endpoint.NodeName)
+				}
+			}
+		}
+	}
+	slices.Sort(nodes)
+	return nodes, nil
+}
+
+// CiliumNamespaces are searched in order for cilium-config.
+var CiliumNamespaces = []string{"kube-system", "cilium"}
+
+// detectCiliumMode reads the tunnel protocol, or native routing, and
+// WireGuard from cilium-config.
+func detectCiliumMode(ctx context.Context, clientset *kubernetes.Clientset) (*types.CNIMode, error) {
+	for _, namespace := range CiliumNamespaces {
+		cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, "cilium-config", metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cilium-config in %s: %w", namespace, err)
+		}
+		return ciliumMode(cm.Data), nil
+	}
+	return nil, fmt.Errorf("cilium-config not found in %v", CiliumNamespaces)
+}
+
+// ciliumMode reads a cilium-config. Cilium tunnels over VXLAN unless
+// routing-mode is native, or the older tunnel key is disabled.
+func ciliumMode(config map[string]string) *types.CNIMode {
+	protocol := config["tunnel-protocol"]
+	if tunnel := config["tunnel"]; tunnel != "" {
+		protocol = tunnel
+	}
+	if config["routing-mode"] == "native" {
+		protocol = "disabled"
+	}
+	if protocol == "" {
+		protocol = "vxlan"
+	}
+
+	return &types.CNIMode{
+		VXLAN:     protocol == "vxlan",
+		Geneve:    protocol == "geneve",
+		WireGuard: config["enable-wireguard"] == "true",
+	}
+}
@@ -0,0 +1,91 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ryanelliottsmith/network-debugger/internal/manifests"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	CRDGroup   = "netdebug.io"
+	CRDVersion = "v1alpha1"
+
+	// LabelRunID is set on NetdebugResults to the run they belong to.
+	LabelRunID = "netdebug.io/run-id"
+	// LabelNode is set on NetdebugResults to the node that produced them.
+	LabelNode = "netdebug.io/node"
+)
+
+var (
+	NetdebugRunGVR = schema.GroupVersionResource{
+		Group:    CRDGroup,
+		Version:  CRDVersion,
+		Resource: "netdebugruns",
+	}
+	NetdebugResultGVR = schema.GroupVersionResource{
+		Group:    CRDGroup,
+		Version:  CRDVersion,
+		Resource: "netdebugresults",
+	}
+)
+
+// GetCRDManifests returns the NetdebugRun and NetdebugResult CRDs. They are
+// kept apart from GetAllManifests so uninstalling the agents keeps run history.
+func GetCRDManifests() string {
+	return manifests.CRDsYAML
+}
+
+// UninstallCRDs removes the CRDs, deleting every stored run and result with them.
+func UninstallCRDs(ctx context.Context, dynamicClient dynamic.Interface) error {
+	return deleteYAML(ctx, dynamicClient, GetCRDManifests())
+}
+
+// CRDsInstalled reports whether NetdebugRuns can be created in the namespace.
+func CRDsInstalled(ctx context.Context, dynamicClient dynamic.Interface, namespace string) bool {
+	_, err := dynamicClient.Resource(NetdebugRunGVR).Namespace(namespace).List(ctx, metav1.ListOptions{Limit: 1})
+	return err == nil
+}
+
+// ResultName is the name of the NetdebugResult a pod writes for a run.
+func ResultName(runID, podName string) string {
+	return runID + "-" + podName
+}
+
+// ToUnstructuredContent converts a typed spec or status into the JSON map form
+// stored in unstructured objects.
+func ToUnstructuredContent(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal: %w", err)
+	}
+
+	var content map[string]interface{}
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	return content, nil
+}
+
+// FromUnstructuredField decodes obj[field] into v. A missing field leaves v untouched.
+func FromUnstructuredField(obj *unstructured.Unstructured, field string, v interface{}) error {
+	content, ok := obj.Object[field]
+	if !ok {
+		return nil
+	}
+
+	data, err := json.Marshal(content)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", field, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", field, err)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package k8s
 
 import (
 	"context"
+	"crypto/rand"
 	"fmt"
 	"strings"
 
@@ -20,10 +21,15 @@ const (
 	DefaultImage     = DefaultImageRepo + ":" + DefaultImageTag
 )
 
-func Install(ctx context.Context, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface, namespace, imageOverride string) error {
-	return applyYAML(ctx, dynamicClient, GetAllManifests(namespace, imageOverride))
+func Install(ctx context.Context, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface, namespace, imageOverride string, agentArgs ...string) error {
+	if err := applyYAML(ctx, dynamicClient, GetCRDManifests()); err != nil {
+		return err
+	}
+	return applyYAML(ctx, dynamicClient, GetAllManifests(namespace, imageOverride, agentArgs...))
 }
 
+// Uninstall removes the agents. The CRDs and the runs stored in them are left
+// in place; see UninstallCRDs.
 func Uninstall(ctx context.Context, dynamicClient dynamic.Interface, namespace string) error {
 	return deleteYAML(ctx, dynamicClient, GetAllManifests(namespace, ""))
 }
@@ -48,19 +54,18 @@ func applyYAML(ctx context.Context, dynamicClient dynamic.Interface, yamlContent
 			Resource: getResourceName(obj.GetKind()),
 		}
 
-		namespace := obj.GetNamespace()
-		var err error
+		var resource dynamic.ResourceInterface = dynamicClient.Resource(gvr)
+		if namespace := obj.GetNamespace(); namespace != "" {
+			resource = dynamicClient.Resource(gvr).Namespace(namespace)
+		}
 
-		if namespace != "" {
-			_, err = dynamicClient.Resource(gvr).Namespace(namespace).Create(ctx, obj, metav1.CreateOptions{})
-			if err != nil && strings.Contains(err.Error(), "already exists") {
-				_, err = dynamicClient.Resource(gvr).Namespace(namespace).Update(ctx, obj, metav1.UpdateOptions{})
-			}
-		} else {
-			_, err = dynamicClient.Resource(gvr).Create(ctx, obj, metav1.CreateOptions{})
-			if err != nil && strings.Contains(err.Error(), "already exists") {
-				_, err = dynamicClient.Resource(gvr).Update(ctx, obj, metav1.UpdateOptions{})
+		_, err := resource.Create(ctx, obj, metav1.CreateOptions{})
+		if err != nil && strings.Contains(err.Error(), "already exists") {
+			// Keep existing Secrets so running agents and the coordinator agree on the token
+			if obj.GetKind() == "Secret" {
+				continue
 			}
+			err = updateExisting(ctx, resource, obj)
 		}
 
 		if err != nil {
@@ -71,6 +76,19 @@ func applyYAML(ctx context.Context, dynamicClient dynamic.Interface, yamlContent
 	return nil
 }
 
+// updateExisting replaces an object that already exists. Updates must name
+// the resourceVersion they replace, which CRDs enforce, so it is copied from
+// the live object.
+func updateExisting(ctx context.Context, resource dynamic.ResourceInterface, obj *unstructured.Unstructured) error {
+	existing, err := resource.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	_, err = resource.Update(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
+
 func deleteYAML(ctx context.Context, dynamicClient dynamic.Interface, yamlContent string) error {
 	docs := strings.Split(yamlContent, "---")
 
@@ -110,7 +128,8 @@ func deleteYAML(ctx context.Context, dynamicClient dynamic.Interface, yamlConten
 
 // GetAllManifests returns all manifests as a single YAML string with namespace and image substitutions applied.
 // This is useful for templating manifests to stdout so users can modify them before applying.
-func GetAllManifests(namespace, imageOverride string) string {
+// Any agentArgs are appended to the agent command line in both DaemonSets.
+func GetAllManifests(namespace, imageOverride string, agentArgs ...string) string {
 	replaceNamespace := func(yaml string) string {
 		yaml = strings.ReplaceAll(yaml, "namespace: default", "namespace: "+namespace)
 		yaml = strings.ReplaceAll(yaml, "NAMESPACE_PLACEHOLDER", namespace)
@@ -119,8 +138,10 @@ func GetAllManifests(namespace, imageOverride string) string {
 
 	rbacYAML := replaceNamespace(manifests.RBACYAML)
 	configMapYAML := replaceNamespace(manifests.ConfigMapYAML)
+	secretYAML := strings.ReplaceAll(replaceNamespace(manifests.SecretYAML), "TOKEN_PLACEHOLDER", rand.Text())
 	hostDS := replaceNamespace(manifests.DaemonSetHostYAML)
 	overlayDS := replaceNamespace(manifests.DaemonSetOverlayYAML)
+	serviceYAML := replaceNamespace(manifests.ServiceYAML)
 
 	image := imageOverride
 	if image == "" {
@@ -129,11 +150,23 @@ func GetAllManifests(namespace, imageOverride string) string {
 	hostDS = strings.ReplaceAll(hostDS, "IMAGE_PLACEHOLDER", image)
 	overlayDS = strings.ReplaceAll(overlayDS, "IMAGE_PLACEHOLDER", image)
 
+	if len(agentArgs) > 0 {
+		configArg := "        - --config=" + namespace + "/netdebug-config\n"
+		extra := ""
+		for _, arg := range agentArgs {
+			extra += "        - " + arg + "\n"
+		}
+		hostDS = strings.Replace(hostDS, configArg, configArg+extra, 1)
+		overlayDS = strings.Replace(overlayDS, configArg, configArg+extra, 1)
+	}
+
 	return strings.Join([]string{
 		rbacYAML,
 		configMapYAML,
+		secretYAML,
 		hostDS,
 		overlayDS,
+		serviceYAML,
 	}, "---\n")
 }
 
@@ -150,6 +183,8 @@ func getResourceName(kind string) string {
 		return "configmaps"
 	case "daemonset":
 		return "daemonsets"
+	case "customresourcedefinition":
+		return "customresourcedefinitions"
 	default:
 		return kind + "s"
 	}
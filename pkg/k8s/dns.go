@@ -0,0 +1,125 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DNSNamespace and DNSServiceName locate the cluster DNS Service. RKE2 and
+	// K3s keep the kube-dns name for CoreDNS.
+	DNSNamespace   = "kube-system"
+	DNSServiceName = "kube-dns"
+)
+
+// KubernetesServiceDNSName is the DNS name of the API server's Service, which
+// resolves to the first IP of the service CIDR.
+const KubernetesServiceDNSName = "kubernetes.default.svc.cluster.local"
+
+// GetKubernetesServiceIP returns the ClusterIP of the kubernetes Service in the
+// default namespace.
+func GetKubernetesServiceIP(ctx context.Context, clientset *kubernetes.Clientset) (string, error) {
+	svc, err := clientset.CoreV1().Services("default").Get(ctx, "kubernetes", metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get Service default/kubernetes: %w", err)
+	}
+	if svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == "None" {
+		return "", fmt.Errorf("service default/kubernetes has no ClusterIP")
+	}
+	return svc.Spec.ClusterIP, nil
+}
+
+// GetDNSServiceAddress returns the host:port of the kube-dns Service VIP.
+func GetDNSServiceAddress(ctx context.Context, clientset *kubernetes.Clientset) (string, error) {
+	svc, err := clientset.CoreV1().Services(DNSNamespace).Get(ctx, DNSServiceName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get Service %s/%s: %w", DNSNamespace, DNSServiceName, err)
+	}
+	if svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == "None" {
+		return "", fmt.Errorf("service %s/%s has no ClusterIP", DNSNamespace, DNSServiceName)
+	}
+	return net.JoinHostPort(svc.Spec.ClusterIP, "53"), nil
+}
+
+// GetDNSServers returns the kube-dns Service VIP followed by every ready
+// CoreDNS endpoint behind it, read from the Service's EndpointSlices.
+func GetDNSServers(ctx context.Context, clientset *kubernetes.Clientset) ([]types.DNSServer, error) {
+	svc, err := clientset.CoreV1().Services(DNSNamespace).Get(ctx, DNSServiceName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Service %s/%s: %w", DNSNamespace, DNSServiceName, err)
+	}
+
+	var servers []types.DNSServer
+	if svc.Spec.ClusterIP != "" && svc.Spec.ClusterIP != "None" {
+		servers = append(servers, types.DNSServer{
+			Name:    DNSServiceName,
+			Address: net.JoinHostPort(svc.Spec.ClusterIP, "53"),
+		})
+	}
+
+	endpointSlices, err := clientset.DiscoveryV1().EndpointSlices(DNSNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + DNSServiceName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list EndpointSlices for %s: %w", DNSServiceName, err)
+	}
+
+	var replicas []types.DNSServer
+	seen := make(map[string]bool)
+	for _, slice := range endpointSlices.Items {
+		if slice.AddressType != discoveryv1.AddressTypeIPv4 && slice.AddressType != discoveryv1.AddressTypeIPv6 {
+			continue
+		}
+		port := dnsPort(slice.Ports)
+
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			for _, ip := range endpoint.Addresses {
+				address := net.JoinHostPort(ip, strconv.Itoa(port))
+				if seen[address] {
+					continue
+				}
+				seen[address] = true
+
+				server := types.DNSServer{
+					Name:    ip,
+					Address: address,
+				}
+				if endpoint.TargetRef != nil {
+					server.Name = endpoint.TargetRef.Name
+				}
+				if endpoint.NodeName != nil {
+					server.NodeName = *endpoint.NodeName
+				}
+				replicas = append(replicas, server)
+			}
+		}
+	}
+
+	sort.Slice(replicas, func(i, j int) bool {
+		return replicas[i].Name < replicas[j].Name
+	})
+
+	return append(servers, replicas...), nil
+}
+
+// dnsPort returns the UDP DNS port of an EndpointSlice, which is the target
+// port of the Service and 53 for CoreDNS.
+func dnsPort(ports []discoveryv1.EndpointPort) int {
+	for _, port := range ports {
+		if port.Port != nil && (port.Protocol == nil || *port.Protocol == "UDP") {
+			return int(*port.Port)
+		}
+	}
+	return 53
+}
@@ -0,0 +1,65 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// HeadlessServiceName is the temporary headless Service in front of the
+// overlay agents whose records the dnsrecords check resolves.
+const HeadlessServiceName = "netdebug-headless"
+
+// CreateHeadlessService creates a headless Service selecting the overlay
+// agents, reusing one left behind by an earlier run, and returns the records
+// to verify for the given pods.
+func CreateHeadlessService(ctx context.Context, clientset *kubernetes.Clientset, namespace string, pods []types.TargetNode) (*types.DNSRecordsTest, error) {
+	labels := map[string]string{"app": "netdebug", "network-mode": "overlay"}
+	port := corev1.ServicePort{
+		Name:       "http",
+		Port:       types.AgentPort,
+		TargetPort: intstr.FromString("http"),
+		Protocol:   corev1.ProtocolTCP,
+	}
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      HeadlessServiceName,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  labels,
+			Ports:     []corev1.ServicePort{port},
+		},
+	}
+
+	_, err := clientset.CoreV1().Services(namespace).Create(ctx, svc, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return nil, fmt.Errorf("failed to create Service %s: %w", HeadlessServiceName, err)
+	}
+
+	return &types.DNSRecordsTest{
+		Service:   fmt.Sprintf("%s.%s.svc.cluster.local", HeadlessServiceName, namespace),
+		Namespace: namespace,
+		PortName:  port.Name,
+		Port:      int(port.Port),
+		Pods:      pods,
+	}, nil
+}
+
+// DeleteHeadlessService removes the Service made by CreateHeadlessService.
+func DeleteHeadlessService(ctx context.Context, clientset *kubernetes.Clientset, namespace string) error {
+	err := clientset.CoreV1().Services(namespace).Delete(ctx, HeadlessServiceName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete Service %s: %w", HeadlessServiceName, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The temporary NodePort Services the nodeport check probes, one per
+// externalTrafficPolicy.
+const (
+	NodePortClusterServiceName = "netdebug-nodeport-cluster"
+	NodePortLocalServiceName   = "netdebug-nodeport-local"
+)
+
+// CreateNodePortServices creates NodePort Services with externalTrafficPolicy
+// Cluster and Local in front of the overlay agents, reusing any left behind by
+// an earlier run, and returns their node ports.
+func CreateNodePortServices(ctx context.Context, clientset *kubernetes.Clientset, namespace string) (*types.NodePortTest, error) {
+	clusterPort, err := createNodePortService(ctx, clientset, namespace, NodePortClusterServiceName, corev1.ServiceExternalTrafficPolicyCluster)
+	if err != nil {
+		return nil, err
+	}
+
+	localPort, err := createNodePortService(ctx, clientset, namespace, NodePortLocalServiceName, corev1.ServiceExternalTrafficPolicyLocal)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.NodePortTest{
+		ClusterPort: clusterPort,
+		LocalPort:   localPort,
+	}, nil
+}
+
+func createNodePortService(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string, policy corev1.ServiceExternalTrafficPolicy) (int, error) {
+	labels := map[string]string{"app": "netdebug", "network-mode": "overlay"}
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:                  corev1.ServiceTypeNodePort,
+			Selector:              labels,
+			ExternalTrafficPolicy: policy,
+			Ports: []corev1.ServicePort{{
+				Name:       "http",
+				Port:       80,
+				TargetPort: intstr.FromString("http"),
+				Protocol:   corev1.ProtocolTCP,
+			}},
+		},
+	}
+
+	created, err := clientset.CoreV1().Services(namespace).Create(ctx, svc, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		created, err = clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to create Service %s: %w", name, err)
+	}
+
+	if len(created.Spec.Ports) == 0 || created.Spec.Ports[0].NodePort == 0 {
+		return 0, fmt.Errorf("service %s has no node port", name)
+	}
+	return int(created.Spec.Ports[0].NodePort), nil
+}
+
+// DeleteNodePortServices removes the Services made by CreateNodePortServices.
+func DeleteNodePortServices(ctx context.Context, clientset *kubernetes.Clientset, namespace string) error {
+	for _, name := range []string{NodePortClusterServiceName, NodePortLocalServiceName} {
+		err := clientset.CoreV1().Services(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete Service %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/ryanelliottsmith/network-debugger/internal/manifests"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ServiceName is the ClusterIP Service in front of the overlay agents, used by
+// the service check to test kube-proxy's data path.
+const ServiceName = "netdebug-overlay"
+
+// EnsureService creates the overlay agents' Service if it doesn't exist yet,
+// for installs made before it was part of the manifests.
+func EnsureService(ctx context.Context, dynamicClient dynamic.Interface, namespace string) error {
+	serviceYAML := strings.ReplaceAll(manifests.ServiceYAML, "namespace: default", "namespace: "+namespace)
+	return applyYAML(ctx, dynamicClient, serviceYAML)
+}
+
+// GetServiceAddress returns the ClusterIP:port of the overlay agents' Service.
+func GetServiceAddress(ctx context.Context, clientset *kubernetes.Clientset, namespace string) (string, error) {
+	svc, err := clientset.CoreV1().Services(namespace).Get(ctx, ServiceName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get Service %s: %w", ServiceName, err)
+	}
+
+	if svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == "None" || len(svc.Spec.Ports) == 0 {
+		return "", fmt.Errorf("service %s has no ClusterIP", ServiceName)
+	}
+
+	return net.JoinHostPort(svc.Spec.ClusterIP, strconv.Itoa(int(svc.Spec.Ports[0].Port))), nil
+}
@@ -0,0 +1,272 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+const namespace = "netdebug"
+
+var pathLabels = []string{"source_node", "target_node", "network"}
+
+// Recorder turns check results into Prometheus metrics.
+type Recorder struct {
+	registry *prometheus.Registry
+
+	checkSuccess   *prometheus.GaugeVec
+	lastRun        *prometheus.GaugeVec
+	pingRTT        *prometheus.GaugeVec
+	pingRTTHist    *prometheus.HistogramVec
+	pingLoss       *prometheus.GaugeVec
+	dnsLatency     *prometheus.HistogramVec
+	dnsSuccess     *prometheus.GaugeVec
+	portReachable  *prometheus.GaugeVec
+	portLatency    *prometheus.GaugeVec
+	ctEntries      *prometheus.GaugeVec
+	ctMaxEntries   *prometheus.GaugeVec
+	ctUtilization  *prometheus.GaugeVec
+	ctInsertFailed *prometheus.GaugeVec
+	ctDrops        *prometheus.GaugeVec
+	hostIssues     *prometheus.GaugeVec
+
+	mu sync.Mutex
+	// current and previous hold the series set by the running and by the last
+	// finished monitoring pass, so MarkRun can delete the ones that went away.
+	current  map[series][]string
+	previous map[series][]string
+}
+
+// labeledVec is a metric vector whose series can be deleted by label values.
+type labeledVec interface {
+	DeleteLabelValues(lvs ...string) bool
+}
+
+// series identifies one series of a metric vector.
+type series struct {
+	vec labeledVec
+	key string
+}
+
+func NewRecorder() *Recorder {
+	r := &Recorder{
+		registry: prometheus.NewRegistry(),
+		current:  make(map[series][]string),
+		previous: make(map[series][]string),
+		checkSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "check_success",
+			Help:      "Whether the last run of a check passed (1) or failed (0).",
+		}, []string{"check", "source_node", "target_node", "network"}),
+		lastRun: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "monitor_last_run_timestamp_seconds",
+			Help:      "Unix time the last monitoring pass finished.",
+		}, []string{"source_node", "network"}),
+		pingRTT: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "ping_rtt_seconds",
+			Help:      "Round trip time of the last ping run.",
+		}, append(pathLabels, "stat")),
+		pingRTTHist: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "ping_rtt_avg_seconds",
+			Help:      "Distribution of the average round trip time of each ping run.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, pathLabels),
+		pingLoss: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "ping_packet_loss_ratio",
+			Help:      "Packet loss of the last ping run, from 0 to 1.",
+		}, pathLabels),
+		dnsLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "dns_lookup_duration_seconds",
+			Help:      "DNS lookup latency.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"source_node", "network", "query"}),
+		dnsSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "dns_lookup_success",
+			Help:      "Whether the last lookup of a name returned any addresses (1) or not (0).",
+		}, []string{"source_node", "network", "query"}),
+		portReachable: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "port_reachable",
+			Help:      "Whether a port on the target node was reachable (1) or not (0).",
+		}, append(pathLabels, "port", "protocol")),
+		portLatency: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "port_connect_seconds",
+			Help:      "Time taken to connect to a reachable port.",
+		}, append(pathLabels, "port", "protocol")),
+		ctEntries: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "conntrack_entries",
+			Help:      "Current number of conntrack entries.",
+		}, []string{"node"}),
+		ctMaxEntries: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "conntrack_max_entries",
+			Help:      "Size of the conntrack table.",
+		}, []string{"node"}),
+		ctUtilization: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "conntrack_utilization_ratio",
+			Help:      "Conntrack table utilization, from 0 to 1.",
+		}, []string{"node"}),
+		ctInsertFailed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "conntrack_insert_failed",
+			Help:      "Conntrack insert failures reported by the kernel.",
+		}, []string{"node"}),
+		ctDrops: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "conntrack_drops",
+			Help:      "Conntrack drops reported by the kernel.",
+		}, []string{"node"}),
+		hostIssues: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "hostconfig_issues",
+			Help:      "Number of host configuration issues found.",
+		}, []string{"node"}),
+	}
+
+	r.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		r.checkSuccess,
+		r.lastRun,
+		r.pingRTT,
+		r.pingRTTHist,
+		r.pingLoss,
+		r.dnsLatency,
+		r.dnsSuccess,
+		r.portReachable,
+		r.portLatency,
+		r.ctEntries,
+		r.ctMaxEntries,
+		r.ctUtilization,
+		r.ctInsertFailed,
+		r.ctDrops,
+		r.hostIssues,
+	)
+
+	return r
+}
+
+// Handler serves the recorded metrics in the Prometheus exposition format.
+func (r *Recorder) Handler() http.Handler {
+	return promhttp.HandlerFor(r.registry, promhttp.HandlerOpts{})
+}
+
+// Observe records a test result event. Details are expected to hold the typed
+// structs produced by the checks in this process, not JSON-decoded maps.
+func (r *Recorder) Observe(event *types.Event, network types.NetworkType, targetNode string) {
+	if event.Type != types.EventTypeTestResult {
+		return
+	}
+
+	source := event.Node
+	net := string(network)
+
+	success := 0.0
+	if event.Status == "pass" || event.Status == "warn" {
+		success = 1
+	}
+	r.set(r.checkSuccess, success, event.Check, source, targetNode, net)
+
+	details, ok := event.Details.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	switch d := details[event.Check].(type) {
+	case types.PingCheckDetails:
+		r.set(r.pingRTT, d.MinLatencyMS/1000, source, targetNode, net, "min")
+		r.set(r.pingRTT, d.AvgLatencyMS/1000, source, targetNode, net, "avg")
+		r.set(r.pingRTT, d.MaxLatencyMS/1000, source, targetNode, net, "max")
+		r.set(r.pingLoss, d.PacketLoss/100, source, targetNode, net)
+		if d.PacketsReceived > 0 {
+			r.observe(r.pingRTTHist, d.AvgLatencyMS/1000, source, targetNode, net)
+		}
+	case types.ConntrackDetails:
+		r.set(r.ctEntries, float64(d.Entries), source)
+		r.set(r.ctMaxEntries, float64(d.MaxEntries), source)
+		if d.MaxEntries > 0 {
+			r.set(r.ctUtilization, float64(d.Entries)/float64(d.MaxEntries), source)
+		}
+		r.set(r.ctInsertFailed, float64(d.InsertsFailed), source)
+		r.set(r.ctDrops, float64(d.DropCount), source)
+	case types.HostConfigDetails:
+		r.set(r.hostIssues, float64(len(d.Issues)), source)
+	}
+
+	if lookups, ok := details["lookups"].([]types.DNSCheckDetails); ok {
+		for _, lookup := range lookups {
+			resolved := 0.0
+			if lookup.Error == "" {
+				resolved = 1
+				r.observe(r.dnsLatency, lookup.LatencyMS/1000, source, net, lookup.Query)
+			}
+			r.set(r.dnsSuccess, resolved, source, net, lookup.Query)
+		}
+	}
+
+	if ports, ok := details["ports"].([]types.PortCheckDetails); ok {
+		for _, port := range ports {
+			// A silent UDP port may well be open, so it isn't reported either way
+			if port.State == types.PortOpenFiltered {
+				continue
+			}
+			portStr := strconv.Itoa(port.Port)
+			open := 0.0
+			if port.Open {
+				open = 1
+				r.set(r.portLatency, port.LatencyMS/1000, source, targetNode, net, portStr, port.Protocol)
+			}
+			r.set(r.portReachable, open, source, targetNode, net, portStr, port.Protocol)
+		}
+	}
+}
+
+// MarkRun records that a monitoring pass finished, and deletes the series of
+// the previous pass that this one didn't set, such as those of removed nodes,
+// so they aren't scraped forever.
+func (r *Recorder) MarkRun(source string, network types.NetworkType, at time.Time) {
+	r.lastRun.WithLabelValues(source, string(network)).Set(float64(at.Unix()))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for s, labels := range r.previous {
+		if _, ok := r.current[s]; !ok {
+			s.vec.DeleteLabelValues(labels...)
+		}
+	}
+	r.previous = r.current
+	r.current = make(map[series][]string)
+}
+
+func (r *Recorder) set(vec *prometheus.GaugeVec, value float64, labels ...string) {
+	vec.WithLabelValues(labels...).Set(value)
+	r.track(vec, labels)
+}
+
+func (r *Recorder) observe(vec *prometheus.HistogramVec, value float64, labels ...string) {
+	vec.WithLabelValues(labels...).Observe(value)
+	r.track(vec, labels)
+}
+
+// track marks a series as set by the running monitoring pass.
+func (r *Recorder) track(vec labeledVec, labels []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current[series{vec: vec, key: strings.Join(labels, "\xff")}] = labels
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/ryanelliottsmith/network-debugger/pkg/types"
+)
+
+func pingEvent(target string) *types.Event {
+	return &types.Event{
+		Type:   types.EventTypeTestResult,
+		Node:   "node-1",
+		Check:  "ping",
+		Target: target,
+		Status: "pass",
+		Details: map[string]interface{}{
+			"ping": types.PingCheckDetails{PacketsReceived: 3, AvgLatencyMS: 1},
+		},
+	}
+}
+
+func TestMarkRun_DeletesStaleSeries(t *testing.T) {
+	r := NewRecorder()
+
+	r.Observe(pingEvent("10.0.0.2"), types.NetworkTypeHost, "node-2")
+	r.Observe(pingEvent("10.0.0.3"), types.NetworkTypeHost, "node-3")
+	r.MarkRun("node-1", types.NetworkTypeHost, time.Now())
+
+	if got := testutil.CollectAndCount(r.pingLoss); got != 2 {
+		t.Fatalf("after first pass: %d ping loss series, want 2", got)
+	}
+
+	// node-3 went away
+	r.Observe(pingEvent("10.0.0.2"), types.NetworkTypeHost, "node-2")
+	if got := testutil.CollectAndCount(r.pingLoss); got != 2 {
+		t.Errorf("during second pass: %d ping loss series, want 2", got)
+	}
+	r.MarkRun("node-1", types.NetworkTypeHost, time.Now())
+
+	if got := testutil.CollectAndCount(r.pingLoss); got != 1 {
+		t.Errorf("after second pass: %d ping loss series, want 1", got)
+	}
+	if got := testutil.CollectAndCount(r.pingRTTHist); got != 1 {
+		t.Errorf("after second pass: %d ping RTT histogram series, want 1", got)
+	}
+	if got := testutil.CollectAndCount(r.checkSuccess); got != 1 {
+		t.Errorf("after second pass: %d check success series, want 1", got)
+	}
+}
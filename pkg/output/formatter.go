@@ -54,6 +54,8 @@ func printTable(result *types.TestResult) error {
 	status := "PASS"
 	if result.Status == types.StatusFail {
 		status = "FAIL"
+	} else if result.Status == types.StatusWarn {
+		status = "WARN"
 	} else if result.Status == types.StatusIncomplete {
 		status = "UNKNOWN"
 	}
@@ -94,6 +96,8 @@ func printTableSummary(summary *types.TestSummary) error {
 			status := "PASS"
 			if result.Status == types.StatusFail {
 				status = "FAIL"
+			} else if result.Status == types.StatusWarn {
+				status = "WARN"
 			} else if result.Status == types.StatusIncomplete {
 				status = "UNKNOWN"
 			}
@@ -130,19 +134,35 @@ func printEventsTable(events []*types.Event, quiet bool) error {
 	}
 
 	// Group events by check type
-	checkOrder := []string{"ping", "dns", "ports", "bandwidth", "hostconfig", "conntrack", "iptables"}
+	checkOrder := []string{"ping", "tcpping", "traceroute", "pmtu", "dns", "dnsrecords", "service", "ports", "nodeport", "bandwidth", "hostconfig", "resolvconf", "overlaymtu", "conntrack", "iptables"}
 	eventsByCheck := make(map[string][]*types.Event)
 
 	passed := 0
 	failed := 0
+	warned := 0
+	incomplete := 0
 	errors := 0
+	var crashed []*types.Event
+	var nodePortEvents []*types.Event
+	networks := make(map[string]bool)
 
 	for _, event := range events {
+		if event.Type == types.EventTypeTestResult {
+			networks[event.Network] = true
+			if event.Check == "nodeport" {
+				nodePortEvents = append(nodePortEvents, event)
+			}
+		}
 		if event.Type == types.EventTypeTestResult {
 			// Always count for summary
-			if event.Status == "fail" {
+			switch event.Status {
+			case "fail":
 				failed++
-			} else {
+			case string(types.StatusWarn):
+				warned++
+			case string(types.StatusIncomplete):
+				incomplete++
+			default:
 				passed++
 			}
 
@@ -151,15 +171,21 @@ func printEventsTable(events []*types.Event, quiet bool) error {
 			alwaysShow := check != nil && check.AlwaysShow()
 
 			// Only include in display if failed OR not quiet OR check says always show
-			if event.Status == "fail" || !quiet || alwaysShow {
+			if event.Status != "pass" || !quiet || alwaysShow {
 				eventsByCheck[event.Check] = append(eventsByCheck[event.Check], event)
 			}
 		} else if event.Type == types.EventTypeError {
 			errors++
 			eventsByCheck[event.Check] = append(eventsByCheck[event.Check], event)
+		} else if event.Type == types.EventTypeCrashed {
+			crashed = append(crashed, event)
 		}
 	}
 
+	// Results from more than one network, e.g. host and cross-network runs,
+	// get a NETWORK column to tell them apart
+	showNetwork := len(networks) > 1
+
 	// Print grouped results
 	for _, check := range checkOrder {
 		checkEvents, ok := eventsByCheck[check]
@@ -187,13 +213,33 @@ func printEventsTable(events []*types.Event, quiet bool) error {
 		}
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
 		if isLocal {
-			fmt.Fprintf(w, "NODE\tSTATUS\tDETAILS\n")
+			fmt.Fprintf(w, "NODE\t%sSTATUS\tDETAILS\n", networkColumn("NETWORK", showNetwork))
 			for _, event := range checkEvents {
-				status := "PASS"
-				if event.Status == "fail" {
-					status = "FAIL"
+				status := eventStatus(event)
+
+				details := ""
+				if checkInstance != nil {
+					details = checkInstance.FormatSummary(event.Details, quiet)
+				}
+				if event.Error != "" {
+					if details != "" {
+						details = details + " | " + event.Error
+					} else {
+						details = event.Error
+					}
+				}
+				if details == "" {
+					details = "-"
 				}
 
+				fmt.Fprintf(w, "%s\t%s%s\t%s\n", event.Node, networkColumn(event.Network, showNetwork), status, details)
+			}
+		} else if check == "bandwidth" && hasUDPBandwidth(checkEvents) {
+			fmt.Fprintf(w, "NODE\t%sTARGET\tSTATUS\tBITRATE\tJITTER\tLOST\tDETAILS\n", networkColumn("NETWORK", showNetwork))
+			for _, event := range checkEvents {
+				status := eventStatus(event)
+				bitrate, jitter, lost := udpBandwidthColumns(event.Details)
+
 				details := ""
 				if checkInstance != nil {
 					details = checkInstance.FormatSummary(event.Details, quiet)
@@ -209,15 +255,12 @@ func printEventsTable(events []*types.Event, quiet bool) error {
 					details = "-"
 				}
 
-				fmt.Fprintf(w, "%s\t%s\t%s\n", event.Node, status, details)
+				fmt.Fprintf(w, "%s\t%s%s\t%s\t%s\t%s\t%s\t%s\n", event.Node, networkColumn(event.Network, showNetwork), event.Target, status, bitrate, jitter, lost, details)
 			}
 		} else {
-			fmt.Fprintf(w, "NODE\tTARGET\tSTATUS\tDETAILS\n")
+			fmt.Fprintf(w, "NODE\t%sTARGET\tSTATUS\tDETAILS\n", networkColumn("NETWORK", showNetwork))
 			for _, event := range checkEvents {
-				status := "PASS"
-				if event.Status == "fail" {
-					status = "FAIL"
-				}
+				status := eventStatus(event)
 
 				details := ""
 				if checkInstance != nil {
@@ -235,10 +278,14 @@ func printEventsTable(events []*types.Event, quiet bool) error {
 					details = "-"
 				}
 
-				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", event.Node, event.Target, status, details)
+				fmt.Fprintf(w, "%s\t%s%s\t%s\t%s\n", event.Node, networkColumn(event.Network, showNetwork), event.Target, status, details)
 			}
 		}
 		w.Flush()
+
+		if check == "nodeport" {
+			printNodePortMatrix(nodePortEvents)
+		}
 	}
 
 	// Handle any checks not in our predefined order
@@ -263,13 +310,10 @@ func printEventsTable(events []*types.Event, quiet bool) error {
 		}
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-		fmt.Fprintf(w, "NODE\tTARGET\tSTATUS\tDETAILS\n")
+		fmt.Fprintf(w, "NODE\t%sTARGET\tSTATUS\tDETAILS\n", networkColumn("NETWORK", showNetwork))
 
 		for _, event := range checkEvents {
-			status := "PASS"
-			if event.Status == "fail" {
-				status = "FAIL"
-			}
+			status := eventStatus(event)
 
 			details := ""
 			if checkInstance != nil {
@@ -287,13 +331,170 @@ func printEventsTable(events []*types.Event, quiet bool) error {
 				details = "-"
 			}
 
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", event.Node, event.Target, status, details)
+			fmt.Fprintf(w, "%s\t%s%s\t%s\t%s\n", event.Node, networkColumn(event.Network, showNetwork), event.Target, status, details)
+		}
+		w.Flush()
+	}
+
+	if len(crashed) > 0 {
+		fmt.Printf("\nCRASHED AGENTS\n")
+		fmt.Printf("These agents stopped before finishing the run, so their remaining results are missing.\n")
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintf(w, "NODE\tPOD\tDETAILS\n")
+		for _, event := range crashed {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", event.Node, event.Pod, event.Error)
 		}
 		w.Flush()
 	}
 
 	fmt.Println()
-	fmt.Printf("Summary: %d passed, %d failed, %d errors\n", passed, failed, errors)
+	if len(crashed) > 0 {
+		fmt.Printf("Summary: %d passed, %d failed, %d warnings, %d incomplete, %d errors, %d crashed\n", passed, failed, warned, incomplete, errors, len(crashed))
+	} else {
+		fmt.Printf("Summary: %d passed, %d failed, %d warnings, %d incomplete, %d errors\n", passed, failed, warned, incomplete, errors)
+	}
 
 	return nil
 }
+
+// hasUDPBandwidth reports whether any of the bandwidth results is from a UDP
+// test, which gets its own columns.
+func hasUDPBandwidth(events []*types.Event) bool {
+	for _, event := range events {
+		if detailsMap, ok := event.Details.(map[string]interface{}); ok {
+			if _, ok := detailsMap["udp_bandwidth"]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// udpBandwidthColumns returns the BITRATE, JITTER and LOST cells of a UDP
+// bandwidth result, e.g. "942.13 Mbps", "0.021 ms" and "12/81234 (0.01%)".
+func udpBandwidthColumns(details interface{}) (string, string, string) {
+	detailsMap, ok := details.(map[string]interface{})
+	if !ok {
+		return "-", "-", "-"
+	}
+	udp, ok := detailsMap["udp_bandwidth"].(map[string]interface{})
+	if !ok {
+		return "-", "-", "-"
+	}
+
+	mbps, _ := udp["bandwidth_mbps"].(float64)
+	jitter, _ := udp["jitter_ms"].(float64)
+	lost, _ := udp["lost_datagrams"].(float64)
+	total, _ := udp["total_datagrams"].(float64)
+	lostPercent, _ := udp["lost_percent"].(float64)
+
+	return fmt.Sprintf("%.2f Mbps", mbps),
+		fmt.Sprintf("%.3f ms", jitter),
+		fmt.Sprintf("%d/%d (%.2f%%)", int(lost), int(total), lostPercent)
+}
+
+// printNodePortMatrix prints the nodeport results as a source node by target
+// matrix, with the Cluster and Local policy outcome in each cell.
+func printNodePortMatrix(events []*types.Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	var sources, targets []string
+	seenSource := make(map[string]bool)
+	seenTarget := make(map[string]bool)
+	cells := make(map[string]map[string]string)
+	for _, event := range events {
+		if !seenSource[event.Node] {
+			seenSource[event.Node] = true
+			sources = append(sources, event.Node)
+			cells[event.Node] = make(map[string]string)
+		}
+		if !seenTarget[event.Target] {
+			seenTarget[event.Target] = true
+			targets = append(targets, event.Target)
+		}
+		cells[event.Node][event.Target] = nodePortCell(event.Details)
+	}
+	sort.Strings(sources)
+	sort.Strings(targets)
+
+	fmt.Println("\nNodePort matrix (C = Cluster, L = Local policy)")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "SOURCE \\ TARGET\t%s\n", strings.Join(targets, "\t"))
+	for _, source := range sources {
+		row := make([]string, 0, len(targets))
+		for _, target := range targets {
+			cell, ok := cells[source][target]
+			if !ok {
+				cell = "-"
+			}
+			row = append(row, cell)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", source, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
+
+// nodePortCell is the matrix cell for one nodeport result, e.g. "C:ok L:FAIL".
+// A Local port without a backend on the target node shows as "L:-".
+func nodePortCell(details interface{}) string {
+	detailsMap, ok := details.(map[string]interface{})
+	if !ok {
+		return "?"
+	}
+	probes, ok := detailsMap["nodeports"].([]interface{})
+	if !ok {
+		return "?"
+	}
+
+	parts := make([]string, 0, len(probes))
+	for _, p := range probes {
+		probe, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		policy, _ := probe["policy"].(string)
+		reachable, _ := probe["reachable"].(bool)
+		expected, _ := probe["expected"].(bool)
+
+		outcome := "FAIL"
+		switch {
+		case !expected:
+			outcome = "-"
+		case reachable:
+			outcome = "ok"
+		}
+		if policy != "" {
+			policy = policy[:1]
+		}
+		parts = append(parts, policy+":"+outcome)
+	}
+	return strings.Join(parts, " ")
+}
+
+// networkColumn returns value as a NETWORK column cell, or nothing when the
+// column isn't shown.
+func networkColumn(value string, show bool) string {
+	if !show {
+		return ""
+	}
+	if value == "" {
+		value = "-"
+	}
+	return value + "\t"
+}
+
+// eventStatus is the STATUS column for a test_result event.
+func eventStatus(event *types.Event) string {
+	switch event.Status {
+	case "fail":
+		return "FAIL"
+	case string(types.StatusWarn):
+		return "WARN"
+	case string(types.StatusIncomplete):
+		return "INCOMPLETE"
+	default:
+		return "PASS"
+	}
+}
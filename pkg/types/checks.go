@@ -3,6 +3,7 @@ package types
 import (
 	"context"
 	"sync"
+	"time"
 )
 
 type Check interface {
@@ -13,6 +14,9 @@ type Check interface {
 	HostNetworkOnly() bool
 	AlwaysShow() bool
 	FormatSummary(details interface{}, quiet bool) string
+	// DefaultTimeout is how long a single run of the check may take unless
+	// the run's Config overrides it.
+	DefaultTimeout() time.Duration
 }
 
 var DefaultRegistry = NewRegistry()
@@ -1,6 +1,11 @@
 package types
 
-import "time"
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
 
 // NetworkType indicates the network context a pod is running in.
 type NetworkType string
@@ -8,8 +13,47 @@ type NetworkType string
 const (
 	NetworkTypeHost    NetworkType = "hostnetwork"
 	NetworkTypeOverlay NetworkType = "overlay"
+
+	// NetworkTypeHostToOverlay runs from host network pods against overlay pod IPs.
+	NetworkTypeHostToOverlay NetworkType = "host->overlay"
+	// NetworkTypeOverlayToHost runs from overlay pods against node IPs.
+	NetworkTypeOverlayToHost NetworkType = "overlay->host"
 )
 
+// TargetNetwork returns the network the targets of a run live in, which for
+// the cross-network types differs from the network the agents run in.
+func (n NetworkType) TargetNetwork() NetworkType {
+	switch n {
+	case NetworkTypeHostToOverlay:
+		return NetworkTypeOverlay
+	case NetworkTypeOverlayToHost:
+		return NetworkTypeHost
+	}
+	return n
+}
+
+// TargetsOwnNode reports whether agents test their own node's target too.
+// They do across networks, where the node's own pod or host is a separate
+// path, the one the kubelet's probes take.
+func (n NetworkType) TargetsOwnNode() bool {
+	return n.TargetNetwork() != n
+}
+
+// AgentPort is the port the agent's HTTP server listens on by default.
+const AgentPort = 9797
+
+// HealthPort is the port the agent serves its health endpoints on by default,
+// separately from the HTTP server so readiness doesn't depend on it.
+const HealthPort = 9798
+
+// TokenHeader carries the shared agent API token. A custom header is used
+// because the API server pod proxy does not forward Authorization to the pod.
+const TokenHeader = "X-Netdebug-Token"
+
+// WhoamiPath is the agent HTTP endpoint that answers with the agent's node
+// name, so a client behind a Service can tell which backend answered.
+const WhoamiPath = "/whoami"
+
 type TargetNode struct {
 	NodeName       string `json:"node_name"`
 	PodName        string `json:"pod_name,omitempty"`
@@ -17,6 +61,15 @@ type TargetNode struct {
 	IsControlPlane bool   `json:"is_controlplane"`
 }
 
+// DNSServer is a cluster DNS server the dns check queries directly: the
+// kube-dns Service VIP or one CoreDNS replica behind it.
+type DNSServer struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	// NodeName is the node a replica runs on. Empty for the Service VIP.
+	NodeName string `json:"node_name,omitempty"`
+}
+
 type BandwidthTest struct {
 	Active     bool   `json:"active"`
 	SourceNode string `json:"source_node"`
@@ -24,17 +77,120 @@ type BandwidthTest struct {
 	TargetNode string `json:"target_node"`
 	TargetIP   string `json:"target_ip"`
 	IperfArgs  string `json:"iperf_args,omitempty"`
+	// UDPBitrate switches the test to UDP at this iperf3 target bitrate
+	// (e.g. "100M"). Empty runs a TCP test.
+	UDPBitrate string `json:"udp_bitrate,omitempty"`
+}
+
+// NodePortTest holds the temporary NodePort Services in front of the overlay
+// agents that the nodeport check probes on every node.
+type NodePortTest struct {
+	// ClusterPort is the node port of the externalTrafficPolicy: Cluster Service.
+	ClusterPort int `json:"cluster_port"`
+	// LocalPort is the node port of the externalTrafficPolicy: Local Service.
+	LocalPort int `json:"local_port"`
+	// BackendNodes are the nodes running an overlay agent, which are the only
+	// ones that answer on LocalPort.
+	BackendNodes []string `json:"backend_nodes"`
+}
+
+// DNSRecordsTest holds the temporary headless Service in front of the overlay
+// agents whose records the dnsrecords check verifies.
+type DNSRecordsTest struct {
+	// Service is the fully qualified name of the headless Service.
+	Service   string `json:"service"`
+	Namespace string `json:"namespace"`
+	// PortName and Port are the Service's named TCP port, which is published
+	// as an SRV record.
+	PortName string `json:"port_name"`
+	Port     int    `json:"port"`
+	// Pods are the overlay agents the Service selects. Their IPs must be
+	// exactly the Service's A records.
+	Pods []TargetNode `json:"pods"`
+	// Server is the kube-dns VIP host:port the host network agents query,
+	// since their resolv.conf doesn't point at cluster DNS.
+	Server string `json:"server,omitempty"`
 }
 
 type Config struct {
-	RunID         string         `json:"run_id"`
-	TriggeredAt   time.Time      `json:"triggered_at"`
-	NetworkType   NetworkType    `json:"network_type"`
-	Targets       []TargetNode   `json:"targets"`
-	Checks        []string       `json:"checks"`
-	Ports         []PortCheck    `json:"ports"`
-	DNSNames      []string       `json:"dns_names"`
-	BandwidthTest *BandwidthTest `json:"bandwidth_test,omitempty"`
-	Timeout       int            `json:"timeout_seconds"`
+	RunID       string       `json:"run_id"`
+	TriggeredAt time.Time    `json:"triggered_at"`
+	NetworkType NetworkType  `json:"network_type"`
+	Targets     []TargetNode `json:"targets"`
+	Checks      []string     `json:"checks"`
+	Ports       []PortCheck  `json:"ports"`
+	DNSNames    []string     `json:"dns_names"`
+	// DNSServers are the kube-dns VIP and CoreDNS replicas the overlay dns
+	// check sends DNSNames to individually.
+	DNSServers []DNSServer `json:"dns_servers,omitempty"`
+	// DNSTransport has the dns check repeat every lookup over plain UDP, UDP
+	// with EDNS0 and TCP.
+	DNSTransport bool `json:"dns_transport,omitempty"`
+	// DNSBurst has the dns check send this many pairs of parallel A and AAAA
+	// queries for every name.
+	DNSBurst int `json:"dns_burst,omitempty"`
+	// CNI is the CNI port profile already merged into Ports. Empty asks host
+	// network agents to detect the CNI themselves; CNINone disables profiles.
+	CNI string `json:"cni,omitempty"`
+	// PortNodes limits ports, by name, to the nodes listening on them, such
+	// as calico-typha to the nodes running a Typha replica.
+	PortNodes map[string][]string `json:"port_nodes,omitempty"`
+	// ServiceAddress is the ClusterIP:port of the overlay agents' Service,
+	// which the service check connects to.
+	ServiceAddress string `json:"service_address,omitempty"`
+	// ServiceBackends are the nodes of the overlay agents behind the Service,
+	// which the service check expects answers from.
+	ServiceBackends []string `json:"service_backends,omitempty"`
+	// NodePort holds the NodePort Services the nodeport check probes.
+	NodePort *NodePortTest `json:"nodeport,omitempty"`
+	// DNSRecords holds the headless Service the dnsrecords check resolves.
+	DNSRecords    *DNSRecordsTest `json:"dns_records,omitempty"`
+	BandwidthTest *BandwidthTest  `json:"bandwidth_test,omitempty"`
+	// Timeout, in seconds, overrides the default timeout of every check
+	// without an entry in CheckTimeouts. Zero keeps each check's default.
+	Timeout int `json:"timeout_seconds,omitempty"`
+	// CheckTimeouts holds per-check timeouts in seconds, keyed by check name.
+	CheckTimeouts map[string]int `json:"check_timeouts_seconds,omitempty"`
 	Quiet         bool           `json:"quiet,omitempty"`
+	// Cancelled tells agents to abort the run with this RunID.
+	Cancelled bool `json:"cancelled,omitempty"`
+}
+
+// CheckTimeout returns how long the named check may run in this config: its
+// CheckTimeouts entry, then Timeout, then the check's own default.
+func (c *Config) CheckTimeout(name string, def time.Duration) time.Duration {
+	if secs, ok := c.CheckTimeouts[name]; ok && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if c.Timeout > 0 {
+		return time.Duration(c.Timeout) * time.Second
+	}
+	return def
+}
+
+// ParseCheckTimeouts parses per-check timeouts in the format check=duration,
+// e.g. "ping=15s" or "ports=1m". Durations are rounded up to whole seconds.
+func ParseCheckTimeouts(specs []string) (map[string]int, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	timeouts := make(map[string]int, len(specs))
+	for _, spec := range specs {
+		name, value, ok := strings.Cut(strings.TrimSpace(spec), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid check timeout %q (expected check=duration)", spec)
+		}
+
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout for %s: %w", name, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("timeout for %s must be positive", name)
+		}
+
+		timeouts[name] = int(math.Ceil(d.Seconds()))
+	}
+	return timeouts, nil
 }
@@ -0,0 +1,72 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCheckTimeouts(t *testing.T) {
+	got, err := ParseCheckTimeouts([]string{"ping=15s", "ports=1m", "dns=1500ms"})
+	if err != nil {
+		t.Fatalf("ParseCheckTimeouts unexpected error: %v", err)
+	}
+	want := map[string]int{"ping": 15, "ports": 60, "dns": 2}
+	if len(got) != len(want) {
+		t.Fatalf("ParseCheckTimeouts = %v, want %v", got, want)
+	}
+	for name, secs := range want {
+		if got[name] != secs {
+			t.Errorf("ParseCheckTimeouts()[%q] = %d, want %d", name, got[name], secs)
+		}
+	}
+
+	for _, spec := range []string{"ping", "=15s", "ping=fast", "ping=0s", "ping=-1s"} {
+		if _, err := ParseCheckTimeouts([]string{spec}); err == nil {
+			t.Errorf("ParseCheckTimeouts(%q) expected error", spec)
+		}
+	}
+}
+
+func TestConfigCheckTimeout(t *testing.T) {
+	def := 5 * time.Second
+
+	config := &Config{}
+	if got := config.CheckTimeout("ping", def); got != def {
+		t.Errorf("CheckTimeout with no overrides = %v, want %v", got, def)
+	}
+
+	config.Timeout = 20
+	if got := config.CheckTimeout("ping", def); got != 20*time.Second {
+		t.Errorf("CheckTimeout with Timeout = %v, want 20s", got)
+	}
+
+	config.CheckTimeouts = map[string]int{"ping": 30}
+	if got := config.CheckTimeout("ping", def); got != 30*time.Second {
+		t.Errorf("CheckTimeout with per-check override = %v, want 30s", got)
+	}
+	if got := config.CheckTimeout("dns", def); got != 20*time.Second {
+		t.Errorf("CheckTimeout for check without override = %v, want 20s", got)
+	}
+}
+
+func TestNetworkTypeTargetNetwork(t *testing.T) {
+	tests := []struct {
+		in      NetworkType
+		want    NetworkType
+		ownNode bool
+	}{
+		{NetworkTypeHost, NetworkTypeHost, false},
+		{NetworkTypeOverlay, NetworkTypeOverlay, false},
+		{NetworkTypeHostToOverlay, NetworkTypeOverlay, true},
+		{NetworkTypeOverlayToHost, NetworkTypeHost, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.in.TargetNetwork(); got != tt.want {
+			t.Errorf("%s.TargetNetwork() = %s, want %s", tt.in, got, tt.want)
+		}
+		if got := tt.in.TargetsOwnNode(); got != tt.ownNode {
+			t.Errorf("%s.TargetsOwnNode() = %v, want %v", tt.in, got, tt.ownNode)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package types
+
+import "time"
+
+// NetdebugRunSpec is the spec of a NetdebugRun custom resource.
+type NetdebugRunSpec struct {
+	Config Config `json:"config"`
+	// Pods limits the run to these agent pods. Empty means every agent.
+	Pods []string `json:"pods,omitempty"`
+}
+
+// NetdebugResultSpec identifies the agent a NetdebugResult belongs to.
+type NetdebugResultSpec struct {
+	RunID   string `json:"run_id"`
+	Node    string `json:"node"`
+	Pod     string `json:"pod"`
+	Network string `json:"network,omitempty"`
+}
+
+// NetdebugResultStatus holds one agent's results for a run.
+type NetdebugResultStatus struct {
+	Conditions []Condition  `json:"conditions,omitempty"`
+	Results    []TestResult `json:"results,omitempty"`
+	Errors     []string     `json:"errors,omitempty"`
+	Summary    interface{}  `json:"summary,omitempty"`
+}
+
+const (
+	// ConditionReady is set once the agent has picked up the run.
+	ConditionReady = "Ready"
+	// ConditionComplete is set once the agent has finished the run.
+	ConditionComplete = "Complete"
+
+	// ReasonCancelled is the Complete reason for a run that was cancelled.
+	ReasonCancelled = "RunCancelled"
+)
+
+type Condition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"`
+	Reason             string    `json:"reason,omitempty"`
+	Message            string    `json:"message,omitempty"`
+	LastTransitionTime time.Time `json:"lastTransitionTime"`
+}
+
+// SetCondition adds the condition or updates the existing one of the same type.
+func (s *NetdebugResultStatus) SetCondition(condType, status, reason, message string) {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == condType {
+			if s.Conditions[i].Status != status {
+				s.Conditions[i].LastTransitionTime = time.Now()
+			}
+			s.Conditions[i].Status = status
+			s.Conditions[i].Reason = reason
+			s.Conditions[i].Message = message
+			return
+		}
+	}
+
+	s.Conditions = append(s.Conditions, Condition{
+		Type:               condType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: time.Now(),
+	})
+}
+
+// GetCondition returns the condition of the given type, or nil.
+func (s *NetdebugResultStatus) GetCondition(condType string) *Condition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == condType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// IsConditionTrue reports whether the condition of the given type is "True".
+func (s *NetdebugResultStatus) IsConditionTrue(condType string) bool {
+	for _, cond := range s.Conditions {
+		if cond.Type == condType {
+			return cond.Status == "True"
+		}
+	}
+	return false
+}
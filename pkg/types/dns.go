@@ -0,0 +1,124 @@
+package types
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DNSRecordTypes are the record types a DNS query may ask for.
+var DNSRecordTypes = []string{"A", "AAAA", "SRV", "PTR", "CNAME"}
+
+// NodeLocalDNSAddress is the link-local address NodeLocal DNSCache listens on.
+const NodeLocalDNSAddress = "169.254.20.10"
+
+// DNSQuery is one lookup of the dns check.
+type DNSQuery struct {
+	Name string `json:"name"`
+	// Server is the host:port to query. Empty uses the nameservers and search
+	// path from /etc/resolv.conf.
+	Server string `json:"server,omitempty"`
+	// Type is one of DNSRecordTypes. Empty looks up both A and AAAA records.
+	Type string `json:"type,omitempty"`
+	// Expected, if set, must be among the answers: an IP for A and AAAA, a
+	// name for PTR and CNAME, and target:port for SRV.
+	Expected string `json:"expected,omitempty"`
+}
+
+// String formats the query in the form ParseDNSQuery reads.
+func (q DNSQuery) String() string {
+	s := q.Name
+	if q.Server != "" {
+		s += "@" + q.Server
+	}
+	if q.Type != "" {
+		s += "/" + q.Type
+	}
+	if q.Expected != "" {
+		s += "=" + q.Expected
+	}
+	return s
+}
+
+// ParseDNSQuery parses a query in the form NAME[@SERVER][/TYPE][=EXPECTED],
+// e.g. "google.com", "kubernetes.default.svc.cluster.local@10.43.0.10/A=10.43.0.1"
+// or "_https._tcp.kubernetes.default.svc.cluster.local/SRV". SERVER is an IP
+// or host, with port 53 unless given; "nodelocal" is NodeLocal DNSCache. A
+// NAME sent to a SERVER is not expanded with the search path. For PTR, NAME
+// may be an IP.
+func ParseDNSQuery(s string) (*DNSQuery, error) {
+	spec := strings.TrimSpace(s)
+	if spec == "" {
+		return nil, fmt.Errorf("empty DNS query")
+	}
+
+	query := &DNSQuery{}
+
+	if idx := strings.Index(spec, "="); idx >= 0 {
+		query.Expected = spec[idx+1:]
+		spec = spec[:idx]
+		if query.Expected == "" {
+			return nil, fmt.Errorf("empty expected answer in %q", s)
+		}
+	}
+
+	if idx := strings.LastIndex(spec, "/"); idx >= 0 {
+		query.Type = strings.ToUpper(spec[idx+1:])
+		spec = spec[:idx]
+		if !isDNSRecordType(query.Type) {
+			return nil, fmt.Errorf("invalid record type %q in %q (must be one of %s)", query.Type, s, strings.Join(DNSRecordTypes, ", "))
+		}
+	}
+
+	if idx := strings.Index(spec, "@"); idx >= 0 {
+		server := spec[idx+1:]
+		spec = spec[:idx]
+		if server == "" {
+			return nil, fmt.Errorf("empty server in %q", s)
+		}
+		query.Server = dnsServerAddress(server)
+	}
+
+	if spec == "" {
+		return nil, fmt.Errorf("missing name in %q", s)
+	}
+	query.Name = spec
+
+	return query, nil
+}
+
+// ParseDNSQueries parses a list of queries with ParseDNSQuery.
+func ParseDNSQueries(specs []string) ([]DNSQuery, error) {
+	queries := make([]DNSQuery, 0, len(specs))
+	for _, spec := range specs {
+		query, err := ParseDNSQuery(spec)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, *query)
+	}
+	return queries, nil
+}
+
+func isDNSRecordType(t string) bool {
+	for _, known := range DNSRecordTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// dnsServerAddress adds the default DNS port to a server without one.
+func dnsServerAddress(server string) string {
+	if server == "nodelocal" {
+		server = NodeLocalDNSAddress
+	}
+	if net.ParseIP(server) != nil {
+		return net.JoinHostPort(server, "53")
+	}
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(server, "53")
+}
@@ -0,0 +1,43 @@
+package types
+
+import "testing"
+
+func TestParseDNSQuery(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    DNSQuery
+		wantErr bool
+	}{
+		{in: "google.com", want: DNSQuery{Name: "google.com"}},
+		{in: "google.com@1.1.1.1", want: DNSQuery{Name: "google.com", Server: "1.1.1.1:53"}},
+		{in: "google.com@[fd00::10]:5353/aaaa", want: DNSQuery{Name: "google.com", Server: "[fd00::10]:5353", Type: "AAAA"}},
+		{in: "google.com@fd00::10", want: DNSQuery{Name: "google.com", Server: "[fd00::10]:53"}},
+		{in: "kubernetes.default@nodelocal/A=10.43.0.1", want: DNSQuery{Name: "kubernetes.default", Server: "169.254.20.10:53", Type: "A", Expected: "10.43.0.1"}},
+		{in: "_https._tcp.kubernetes.default.svc.cluster.local/SRV=kubernetes.default.svc.cluster.local:443", want: DNSQuery{Name: "_https._tcp.kubernetes.default.svc.cluster.local", Type: "SRV", Expected: "kubernetes.default.svc.cluster.local:443"}},
+		{in: "", wantErr: true},
+		{in: "google.com/MX", wantErr: true},
+		{in: "google.com@", wantErr: true},
+		{in: "google.com=", wantErr: true},
+		{in: "@1.1.1.1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDNSQuery(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseDNSQuery(%q) expected error, got %+v", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDNSQuery(%q) unexpected error: %v", tt.in, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("ParseDNSQuery(%q) = %+v, want %+v", tt.in, *got, tt.want)
+		}
+		if reparsed, err := ParseDNSQuery(got.String()); err != nil || *reparsed != *got {
+			t.Errorf("ParseDNSQuery(%q).String() = %q doesn't round trip", tt.in, got.String())
+		}
+	}
+}
@@ -10,16 +10,20 @@ const (
 	EventTypeTestResult EventType = "test_result"
 	EventTypeComplete   EventType = "complete"
 	EventTypeError      EventType = "error"
+	EventTypeCancelled  EventType = "cancelled"
+	// EventTypeCrashed is raised by the coordinator, not the agent, when an
+	// agent pod restarts or goes away before finishing the run.
+	EventTypeCrashed EventType = "crashed"
 )
 
 type Event struct {
 	Type      EventType   `json:"type"`
 	Node      string      `json:"node"`
-	Network   string      `json:"network,omitempty"` // "host" or "overlay"
+	Network   string      `json:"network,omitempty"` // a NetworkType, e.g. "hostnetwork" or "host->overlay"
 	Pod       string      `json:"pod,omitempty"`
 	Check     string      `json:"check,omitempty"`
 	Target    string      `json:"target,omitempty"`
-	Status    string      `json:"status,omitempty"` // "pass" or "fail"
+	Status    string      `json:"status,omitempty"` // "pass", "warn" or "fail"
 	Error     string      `json:"error,omitempty"`
 	Details   interface{} `json:"details,omitempty"`
 	Timestamp time.Time   `json:"timestamp"`
@@ -88,3 +92,26 @@ func CompleteEvent(node, network, pod string, summary interface{}, runID string)
 		Timestamp: time.Now(),
 	}
 }
+
+func CancelledEvent(node, network, pod, runID string) *Event {
+	return &Event{
+		Type:      EventTypeCancelled,
+		Node:      node,
+		Network:   network,
+		Pod:       pod,
+		RunID:     runID,
+		Timestamp: time.Now(),
+	}
+}
+
+func CrashedEvent(node, network, pod, errMsg, runID string) *Event {
+	return &Event{
+		Type:      EventTypeCrashed,
+		Node:      node,
+		Network:   network,
+		Pod:       pod,
+		Error:     errMsg,
+		RunID:     runID,
+		Timestamp: time.Now(),
+	}
+}
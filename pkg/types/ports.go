@@ -1,5 +1,13 @@
 package types
 
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
 type NodeRole string
 
 const (
@@ -14,6 +22,9 @@ type PortCheck struct {
 	Protocol string   `json:"protocol"`
 	Name     string   `json:"name"`
 	NodeRole NodeRole `json:"node_role"`
+	// Optional ports are only open in some modes of the CNI or on the nodes
+	// running one of its components, so closing them doesn't fail the check.
+	Optional bool `json:"optional,omitempty"`
 }
 
 func DefaultPorts() []PortCheck {
@@ -29,6 +40,187 @@ func DefaultPorts() []PortCheck {
 	}
 }
 
+// CNINone disables CNI port profiles.
+const CNINone = "none"
+
+// CNIPortProfiles are the ports each CNI needs open between nodes, keyed by
+// profile name. They are merged into the port list when the CNI is detected or
+// named with --cni. Ports that depend on the CNI's mode (BGP or VXLAN, tunnel
+// or native routing, encryption) or only listen on some nodes are optional
+// here; CNIProfilePorts requires the ones a known mode uses.
+var CNIPortProfiles = map[string][]PortCheck{
+	"flannel": {
+		{Port: 8472, Protocol: "udp", Name: "flannel-vxlan", NodeRole: NodeRoleAll},
+	},
+	"flannel-wireguard": {
+		{Port: 51820, Protocol: "udp", Name: "flannel-wireguard", NodeRole: NodeRoleAll},
+		// Only on dual-stack clusters
+		{Port: 51821, Protocol: "udp", Name: "flannel-wireguard-ipv6", NodeRole: NodeRoleAll, Optional: true},
+	},
+	"canal": {
+		{Port: 8472, Protocol: "udp", Name: "canal-vxlan", NodeRole: NodeRoleAll},
+		// Felix serves health on localhost unless healthHost is set
+		{Port: 9099, Protocol: "tcp", Name: "canal-felix-health", NodeRole: NodeRoleAll, Optional: true},
+	},
+	"calico": {
+		// BGP mode only
+		{Port: 179, Protocol: "tcp", Name: "calico-bgp", NodeRole: NodeRoleAll, Optional: true},
+		// Only on the nodes running a Typha replica
+		{Port: 5473, Protocol: "tcp", Name: "calico-typha", NodeRole: NodeRoleAll, Optional: true},
+		// VXLAN mode only
+		{Port: 4789, Protocol: "udp", Name: "calico-vxlan", NodeRole: NodeRoleAll, Optional: true},
+	},
+	"cilium": {
+		// VXLAN or Geneve tunnel mode only, not with native routing
+		{Port: 8472, Protocol: "udp", Name: "cilium-vxlan", NodeRole: NodeRoleAll, Optional: true},
+		{Port: 6081, Protocol: "udp", Name: "cilium-geneve", NodeRole: NodeRoleAll, Optional: true},
+		{Port: 4240, Protocol: "tcp", Name: "cilium-health", NodeRole: NodeRoleAll},
+		// WireGuard encryption only
+		{Port: 51871, Protocol: "udp", Name: "cilium-wireguard", NodeRole: NodeRoleAll, Optional: true},
+	},
+}
+
+// CNIMode is how a CNI is set up, as read from the cluster, which decides the
+// ports of its profile that must be open.
+type CNIMode struct {
+	// BGP is set when Calico peers with BIRD over BGP.
+	BGP bool `json:"bgp,omitempty"`
+	// VXLAN is set when a Calico IP pool or Cilium's tunnel uses VXLAN.
+	VXLAN bool `json:"vxlan,omitempty"`
+	// Geneve is set when Cilium's tunnel uses Geneve.
+	Geneve bool `json:"geneve,omitempty"`
+	// WireGuard is set when Cilium encrypts with WireGuard.
+	WireGuard bool `json:"wireguard,omitempty"`
+	// TyphaNodes are the nodes running a Calico Typha replica.
+	TyphaNodes []string `json:"typha_nodes,omitempty"`
+}
+
+// uses reports whether the mode needs the profile port of the given name, and
+// whether the mode decides that port at all.
+func (m *CNIMode) uses(name string) (used, known bool) {
+	switch name {
+	case "calico-bgp":
+		return m.BGP, true
+	case "calico-typha":
+		return len(m.TyphaNodes) > 0, true
+	case "calico-vxlan", "cilium-vxlan":
+		return m.VXLAN, true
+	case "cilium-geneve":
+		return m.Geneve, true
+	case "cilium-wireguard":
+		return m.WireGuard, true
+	}
+	return false, false
+}
+
+// PortNodes limits the ports only some nodes listen on to those nodes, keyed
+// by port name, for Config.PortNodes.
+func (m *CNIMode) PortNodes() map[string][]string {
+	if m == nil || len(m.TyphaNodes) == 0 {
+		return nil
+	}
+	return map[string][]string{"calico-typha": m.TyphaNodes}
+}
+
+// CNIProfilePorts returns the ports of a CNI profile for the given mode: the
+// ports the mode uses are required and the others left out. Without a mode,
+// the profile is returned as is, with its mode-dependent ports optional.
+func CNIProfilePorts(cni string, mode *CNIMode) []PortCheck {
+	profile := CNIPortProfiles[cni]
+	if mode == nil {
+		return profile
+	}
+
+	var ports []PortCheck
+	for _, port := range profile {
+		used, known := mode.uses(port.Name)
+		switch {
+		case !known:
+			ports = append(ports, port)
+		case used:
+			port.Optional = false
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// FilterPortsForNode drops the ports that portNodes limits to other nodes.
+func FilterPortsForNode(ports []PortCheck, portNodes map[string][]string, nodeName string) []PortCheck {
+	var filtered []PortCheck
+	for _, port := range ports {
+		if nodes, ok := portNodes[port.Name]; ok && !slices.Contains(nodes, nodeName) {
+			continue
+		}
+		filtered = append(filtered, port)
+	}
+	return filtered
+}
+
+// FlannelBackendWireguard is flannel's WireGuard backend type, as set in
+// flannel's backend-type node annotation.
+const FlannelBackendWireguard = "wireguard"
+
+// FlannelProfile returns the port profile for a flannel backend type such as
+// "vxlan" or "wireguard".
+func FlannelProfile(backend string) string {
+	if strings.Contains(strings.ToLower(backend), FlannelBackendWireguard) {
+		return "flannel-wireguard"
+	}
+	return "flannel"
+}
+
+// cniNameKeywords map a keyword in a CNI DaemonSet or CNI config file name to
+// its port profile. Canal comes before calico and flannel since its names may
+// contain either.
+var cniNameKeywords = []struct {
+	keyword string
+	profile string
+}{
+	{"canal", "canal"},
+	{"calico", "calico"},
+	{"cilium", "cilium"},
+	{"flannel", "flannel"},
+}
+
+// CNIFromName returns the port profile for a CNI DaemonSet or CNI config file
+// name such as "calico-node" or "10-flannel.conflist", or "" if it matches none.
+func CNIFromName(name string) string {
+	name = strings.ToLower(name)
+	for _, k := range cniNameKeywords {
+		if strings.Contains(name, k.keyword) {
+			return k.profile
+		}
+	}
+	return ""
+}
+
+// CNIProfileNames returns the names of all CNI port profiles, sorted.
+func CNIProfileNames() []string {
+	names := make([]string, 0, len(CNIPortProfiles))
+	for name := range CNIPortProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MergePorts appends the ports in extra that aren't already in ports, matching
+// on port number and protocol.
+func MergePorts(ports, extra []PortCheck) []PortCheck {
+	merged := make([]PortCheck, 0, len(ports)+len(extra))
+	seen := make(map[string]bool)
+	for _, port := range append(append([]PortCheck{}, ports...), extra...) {
+		key := fmt.Sprintf("%d/%s", port.Port, port.Protocol)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		merged = append(merged, port)
+	}
+	return merged
+}
+
 func FilterPortsForRole(ports []PortCheck, isControlPlane bool) []PortCheck {
 	var filtered []PortCheck
 	for _, port := range ports {
@@ -43,7 +235,56 @@ func FilterPortsForRole(ports []PortCheck, isControlPlane bool) []PortCheck {
 	return filtered
 }
 
+// ParsePortString parses a port in the form PORT[/PROTOCOL][:NAME], e.g.
+// "8080/tcp:web" or "8472/udp". The protocol defaults to tcp and the port is
+// checked on all nodes.
 func ParsePortString(s string) (*PortCheck, error) {
-	// TODO: Implement port string parsing
-	return nil, nil
+	spec := strings.TrimSpace(s)
+	if spec == "" {
+		return nil, fmt.Errorf("empty port")
+	}
+
+	port := &PortCheck{
+		Protocol: "tcp",
+		NodeRole: NodeRoleAll,
+	}
+
+	if idx := strings.Index(spec, ":"); idx >= 0 {
+		port.Name = spec[idx+1:]
+		spec = spec[:idx]
+	}
+
+	if idx := strings.Index(spec, "/"); idx >= 0 {
+		port.Protocol = strings.ToLower(spec[idx+1:])
+		spec = spec[:idx]
+	}
+
+	if port.Protocol != "tcp" && port.Protocol != "udp" {
+		return nil, fmt.Errorf("invalid protocol %q in %q (must be tcp or udp)", port.Protocol, s)
+	}
+
+	num, err := strconv.Atoi(spec)
+	if err != nil || num < 1 || num > 65535 {
+		return nil, fmt.Errorf("invalid port number in %q", s)
+	}
+	port.Port = num
+
+	if port.Name == "" {
+		port.Name = fmt.Sprintf("%d-%s", port.Port, port.Protocol)
+	}
+
+	return port, nil
+}
+
+// ParsePortStrings parses a list of port strings with ParsePortString.
+func ParsePortStrings(specs []string) ([]PortCheck, error) {
+	ports := make([]PortCheck, 0, len(specs))
+	for _, spec := range specs {
+		port, err := ParsePortString(spec)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, *port)
+	}
+	return ports, nil
 }
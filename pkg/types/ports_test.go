@@ -0,0 +1,188 @@
+package types
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePortString(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    PortCheck
+		wantErr bool
+	}{
+		{in: "8080", want: PortCheck{Port: 8080, Protocol: "tcp", Name: "8080-tcp", NodeRole: NodeRoleAll}},
+		{in: "8472/udp", want: PortCheck{Port: 8472, Protocol: "udp", Name: "8472-udp", NodeRole: NodeRoleAll}},
+		{in: "9000/UDP:metrics", want: PortCheck{Port: 9000, Protocol: "udp", Name: "metrics", NodeRole: NodeRoleAll}},
+		{in: "6443:apiserver", want: PortCheck{Port: 6443, Protocol: "tcp", Name: "apiserver", NodeRole: NodeRoleAll}},
+		{in: "", wantErr: true},
+		{in: "abc/tcp", wantErr: true},
+		{in: "70000", wantErr: true},
+		{in: "53/sctp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePortString(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParsePortString(%q) expected error, got %+v", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePortString(%q) unexpected error: %v", tt.in, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("ParsePortString(%q) = %+v, want %+v", tt.in, *got, tt.want)
+		}
+	}
+}
+
+func TestCNIFromName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"calico-node", "calico"},
+		{"rke2-canal", "canal"},
+		{"10-canal.conflist", "canal"},
+		{"kube-flannel-ds", "flannel"},
+		{"10-flannel.conflist", "flannel"},
+		{"05-cilium.conflist", "cilium"},
+		{"kube-proxy", ""},
+	}
+
+	for _, tt := range tests {
+		if got := CNIFromName(tt.in); got != tt.want {
+			t.Errorf("CNIFromName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if tt.want != "" {
+			if _, ok := CNIPortProfiles[tt.want]; !ok {
+				t.Errorf("CNIFromName(%q) = %q has no port profile", tt.in, tt.want)
+			}
+		}
+	}
+}
+
+func TestFlannelProfile(t *testing.T) {
+	tests := []struct {
+		backend string
+		want    string
+	}{
+		{"vxlan", "flannel"},
+		{"host-gw", "flannel"},
+		{"wireguard", "flannel-wireguard"},
+		{"WireGuard", "flannel-wireguard"},
+	}
+
+	for _, tt := range tests {
+		if got := FlannelProfile(tt.backend); got != tt.want {
+			t.Errorf("FlannelProfile(%q) = %q, want %q", tt.backend, got, tt.want)
+		}
+		if _, ok := CNIPortProfiles[tt.want]; !ok {
+			t.Errorf("FlannelProfile(%q) = %q has no port profile", tt.backend, tt.want)
+		}
+	}
+}
+
+func TestMergePorts(t *testing.T) {
+	base := []PortCheck{
+		{Port: 10250, Protocol: "tcp", Name: "kubelet", NodeRole: NodeRoleAll},
+		{Port: 8472, Protocol: "udp", Name: "custom-vxlan", NodeRole: NodeRoleAll},
+	}
+
+	merged := MergePorts(base, CNIPortProfiles["cilium"])
+
+	if len(merged) != 5 {
+		t.Fatalf("MergePorts returned %d ports, want 5: %+v", len(merged), merged)
+	}
+	if merged[1].Name != "custom-vxlan" {
+		t.Errorf("duplicate 8472/udp replaced the existing entry: %+v", merged[1])
+	}
+	if len(base) != 2 {
+		t.Errorf("MergePorts modified its input")
+	}
+}
+
+func TestCNIProfilePorts(t *testing.T) {
+	tests := []struct {
+		name     string
+		cni      string
+		mode     *CNIMode
+		required []string
+		optional []string
+	}{
+		{
+			name:     "calico without a mode",
+			cni:      "calico",
+			optional: []string{"calico-bgp", "calico-typha", "calico-vxlan"},
+		},
+		{
+			name:     "calico BGP with Typha",
+			cni:      "calico",
+			mode:     &CNIMode{BGP: true, TyphaNodes: []string{"node-1"}},
+			required: []string{"calico-bgp", "calico-typha"},
+		},
+		{
+			name:     "calico VXLAN",
+			cni:      "calico",
+			mode:     &CNIMode{VXLAN: true},
+			required: []string{"calico-vxlan"},
+		},
+		{
+			name:     "cilium geneve with wireguard",
+			cni:      "cilium",
+			mode:     &CNIMode{Geneve: true, WireGuard: true},
+			required: []string{"cilium-geneve", "cilium-health", "cilium-wireguard"},
+		},
+		{
+			name:     "cilium native routing",
+			cni:      "cilium",
+			mode:     &CNIMode{},
+			required: []string{"cilium-health"},
+		},
+		{
+			name:     "canal ignores the mode",
+			cni:      "canal",
+			mode:     &CNIMode{},
+			required: []string{"canal-vxlan"},
+			optional: []string{"canal-felix-health"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var required, optional []string
+			for _, port := range CNIProfilePorts(tt.cni, tt.mode) {
+				if port.Optional {
+					optional = append(optional, port.Name)
+				} else {
+					required = append(required, port.Name)
+				}
+			}
+			if !slices.Equal(required, tt.required) {
+				t.Errorf("required ports = %v, want %v", required, tt.required)
+			}
+			if !slices.Equal(optional, tt.optional) {
+				t.Errorf("optional ports = %v, want %v", optional, tt.optional)
+			}
+		})
+	}
+}
+
+func TestFilterPortsForNode(t *testing.T) {
+	ports := []PortCheck{
+		{Port: 179, Protocol: "tcp", Name: "calico-bgp", NodeRole: NodeRoleAll},
+		{Port: 5473, Protocol: "tcp", Name: "calico-typha", NodeRole: NodeRoleAll},
+	}
+	portNodes := map[string][]string{"calico-typha": {"node-1"}}
+
+	if got := FilterPortsForNode(ports, portNodes, "node-1"); len(got) != 2 {
+		t.Errorf("FilterPortsForNode(node-1) = %+v, want both ports", got)
+	}
+	got := FilterPortsForNode(ports, portNodes, "node-2")
+	if len(got) != 1 || got[0].Name != "calico-bgp" {
+		t.Errorf("FilterPortsForNode(node-2) = %+v, want only calico-bgp", got)
+	}
+}
@@ -18,8 +18,11 @@ type TestResult struct {
 type ResultStatus string
 
 const (
-	StatusPass       ResultStatus = "pass"
-	StatusFail       ResultStatus = "fail"
+	StatusPass ResultStatus = "pass"
+	StatusFail ResultStatus = "fail"
+	// StatusWarn is a result that doesn't fail but can't be confirmed either,
+	// such as a UDP port that neither answers nor is reported closed.
+	StatusWarn       ResultStatus = "warn"
 	StatusIncomplete ResultStatus = "incomplete"
 	StatusSkipped    ResultStatus = "skipped"
 )
@@ -37,9 +40,90 @@ type TestSummary struct {
 }
 
 type DNSCheckDetails struct {
-	Query       string   `json:"query"`
+	// Query is the query as given, in the form ParseDNSQuery reads.
+	Query string `json:"query"`
+	// Server is the nameserver that answered, and Name the fully qualified
+	// name it answered for after the search path was applied.
+	Server string `json:"server,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Type   string `json:"type,omitempty"`
+	// ResolvedIPs holds the answers of A and AAAA lookups, and Answers those
+	// of other record types.
 	ResolvedIPs []string `json:"resolved_ips,omitempty"`
+	Answers     []string `json:"answers,omitempty"`
+	Expected    string   `json:"expected,omitempty"`
 	LatencyMS   float64  `json:"latency_ms"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// DNSTransportProbe is one query of a lookup sent over a fixed transport.
+type DNSTransportProbe struct {
+	// Transport is "udp" or "tcp".
+	Transport string `json:"transport"`
+	// EDNSSize is the EDNS0 UDP buffer size advertised, 0 for none.
+	EDNSSize  int     `json:"edns_size,omitempty"`
+	Size      int     `json:"size_bytes,omitempty"`
+	Answers   int     `json:"answers"`
+	Truncated bool    `json:"truncated,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// DNSTransportDetails holds the transport probes of one successful lookup,
+// sent again to the server and name that answered it.
+type DNSTransportDetails struct {
+	Query  string `json:"query"`
+	Server string `json:"server"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	// MTU is the MTU of the route to the server, 0 when it couldn't be read.
+	MTU    int                 `json:"mtu,omitempty"`
+	Probes []DNSTransportProbe `json:"probes"`
+	Issues []string            `json:"issues,omitempty"`
+}
+
+// LatencyBucket is one bucket of a latency histogram. LeMS is its upper bound
+// in milliseconds, 0 for the bucket of everything above the last bound.
+type LatencyBucket struct {
+	LeMS  float64 `json:"le_ms,omitempty"`
+	Count int     `json:"count"`
+}
+
+// DNSBurstDetails holds the pairs of parallel A and AAAA queries a burst sent
+// for one successful lookup.
+type DNSBurstDetails struct {
+	Query         string          `json:"query"`
+	Server        string          `json:"server"`
+	Name          string          `json:"name"`
+	Pairs         int             `json:"pairs"`
+	Answered      int             `json:"answered"`
+	Timeouts      int             `json:"timeouts"`
+	Over1s        int             `json:"over_1s"`
+	Over5s        int             `json:"over_5s"`
+	Over1sPercent float64         `json:"over_1s_percent"`
+	Over5sPercent float64         `json:"over_5s_percent"`
+	MinLatencyMS  float64         `json:"min_latency_ms"`
+	AvgLatencyMS  float64         `json:"avg_latency_ms"`
+	P50LatencyMS  float64         `json:"p50_latency_ms"`
+	P99LatencyMS  float64         `json:"p99_latency_ms"`
+	MaxLatencyMS  float64         `json:"max_latency_ms"`
+	Histogram     []LatencyBucket `json:"histogram"`
+	// ConntrackInsertFailed is how much the node's insert_failed counter grew
+	// during the burst. Only host network agents can read it.
+	ConntrackInsertFailed *int   `json:"conntrack_insert_failed,omitempty"`
+	Error                 string `json:"error,omitempty"`
+}
+
+// DNSServerDetails holds the lookups the dns check sent to one DNS server.
+type DNSServerDetails struct {
+	Name         string   `json:"name"`
+	Address      string   `json:"address"`
+	NodeName     string   `json:"node_name,omitempty"`
+	Queries      int      `json:"queries"`
+	Failed       int      `json:"failed"`
+	AvgLatencyMS float64  `json:"avg_latency_ms"`
+	MaxLatencyMS float64  `json:"max_latency_ms"`
+	Errors       []string `json:"errors,omitempty"`
 }
 
 type PingCheckDetails struct {
@@ -52,15 +136,62 @@ type PingCheckDetails struct {
 	TTL             int     `json:"ttl"`
 }
 
+type TCPPingCheckDetails struct {
+	Port            int     `json:"port"`
+	PacketsSent     int     `json:"packets_sent"`
+	PacketsReceived int     `json:"packets_received"`
+	PacketLoss      float64 `json:"packet_loss_percent"`
+	MinLatencyMS    float64 `json:"min_latency_ms"`
+	AvgLatencyMS    float64 `json:"avg_latency_ms"`
+	MaxLatencyMS    float64 `json:"max_latency_ms"`
+}
+
+type TracerouteHop struct {
+	Hop      int     `json:"hop"`
+	Address  string  `json:"address,omitempty"`
+	AvgRTTMS float64 `json:"avg_rtt_ms,omitempty"`
+	Sent     int     `json:"sent"`
+	Received int     `json:"received"`
+	Loss     float64 `json:"loss_percent"`
+	// Note is a traceroute annotation such as !H (host unreachable).
+	Note string `json:"note,omitempty"`
+}
+
+type TracerouteDetails struct {
+	Protocol string          `json:"protocol"`
+	Reached  bool            `json:"reached"`
+	Hops     []TracerouteHop `json:"hops,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// Port states reported by the ports check.
+const (
+	PortOpen         = "open"
+	PortClosed       = "closed"
+	PortOpenFiltered = "open|filtered"
+)
+
 type PortCheckDetails struct {
-	Port         int     `json:"port"`
-	Protocol     string  `json:"protocol"`
-	Open         bool    `json:"open"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+	Open     bool   `json:"open"`
+	// State is PortOpen, PortClosed, or PortOpenFiltered for a UDP port that
+	// neither answered nor was refused, as VXLAN and WireGuard never answer.
+	State        string  `json:"state"`
+	Optional     bool    `json:"optional,omitempty"`
 	LatencyMS    float64 `json:"latency_ms,omitempty"`
 	ResponseData string  `json:"response_data,omitempty"`
 	Error        string  `json:"error,omitempty"`
 }
 
+type PMTUCheckDetails struct {
+	PathMTU      int    `json:"path_mtu"`
+	MaxPayload   int    `json:"max_payload,omitempty"`
+	Interface    string `json:"interface"`
+	InterfaceMTU int    `json:"interface_mtu"`
+	Probes       int    `json:"probes"`
+}
+
 type BandwidthCheckDetails struct {
 	BandwidthMbps float64 `json:"bandwidth_mbps"`
 	Retransmits   int     `json:"retransmits"`
@@ -68,6 +199,71 @@ type BandwidthCheckDetails struct {
 	Duration      int     `json:"duration_seconds"`
 }
 
+type UDPBandwidthCheckDetails struct {
+	BandwidthMbps  float64 `json:"bandwidth_mbps"`
+	TargetBitrate  string  `json:"target_bitrate"`
+	JitterMS       float64 `json:"jitter_ms"`
+	LostDatagrams  int     `json:"lost_datagrams"`
+	TotalDatagrams int     `json:"total_datagrams"`
+	LostPercent    float64 `json:"lost_percent"`
+	OutOfOrder     int     `json:"out_of_order"`
+	Duration       int     `json:"duration_seconds"`
+}
+
+type ServiceCheckDetails struct {
+	Address   string `json:"address"`
+	Requests  int    `json:"requests"`
+	Succeeded int    `json:"succeeded"`
+	// Backends counts the answers from each backend, by node name.
+	Backends map[string]int `json:"backends,omitempty"`
+	// Errors counts the failed requests by error.
+	Errors map[string]int `json:"errors,omitempty"`
+	// Missing are the nodes of expected backends that never answered.
+	Missing []string `json:"missing,omitempty"`
+}
+
+type NodePortCheckDetails struct {
+	// Policy is the externalTrafficPolicy of the Service probed.
+	Policy    string `json:"policy"`
+	Port      int    `json:"port"`
+	Reachable bool   `json:"reachable"`
+	// Expected is false for the Local policy on a node without a backend.
+	Expected  bool    `json:"expected"`
+	Backend   string  `json:"backend,omitempty"`
+	LatencyMS float64 `json:"latency_ms,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// DNSRecordDetails is one record the dnsrecords check looked up and the
+// answers it expected.
+type DNSRecordDetails struct {
+	// Kind is "service" (the headless Service's A records), "srv" (its named
+	// port), "endpoint" (one endpoint's A record under the Service) or "pod"
+	// (one pod's A record).
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// NodeName is the node of the pod a per-pod record is for.
+	NodeName string   `json:"node_name,omitempty"`
+	Expected []string `json:"expected"`
+	Answers  []string `json:"answers,omitempty"`
+	// Missing are expected answers DNS didn't return, and Stale are answers it
+	// returned that weren't expected.
+	Missing   []string `json:"missing,omitempty"`
+	Stale     []string `json:"stale,omitempty"`
+	LatencyMS float64  `json:"latency_ms"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// DNSRecordsDetails holds the records of the headless Service in front of the
+// overlay agents and of its pods, as one agent saw them.
+type DNSRecordsDetails struct {
+	Service string             `json:"service"`
+	Server  string             `json:"server,omitempty"`
+	Records []DNSRecordDetails `json:"records"`
+	Issues  []string           `json:"issues,omitempty"`
+}
+
 type HostConfigDetails struct {
 	IPForwarding bool              `json:"ip_forwarding"`
 	MTU          int               `json:"mtu"`
@@ -77,6 +273,36 @@ type HostConfigDetails struct {
 	Issues       []string          `json:"issues,omitempty"`
 }
 
+// ResolvConfFile is one parsed resolv.conf.
+type ResolvConfFile struct {
+	// Source says whose config it is: "pod", "kubelet" (what kubelet hands to
+	// dnsPolicy: Default pods), "host" or "systemd-resolved".
+	Source      string   `json:"source"`
+	Path        string   `json:"path"`
+	Nameservers []string `json:"nameservers,omitempty"`
+	Search      []string `json:"search,omitempty"`
+	Ndots       int      `json:"ndots"`
+	Options     []string `json:"options,omitempty"`
+}
+
+type ResolvConfDetails struct {
+	Files  []ResolvConfFile `json:"files,omitempty"`
+	Issues []string         `json:"issues,omitempty"`
+}
+
+type OverlayMTUDetails struct {
+	Backend         string   `json:"backend"`
+	Overhead        int      `json:"overhead"`
+	UplinkInterface string   `json:"uplink_interface"`
+	UplinkMTU       int      `json:"uplink_mtu"`
+	TunnelInterface string   `json:"tunnel_interface,omitempty"`
+	TunnelMTU       int      `json:"tunnel_mtu,omitempty"`
+	PodInterface    string   `json:"pod_interface,omitempty"`
+	PodMTU          int      `json:"pod_mtu,omitempty"`
+	ExpectedMTU     int      `json:"expected_mtu"`
+	Issues          []string `json:"issues,omitempty"`
+}
+
 type ConntrackDetails struct {
 	Entries       int      `json:"entries"`
 	MaxEntries    int      `json:"max_entries"`